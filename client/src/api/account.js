@@ -27,13 +27,16 @@ const Account = {
 
   authenticate: async function (authorizationCode) {
     var params = {
-      "code": authorizationCode
+      "code": authorizationCode,
+      "invitation": window.localStorage.getItem('invitation') || ''
     };
     let resp = await api.post('/auth', params, {})
     if (resp.data) {
+      window.localStorage.removeItem('invitation');
       window.localStorage.setItem('token', resp.data.authentication_token);
       window.localStorage.setItem('user_id', resp.data.user_id);
       window.localStorage.setItem('role', resp.data.role);
+      window.localStorage.setItem('permissions', (resp.data.permissions || []).join(','));
     }
     return resp
   },
@@ -46,6 +49,11 @@ const Account = {
     return window.localStorage.getItem('role');
   },
 
+  can: function (permission) {
+    let permissions = window.localStorage.getItem('permissions') || '';
+    return permissions.split(',').indexOf(permission) >= 0;
+  },
+
   token: function () {
     return window.localStorage.getItem('token');
   },
@@ -0,0 +1,13 @@
+import api from './net'
+
+const Blacklist = {
+  index: async function (t=0, q='') {
+    return await api.get('/blacklists?offset=' + t + '&q=' + q, {})
+  },
+
+  remove: async function (userId) {
+    return await api.delete('/blacklists/' + userId, {})
+  }
+}
+
+export default Blacklist
@@ -5,5 +5,9 @@ export default {
   property: require('./property').default,
   packet: require('./packet').default,
   broadcaster: require('./broadcaster').default,
+  blacklist: require('./blacklist').default,
+  quote: require('./quote').default,
+  intent: require('./intent').default,
+  invitation: require('./invitation').default,
   net: require('./net').default,
 }
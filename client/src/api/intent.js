@@ -0,0 +1,13 @@
+import api from './net'
+
+const Intent = {
+  async create (params) {
+    return await api.post('/intents', params, {})
+  },
+
+  async show (id) {
+    return await api.get('/intents/' + id, {})
+  }
+}
+
+export default Intent;
@@ -0,0 +1,22 @@
+import api from './net'
+import { BASE_URL } from '@/constants'
+
+const Invitation = {
+  index: async function () {
+    return await api.get('/invitations', {})
+  },
+
+  create: async function (params) {
+    return await api.post('/invitations', params, {})
+  },
+
+  leaderboard: async function () {
+    return await api.get('/referrals/leaderboard', {})
+  },
+
+  posterURL: function (code) {
+    return BASE_URL + '/invitations/' + code + '/poster'
+  }
+}
+
+export default Invitation
@@ -3,6 +3,10 @@ import api from './net'
 const Property = {
   async create (state) {
     return await api.post('/properties', {'value': state}, {})
+  },
+
+  async slowMode (seconds) {
+    return await api.post('/properties/slow-mode', {'seconds': seconds}, {})
   }
 }
 
@@ -0,0 +1,9 @@
+import api from './net'
+
+const Quote = {
+  async create (plan, assetId) {
+    return await api.post('/quotes', {'plan': plan, 'asset_id': assetId}, {})
+  }
+}
+
+export default Quote;
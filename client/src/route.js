@@ -8,6 +8,8 @@ import PreparePacket from './pages/PreparePacket'
 import Packet from './pages/PacketPage'
 import Members from './pages/MembersPage'
 import Messages from './pages/MessagesPage'
+import Blacklists from './pages/BlacklistsPage'
+import Invitations from './pages/InvitationsPage'
 import PageNotFound from './pages/PageNotFound'
 
 const routes = [
@@ -20,6 +22,8 @@ const routes = [
   { path: '/packets/:id', component: Packet },
   { path: '/members/', component: Members },
   { path: '/messages/', component: Messages },
+  { path: '/blacklists/', component: Blacklists },
+  { path: '/invitations/', component: Invitations },
   { path: '/:pathMatch(.*)*', component: PageNotFound },
 ]
 
@@ -2,7 +2,10 @@ package config
 
 import (
 	_ "embed"
+	"fmt"
 	"log"
+	"os"
+	"sync/atomic"
 
 	yaml "gopkg.in/yaml.v2"
 )
@@ -18,6 +21,36 @@ type PaymentAsset struct {
 	Amount  string `yaml:"amount" json:"amount"`
 }
 
+// MembershipPlan is paid with any of the Prices, or with a quote of PriceUSD
+// in any asset of quote_asset_list. Duration in seconds, zero means the
+// membership never expires.
+type MembershipPlan struct {
+	Name     string         `yaml:"name" json:"name"`
+	Duration int64          `yaml:"duration" json:"duration"`
+	Prices   []PaymentAsset `yaml:"prices" json:"prices"`
+	PriceUSD string         `yaml:"price_usd" json:"price_usd"`
+}
+
+// WarningStep acts when the user reaches Count active warnings, Action is
+// mute or ban, a zero Duration bans forever.
+type WarningStep struct {
+	Count    int    `yaml:"count"`
+	Action   string `yaml:"action"`
+	Duration int64  `yaml:"duration"`
+}
+
+// RateLimit allows Number messages every Duration seconds, zero means no limit.
+type RateLimit struct {
+	Duration int64 `yaml:"duration"`
+	Number   int   `yaml:"number"`
+}
+
+type RateLimitPolicy struct {
+	Message RateLimit `yaml:"message"`
+	Text    RateLimit `yaml:"text"`
+	Media   RateLimit `yaml:"media"`
+}
+
 type Shortcut struct {
 	Icon    string `yaml:"icon" json:"icon"`
 	LabelEn string `yaml:"label_en" json:"label_en"`
@@ -49,22 +82,45 @@ type Config struct {
 		Name     string `yaml:"database_name"`
 	} `yaml:"database"`
 	System struct {
-		MessageShardModifier   string          `yaml:"message_shard_modifier"`
-		MessageShardSize       int64           `yaml:"message_shard_size"`
-		PriceAssetsEnable      bool            `yaml:"price_asset_enable"`
-		AudioMessageEnable     bool            `yaml:"audio_message_enable"`
-		ImageMessageEnable     bool            `yaml:"image_message_enable"`
-		VideoMessageEnable     bool            `yaml:"video_message_enable"`
-		LiveMessageEnable      bool            `yaml:"live_message_enable"`
-		ContactMessageEnable   bool            `yaml:"contact_message_enable"`
-		DetectQRCodeEnabled    bool            `yaml:"detect_image"`
-		DetectLinkEnabled      bool            `yaml:"detect_link"`
-		LimitMessageDuration   int64           `yaml:"limit_message_duration"`
-		LimitMessageNumber     int             `yaml:"limit_message_number"`
-		OperatorList           []string        `yaml:"operator_list"`
-		Operators              map[string]bool `yaml:"-"`
-		PayToJoin              bool            `yaml:"pay_to_join"`
-		AccpetPaymentAssetList []PaymentAsset  `yaml:"accept_asset_list"`
+		MessageShardModifier   string                     `yaml:"message_shard_modifier"`
+		MessageShardSize       int64                      `yaml:"message_shard_size"`
+		PriceAssetsEnable      bool                       `yaml:"price_asset_enable"`
+		AudioMessageEnable     bool                       `yaml:"audio_message_enable"`
+		ImageMessageEnable     bool                       `yaml:"image_message_enable"`
+		VideoMessageEnable     bool                       `yaml:"video_message_enable"`
+		LiveMessageEnable      bool                       `yaml:"live_message_enable"`
+		ContactMessageEnable   bool                       `yaml:"contact_message_enable"`
+		DetectQRCodeEnabled    bool                       `yaml:"detect_image"`
+		DetectLinkEnabled      bool                       `yaml:"detect_link"`
+		DetectImageHashEnabled bool                       `yaml:"detect_image_hash"`
+		ImageHashDistance      int                        `yaml:"image_hash_distance"`
+		AttachmentMaxSize      int64                      `yaml:"attachment_max_size"`
+		AttachmentWorkers      int                        `yaml:"attachment_workers"`
+		LimitMessageDuration   int64                      `yaml:"limit_message_duration"`
+		LimitMessageNumber     int                        `yaml:"limit_message_number"`
+		RateLimitStore         string                     `yaml:"rate_limit_store"`
+		RateLimits             map[string]RateLimitPolicy `yaml:"rate_limits"`
+		GroupRateLimit         RateLimit                  `yaml:"group_rate_limit"`
+		SpamFloodWindow        int64                      `yaml:"spam_flood_window"`
+		SpamFloodThreshold     int                        `yaml:"spam_flood_threshold"`
+		SpamBanThreshold       int                        `yaml:"spam_ban_threshold"`
+		ProbationDuration      int64                      `yaml:"probation_duration"`
+		ProbationLimitDuration int64                      `yaml:"probation_limit_duration"`
+		ProbationLimitNumber   int                        `yaml:"probation_limit_number"`
+		WarningDecay           int64                      `yaml:"warning_decay"`
+		WarningLadder          []WarningStep              `yaml:"warning_ladder"`
+		OperatorList           []string                   `yaml:"operator_list"`
+		Operators              map[string]bool            `yaml:"-"`
+		PayToJoin              bool                       `yaml:"pay_to_join"`
+		TrialDuration          int64                      `yaml:"trial_duration"`
+		AccpetPaymentAssetList []PaymentAsset             `yaml:"accept_asset_list"`
+		MembershipPlanList     []MembershipPlan           `yaml:"membership_plans"`
+		MembershipReminder     int64                      `yaml:"membership_reminder"`
+		QuoteAssetList         []PaymentAsset             `yaml:"quote_asset_list"`
+		QuoteDuration          int64                      `yaml:"quote_duration"`
+		QuoteTolerance         string                     `yaml:"quote_tolerance"`
+		ReferralShare          string                     `yaml:"referral_share"`
+		GiftExpiration         int64                      `yaml:"gift_expiration"`
 	} `yaml:"system"`
 	Appearance struct {
 		HomeWelcomeMessage string          `yaml:"home_welcome_message"`
@@ -80,6 +136,8 @@ type Config struct {
 		GroupOpenedRedPacket    string `yaml:"group_opened_redpacket"`
 		MessageProhibit         string `yaml:"message_prohibit"`
 		MessageAllow            string `yaml:"message_allow"`
+		MessageSlowModeOn       string `yaml:"message_slow_mode_on"`
+		MessageSlowModeOff      string `yaml:"message_slow_mode_off"`
 		MessageTipsJoin         string `yaml:"message_tips_join"`
 		MessageTipsHelpBtn      string `yaml:"message_tips_help_btn"`
 		MessageTipsUnsubscribe  string `yaml:"message_tips_unsubscribe"`
@@ -87,6 +145,19 @@ type Config struct {
 		MessageRewardMemo       string `yaml:"message_reward_memo"`
 		MessageTipsTooMany      string `yaml:"message_tips_too_many"`
 		MessageTipsSuspended    string `yaml:"message_tips_suspended"`
+		MessageTipsProbation    string `yaml:"message_tips_probation"`
+		MessageTipsMuted        string `yaml:"message_tips_muted"`
+		MessageTipsWarned       string `yaml:"message_tips_warned"`
+		MessageTipsSlowMode     string `yaml:"message_tips_slow_mode"`
+		MessageTipsExpiring     string `yaml:"message_tips_expiring"`
+		MessageTipsExpired      string `yaml:"message_tips_expired"`
+		MessageTipsTrial        string `yaml:"message_tips_trial"`
+		MessageTipsTrialEnding  string `yaml:"message_tips_trial_ending"`
+		MessageTipsTrialEnded   string `yaml:"message_tips_trial_ended"`
+		MessageTipsGiftSent     string `yaml:"message_tips_gift_sent"`
+		MessageTipsGiftReceived string `yaml:"message_tips_gift_received"`
+		MessageTipsGiftPending  string `yaml:"message_tips_gift_pending"`
+		MessageTipsDiscrepancy  string `yaml:"message_tips_discrepancy"`
 		MessageCommandsInfo     string `yaml:"message_commands_info"`
 		MessageCommandsInfoResp string `yaml:"message_commands_info_resp"`
 	} `yaml:"message_template"`
@@ -102,34 +173,83 @@ type Config struct {
 }
 
 type ExportedConfig struct {
-	MixinClientId          string          `json:"mixin_client_id"`
-	HTTPResourceHost       string          `json:"host"`
-	AccpetPaymentAssetList []PaymentAsset  `json:"accept_asset_list"`
-	HomeWelcomeMessage     string          `json:"home_welcome_message"`
-	HomeShortcutGroups     []ShortcutGroup `json:"home_shortcut_groups"`
+	MixinClientId          string           `json:"mixin_client_id"`
+	HTTPResourceHost       string           `json:"host"`
+	AccpetPaymentAssetList []PaymentAsset   `json:"accept_asset_list"`
+	MembershipPlans        []MembershipPlan `json:"membership_plans"`
+	QuoteAssetList         []PaymentAsset   `json:"quote_asset_list"`
+	HomeWelcomeMessage     string           `json:"home_welcome_message"`
+	HomeShortcutGroups     []ShortcutGroup  `json:"home_shortcut_groups"`
+}
+
+var appConfig atomic.Pointer[Config]
+
+// AppConfig returns the current config, the settings replace it as a whole
+// with SetAppConfig, so a reader always sees one consistent config.
+func AppConfig() *Config {
+	return appConfig.Load()
 }
 
-var AppConfig *Config
+func SetAppConfig(cfg *Config) {
+	appConfig.Store(cfg)
+}
 
 func Init(env string) {
-	var options map[string]*Config
-	err := yaml.Unmarshal(data, &options)
+	err := Load("", env)
 	if err != nil {
 		log.Fatalf("error: %v", err)
 	}
-	AppConfig = options[env]
-	AppConfig.System.Operators = make(map[string]bool)
-	for _, op := range AppConfig.System.OperatorList {
-		AppConfig.System.Operators[op] = true
+}
+
+// Load reads the environment from the YAML file at path, or from the embedded
+// config.yaml when path is empty, then applies the SUPERGROUP_* variables.
+func Load(path, env string) error {
+	content := data
+	if path != "" {
+		var err error
+		content, err = os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+	}
+	var options map[string]*Config
+	err := yaml.Unmarshal(content, &options)
+	if err != nil {
+		return err
+	}
+	cfg := options[env]
+	if cfg == nil {
+		return fmt.Errorf("environment %s not found", env)
 	}
+	err = applyEnvironment(cfg, os.Environ())
+	if err != nil {
+		return err
+	}
+	cfg.System.Operators = make(map[string]bool)
+	for _, op := range cfg.System.OperatorList {
+		cfg.System.Operators[op] = true
+	}
+	SetAppConfig(cfg)
+	return nil
 }
 
 func GetExported() ExportedConfig {
 	return ExportedConfig{
-		MixinClientId:          AppConfig.Mixin.ClientId,
-		HTTPResourceHost:       AppConfig.Service.HTTPResourceHost,
-		AccpetPaymentAssetList: AppConfig.System.AccpetPaymentAssetList,
-		HomeWelcomeMessage:     AppConfig.Appearance.HomeWelcomeMessage,
-		HomeShortcutGroups:     AppConfig.Appearance.HomeShortcutGroups,
+		MixinClientId:          AppConfig().Mixin.ClientId,
+		HTTPResourceHost:       AppConfig().Service.HTTPResourceHost,
+		AccpetPaymentAssetList: AppConfig().System.AccpetPaymentAssetList,
+		MembershipPlans:        MembershipPlans(),
+		QuoteAssetList:         AppConfig().System.QuoteAssetList,
+		HomeWelcomeMessage:     AppConfig().Appearance.HomeWelcomeMessage,
+		HomeShortcutGroups:     AppConfig().Appearance.HomeShortcutGroups,
+	}
+}
+
+// MembershipPlans falls back to a lifetime plan priced by accept_asset_list
+// when no membership_plans are configured.
+func MembershipPlans() []MembershipPlan {
+	if len(AppConfig().System.MembershipPlanList) > 0 {
+		return AppConfig().System.MembershipPlanList
 	}
+	return []MembershipPlan{{Name: "lifetime", Prices: AppConfig().System.AccpetPaymentAssetList}}
 }
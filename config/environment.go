@@ -0,0 +1,89 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const environmentPrefix = "SUPERGROUP_"
+
+// applyEnvironment overrides the fields named by their YAML keys, e.g.
+// SUPERGROUP_MIXIN_SESSION_KEY or SUPERGROUP_SYSTEM_OPERATOR_LIST, lists are
+// comma separated and fields of other types can't be overridden.
+func applyEnvironment(cfg *Config, environ []string) error {
+	values := make(map[string]string)
+	for _, kv := range environ {
+		i := strings.Index(kv, "=")
+		if i < 0 || !strings.HasPrefix(kv[:i], environmentPrefix) {
+			continue
+		}
+		values[kv[:i]] = kv[i+1:]
+	}
+	if len(values) == 0 {
+		return nil
+	}
+	return applyEnvironmentToStruct(reflect.ValueOf(cfg).Elem(), strings.TrimSuffix(environmentPrefix, "_"), values)
+}
+
+func applyEnvironmentToStruct(v reflect.Value, prefix string, values map[string]string) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		tag := strings.Split(t.Field(i).Tag.Get("yaml"), ",")[0]
+		if tag == "" || tag == "-" {
+			continue
+		}
+		name := prefix + "_" + strings.ToUpper(tag)
+		field := v.Field(i)
+		if field.Kind() == reflect.Struct {
+			err := applyEnvironmentToStruct(field, name, values)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		value, found := values[name]
+		if !found {
+			continue
+		}
+		err := setEnvironmentField(field, value)
+		if err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+func setEnvironmentField(field reflect.Value, value string) error {
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		field.SetInt(n)
+	case reflect.Slice:
+		if field.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported type %s", field.Type())
+		}
+		var list []string
+		for _, s := range strings.Split(value, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				list = append(list, s)
+			}
+		}
+		field.Set(reflect.ValueOf(list))
+	default:
+		return fmt.Errorf("unsupported type %s", field.Type())
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package config
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/gofrs/uuid/v5"
+)
+
+// Validate checks the fields the services can't start without, it returns
+// all the problems found instead of the first one.
+func (c *Config) Validate() []error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+	isUUID := func(s string) bool {
+		id, err := uuid.FromString(s)
+		return err == nil && id.String() == s
+	}
+
+	check(len(c.Service.APIRoot) > 0, "service.api_root is empty")
+	check(len(c.Service.BlazeRoot) > 0, "service.blaze_root is empty")
+	check(c.Service.HTTPListenPort > 0, "service.port is invalid: %d", c.Service.HTTPListenPort)
+	check(c.Database.User != "", "database.username is empty")
+	check(c.Database.Host != "", "database.host is empty")
+	check(c.Database.Name != "", "database.database_name is empty")
+
+	mixin := c.Mixin
+	check(isUUID(mixin.ClientId), "mixin.client_id is not a UUID: %q", mixin.ClientId)
+	check(isUUID(mixin.SessionId), "mixin.session_id is not a UUID: %q", mixin.SessionId)
+	check(mixin.ClientSecret != "", "mixin.client_secret is empty")
+	key, err := base64.RawURLEncoding.DecodeString(mixin.SessionKey)
+	check(err == nil && len(key) == 64, "mixin.session_key is not a base64 ed25519 private key")
+	pin, err := hex.DecodeString(mixin.SessionAssetPIN)
+	check(err == nil && len(pin) >= 32, "mixin.session_asset_pin is not a hex key of at least 64 characters")
+
+	for _, id := range c.System.OperatorList {
+		check(isUUID(id), "system.operator_list has an invalid UUID: %q", id)
+	}
+	for _, asset := range c.System.AccpetPaymentAssetList {
+		check(isUUID(asset.AssetId), "system.accept_asset_list has an invalid asset_id: %q", asset.AssetId)
+	}
+	for _, plan := range c.System.MembershipPlanList {
+		check(plan.Name != "", "system.membership_plans has a plan without name")
+		check(plan.Duration >= 0, "system.membership_plans %s has a negative duration", plan.Name)
+		check(len(plan.Prices) > 0 || plan.PriceUSD != "", "system.membership_plans %s has no prices", plan.Name)
+		for _, asset := range plan.Prices {
+			check(isUUID(asset.AssetId), "system.membership_plans %s has an invalid asset_id: %q", plan.Name, asset.AssetId)
+		}
+	}
+	for _, asset := range c.System.QuoteAssetList {
+		check(isUUID(asset.AssetId), "system.quote_asset_list has an invalid asset_id: %q", asset.AssetId)
+	}
+	return errs
+}
@@ -1,24 +1,132 @@
 package durable
 
 import (
+	"context"
+	"database/sql"
+	"sync"
 	"time"
-
-	"github.com/MixinNetwork/supergroup.mixin.one/config"
-	"golang.org/x/time/rate"
 )
 
-var limiters map[string]*rate.Limiter = make(map[string]*rate.Limiter, 0)
+// Bucket allows number tokens per period for the key.
+type Bucket struct {
+	Key    string
+	Period time.Duration
+	Number int
+}
+
+// LimiterStore keeps the token buckets, shared by all replicas when backed by
+// Postgres. Take consumes a token from every bucket only if none of them is
+// empty, otherwise it consumes nothing and returns how long to wait for the
+// first empty one.
+type LimiterStore interface {
+	Take(ctx context.Context, buckets []Bucket) (time.Duration, error)
+}
+
+var limiterStore LimiterStore = NewMemoryLimiterStore()
+
+func SetLimiterStore(store LimiterStore) {
+	limiterStore = store
+}
+
+// Take checks the buckets in the current store, zero period or number means no limit.
+func Take(ctx context.Context, buckets ...Bucket) (time.Duration, error) {
+	var limited []Bucket
+	for _, b := range buckets {
+		if b.Period > 0 && b.Number > 0 {
+			limited = append(limited, b)
+		}
+	}
+	if len(limited) == 0 {
+		return 0, nil
+	}
+	return limiterStore.Take(ctx, limited)
+}
+
+// The buckets are kept as the theoretical arrival time of the next token (GCRA),
+// a bucket whose arrival time is in the past is full and can be dropped.
+func arrival(tat, now time.Time, period time.Duration, number int) (time.Time, time.Duration) {
+	interval := period / time.Duration(number)
+	if tat.Before(now) {
+		tat = now
+	}
+	if wait := tat.Sub(now) - (period - interval); wait > 0 {
+		return time.Time{}, wait
+	}
+	return tat.Add(interval), 0
+}
+
+type MemoryLimiterStore struct {
+	sync.Mutex
+	buckets map[string]time.Time
+	evictAt time.Time
+}
+
+func NewMemoryLimiterStore() *MemoryLimiterStore {
+	return &MemoryLimiterStore{buckets: make(map[string]time.Time)}
+}
+
+func (s *MemoryLimiterStore) Take(ctx context.Context, buckets []Bucket) (time.Duration, error) {
+	s.Lock()
+	defer s.Unlock()
 
-func Allow(key string) bool {
-	if config.AppConfig.Service.Environment == "test" {
-		return true
+	now := time.Now()
+	if now.After(s.evictAt) {
+		for k, tat := range s.buckets {
+			if tat.Before(now) {
+				delete(s.buckets, k)
+			}
+		}
+		s.evictAt = now.Add(time.Minute)
 	}
-	system := config.AppConfig.System
-	if system.LimitMessageDuration <= 0 || system.LimitMessageNumber <= 0 {
-		return true
+	tats := make([]time.Time, len(buckets))
+	for i, b := range buckets {
+		tat, wait := arrival(s.buckets[b.Key], now, b.Period, b.Number)
+		if wait > 0 {
+			return wait, nil
+		}
+		tats[i] = tat
 	}
-	if limiters[key] == nil {
-		limiters[key] = rate.NewLimiter(rate.Every(time.Duration(system.LimitMessageDuration)*time.Second), system.LimitMessageNumber)
+	for i, b := range buckets {
+		s.buckets[b.Key] = tats[i]
 	}
-	return limiters[key].Allow()
+	return 0, nil
+}
+
+type PostgresLimiterStore struct {
+	db *Database
+}
+
+func NewPostgresLimiterStore(db *Database) *PostgresLimiterStore {
+	return &PostgresLimiterStore{db: db}
+}
+
+func (s *PostgresLimiterStore) Take(ctx context.Context, buckets []Bucket) (time.Duration, error) {
+	var wait time.Duration
+	err := s.db.RunInTransaction(ctx, nil, func(ctx context.Context, tx *sql.Tx) error {
+		now := time.Now()
+		tats := make([]time.Time, len(buckets))
+		for i, b := range buckets {
+			_, err := tx.ExecContext(ctx, "INSERT INTO rate_limits (key, tat) VALUES ($1, $2) ON CONFLICT (key) DO NOTHING", b.Key, time.Time{})
+			if err != nil {
+				return err
+			}
+			var tat time.Time
+			err = tx.QueryRowContext(ctx, "SELECT tat FROM rate_limits WHERE key=$1 FOR UPDATE", b.Key).Scan(&tat)
+			if err != nil {
+				return err
+			}
+			tats[i], wait = arrival(tat, now, b.Period, b.Number)
+			if wait > 0 {
+				return nil
+			}
+		}
+		for i, b := range buckets {
+			_, err := tx.ExecContext(ctx, "UPDATE rate_limits SET tat=$1 WHERE key=$2", tats[i], b.Key)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return wait, err
 }
@@ -12,6 +12,10 @@ func AssetShow(ctx context.Context, assetId, authorizationID, private, scope str
 	return bot.ReadAsset(ctx, assetId)
 }
 
+func ReadNetworkAsset(ctx context.Context, assetId string) (*bot.Asset, error) {
+	return bot.ReadAsset(ctx, assetId)
+}
+
 func parseError(ctx context.Context, err bot.Error) error {
 	if err.Code > 0 {
 		switch err.Code {
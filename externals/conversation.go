@@ -8,10 +8,10 @@ import (
 )
 
 func CreateConversation(ctx context.Context, category, participantId string) error {
-	if config.AppConfig.Service.Environment == "test" {
+	if config.AppConfig().Service.Environment == "test" {
 		return nil
 	}
-	conversationId := bot.UniqueConversationId(config.AppConfig.Mixin.ClientId, participantId)
+	conversationId := bot.UniqueConversationId(config.AppConfig().Mixin.ClientId, participantId)
 	participant := bot.Participant{
 		UserId: participantId,
 		Role:   "",
@@ -19,7 +19,7 @@ func CreateConversation(ctx context.Context, category, participantId string) err
 	participants := []bot.Participant{
 		participant,
 	}
-	mixin := config.AppConfig.Mixin
+	mixin := config.AppConfig().Mixin
 	_, err := bot.CreateConversation(ctx, category, conversationId, "", "", participants, mixin.ClientId, mixin.SessionId, mixin.SessionKey)
 	if err != nil {
 		return parseError(ctx, err.(bot.Error))
@@ -28,7 +28,7 @@ func CreateConversation(ctx context.Context, category, participantId string) err
 }
 
 func ReadConversation(ctx context.Context, conversationID string) (*bot.Conversation, error) {
-	mixin := config.AppConfig.Mixin
+	mixin := config.AppConfig().Mixin
 	token, err := bot.SignAuthenticationToken(mixin.ClientId, mixin.SessionId, mixin.SessionKey, "GET", "/conversations/"+conversationID, "")
 	if err != nil {
 		return nil, err
@@ -10,7 +10,7 @@ import (
 )
 
 func UserMeFromCode(ctx context.Context, code, private, public string) (*bot.User, string, string, error) {
-	mixin := config.AppConfig.Mixin
+	mixin := config.AppConfig().Mixin
 	_, scope, authorizationID, err := bot.OAuthGetAccessToken(ctx, mixin.ClientId, mixin.ClientSecret, code, "", public)
 	if err != nil {
 		return nil, "", "", parseError(ctx, err.(bot.Error))
@@ -35,7 +35,7 @@ func UserMe(ctx context.Context, authorizationID, private, scope string) (*bot.U
 	if authorizationID == "" {
 		return bot.UserMe(ctx, private)
 	}
-	mixin := config.AppConfig.Mixin
+	mixin := config.AppConfig().Mixin
 	requestID := bot.UuidNewV4().String()
 	token, err := bot.SignOauthAccessToken(mixin.ClientId, authorizationID, private, "GET", "/safe/me", "", scope, requestID)
 	if err != nil {
@@ -47,3 +47,27 @@ func UserMe(ctx context.Context, authorizationID, private, scope string) (*bot.U
 	}
 	return me, nil
 }
+
+// SearchUser finds the Mixin user by id or identity number, it returns nil if
+// not found.
+func SearchUser(ctx context.Context, mixinId string) (*bot.User, error) {
+	if config.AppConfig().Service.Environment == "test" {
+		if _, err := bot.UuidFromString(mixinId); err != nil {
+			return nil, nil
+		}
+		return &bot.User{UserId: mixinId}, nil
+	}
+	mixin := config.AppConfig().Mixin
+	user, err := bot.SearchUser(ctx, mixinId, mixin.ClientId, mixin.SessionId, mixin.SessionKey)
+	switch e := err.(type) {
+	case nil:
+		return user, nil
+	case bot.Error:
+		if e.Code == 404 {
+			return nil, nil
+		} else if e.Code > 0 {
+			return nil, parseError(ctx, e)
+		}
+	}
+	return nil, session.ServerError(ctx, err)
+}
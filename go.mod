@@ -17,9 +17,9 @@ require (
 	github.com/tuotoo/qrcode v0.0.0-20220425170535-52ccc2bebf5d
 	github.com/unrolled/render v1.7.0
 	golang.org/x/crypto v0.49.0
-	golang.org/x/time v0.15.0
 	gopkg.in/yaml.v2 v2.4.0
 	mvdan.cc/xurls v1.1.0
+	rsc.io/qr v0.2.0
 )
 
 require (
@@ -43,5 +43,4 @@ require (
 	golang.org/x/sys v0.42.0 // indirect
 	gopkg.in/check.v1 v1.0.0-20201130134442-10cb98267c6c // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
-	rsc.io/qr v0.2.0 // indirect
 )
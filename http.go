@@ -16,7 +16,7 @@ import (
 )
 
 func StartServer(database *durable.Database) error {
-	mixin := config.AppConfig.Mixin
+	mixin := config.AppConfig().Mixin
 	_, err := bot.UpdatePreference(context.Background(), mixin.ClientId, mixin.SessionId, mixin.SessionKey, "", "CONTACTS", "", 0)
 	if err != nil {
 		return err
@@ -32,5 +32,5 @@ func StartServer(database *durable.Database) error {
 	handler = middlewares.Log(handler, logger, "http")
 	handler = handlers.ProxyHeaders(handler)
 
-	return http.ListenAndServe(fmt.Sprintf(":%d", config.AppConfig.Service.HTTPListenPort), handler)
+	return http.ListenAndServe(fmt.Sprintf(":%d", config.AppConfig().Service.HTTPListenPort), handler)
 }
@@ -8,24 +8,47 @@ import (
 	"log"
 	"net/http"
 	_ "net/http/pprof"
+	"os"
+	"strconv"
 	"time"
 
 	"github.com/MixinNetwork/supergroup.mixin.one/config"
 	"github.com/MixinNetwork/supergroup.mixin.one/durable"
+	"github.com/MixinNetwork/supergroup.mixin.one/models"
 	"github.com/MixinNetwork/supergroup.mixin.one/services"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
 )
 
 func main() {
 	service := flag.String("service", "http", "run a service")
 	env := flag.String("e", "production", "")
+	path := flag.String("config", "", "load the config from the YAML file instead of the embedded one")
+	operator := flag.String("operator", "", "the user id the CLI commands act as, the first operator by default")
 	flag.Parse()
 
-	config.Init(*env)
-	if *env != config.AppConfig.Service.Environment {
-		log.Panicln("Invalid Environment", *env, config.AppConfig.Service.Environment)
+	err := config.Load(*path, *env)
+	if err != nil {
+		log.Panicln(err)
+	}
+	if *env != config.AppConfig().Service.Environment {
+		log.Panicln("Invalid Environment", *env, config.AppConfig().Service.Environment)
+	}
+	if *operator == "" && len(config.AppConfig().System.OperatorList) > 0 {
+		*operator = config.AppConfig().System.OperatorList[0]
+	}
+	if *service == "check-config" {
+		errs := config.AppConfig().Validate()
+		for _, err := range errs {
+			log.Println(err)
+		}
+		if len(errs) > 0 {
+			os.Exit(1)
+		}
+		log.Println("config is valid")
+		return
 	}
 
-	dbinfo := config.AppConfig.Database
+	dbinfo := config.AppConfig().Database
 	connStr := fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=disable",
 		dbinfo.User,
 		dbinfo.Password,
@@ -45,24 +68,94 @@ func main() {
 	if err != nil {
 		log.Panicln(err)
 	}
+	if config.AppConfig().System.RateLimitStore == "postgres" {
+		durable.SetLimiterStore(durable.NewPostgresLimiterStore(database))
+	}
+	ctx := session.WithDatabase(context.Background(), database)
+	if *service == "migrate" {
+		err = migrate(ctx, flag.Arg(0), flag.Arg(1))
+		if err != nil {
+			log.Panicln(err)
+		}
+		return
+	}
+	err = models.CheckSchema(ctx)
+	if err != nil {
+		log.Panicln(err)
+	}
+	err = models.SeedRoles(ctx)
+	if err != nil {
+		log.Panicln(err)
+	}
+	err = models.LoadSettings(ctx)
+	if err != nil {
+		log.Panicln(err)
+	}
 
 	switch *service {
 	case "http":
 		services.NewServiceAll().Run(database)
-		log.Println("Http Server Listened Port:", config.AppConfig.Service.HTTPListenPort)
+		log.Println("Http Server Listened Port:", config.AppConfig().Service.HTTPListenPort)
 		err := StartServer(database)
 		if err != nil {
 			log.Println(err)
 		}
 	default:
+		hub := services.NewHub(database)
+		if hub.HasCommand(*service) {
+			err := hub.RunCommand(*service, *operator, flag.Args())
+			if err != nil {
+				log.Panicln(err)
+			}
+			return
+		}
 		log.Printf("Mixin Group Service %s Started.\n", *service)
 		go func() {
-			hub := services.NewHub(database)
 			err := hub.StartService(*service)
 			if err != nil {
 				log.Println(err)
 			}
 		}()
-		http.ListenAndServe(fmt.Sprintf(":%d", config.AppConfig.Service.HTTPListenPort+2000), http.DefaultServeMux)
+		http.ListenAndServe(fmt.Sprintf(":%d", config.AppConfig().Service.HTTPListenPort+2000), http.DefaultServeMux)
+	}
+}
+
+// migrate runs -service migrate up|down [steps]|status
+func migrate(ctx context.Context, action, steps string) error {
+	switch action {
+	case "up":
+		migrations, err := models.MigrateUp(ctx)
+		for _, m := range migrations {
+			log.Printf("migrated up %04d_%s\n", m.Version, m.Name)
+		}
+		return err
+	case "down":
+		n := 1
+		if steps != "" {
+			var err error
+			n, err = strconv.Atoi(steps)
+			if err != nil || n < 1 {
+				return fmt.Errorf("invalid steps %s", steps)
+			}
+		}
+		migrations, err := models.MigrateDown(ctx, n)
+		for _, m := range migrations {
+			log.Printf("migrated down %04d_%s\n", m.Version, m.Name)
+		}
+		return err
+	case "status", "":
+		migrations, err := models.MigrationStatus(ctx)
+		if err != nil {
+			return err
+		}
+		for _, m := range migrations {
+			state := "pending"
+			if m.AppliedAt != nil {
+				state = m.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%04d_%s\t%s\n", m.Version, m.Name, state)
+		}
+		return nil
 	}
+	return fmt.Errorf("unknown migrate action %s, use up, down or status", action)
 }
@@ -18,6 +18,7 @@ var whitelist = [][2]string{
 	{"GET", "^/config$"},
 	{"GET", "^/amount$"},
 	{"POST", "^/auth$"},
+	{"GET", "^/invitations/[0-9a-z]+/poster$"},
 }
 
 type contextValueKey struct{ int }
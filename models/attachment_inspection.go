@@ -0,0 +1,229 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	bot "github.com/MixinNetwork/bot-api-go-client/v2"
+	"github.com/MixinNetwork/supergroup.mixin.one/config"
+	"github.com/MixinNetwork/supergroup.mixin.one/durable"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+	"github.com/MixinNetwork/supergroup.mixin.one/utils"
+)
+
+const (
+	AttachmentInspectionStatePending = "pending"
+	AttachmentInspectionStatePassed  = "passed"
+	AttachmentInspectionStateBlocked = "blocked"
+
+	AttachmentInspectionExpiration = 72 * time.Hour
+	AttachmentInspectionRetry      = 30 * time.Second
+	AttachmentInspectionTimeout    = 10 * time.Minute
+)
+
+var (
+	errAttachmentUnavailable = errors.New("attachment unavailable")
+	errAttachmentTooLarge    = errors.New("attachment too large")
+)
+
+// AttachmentFetcher downloads the attachment content, at most limit bytes.
+type AttachmentFetcher interface {
+	Fetch(ctx context.Context, attachmentId string, limit int64) ([]byte, error)
+}
+
+var attachmentFetcher AttachmentFetcher = &mixinAttachmentFetcher{}
+
+func SetAttachmentFetcher(fetcher AttachmentFetcher) {
+	attachmentFetcher = fetcher
+}
+
+type AttachmentInspection struct {
+	AttachmentId string
+	State        string
+	Reason       string
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+var attachmentInspectionsCols = []string{"attachment_id", "state", "reason", "created_at", "updated_at"}
+
+func (i *AttachmentInspection) values() []interface{} {
+	return []interface{}{i.AttachmentId, i.State, i.Reason, i.CreatedAt, i.UpdatedAt}
+}
+
+func attachmentInspectionFromRow(row durable.Row) (*AttachmentInspection, error) {
+	var i AttachmentInspection
+	err := row.Scan(&i.AttachmentId, &i.State, &i.Reason, &i.CreatedAt, &i.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return &i, err
+}
+
+// inspectMessageAttachment returns the cached inspection of the message attachment,
+// or queues a new one and moves the message to the inspecting state. A message
+// still waiting is moved to the end of the inspecting ones, so it doesn't hold
+// back the messages behind it.
+func inspectMessageAttachment(ctx context.Context, message *Message) (*AttachmentInspection, error) {
+	a, err := readAttachment(ctx, message.Data)
+	if err != nil {
+		return &AttachmentInspection{State: AttachmentInspectionStateBlocked, Reason: err.Error()}, nil
+	}
+	t := time.Now()
+	inspection := &AttachmentInspection{
+		AttachmentId: a.AttachmentId,
+		State:        AttachmentInspectionStatePending,
+		CreatedAt:    t,
+		UpdatedAt:    t,
+	}
+	err = session.Database(ctx).RunInTransaction(ctx, nil, func(ctx context.Context, tx *sql.Tx) error {
+		query := durable.PrepareQuery("INSERT INTO attachment_inspections (%s) VALUES (%s) ON CONFLICT (attachment_id) DO NOTHING", attachmentInspectionsCols)
+		_, err := tx.ExecContext(ctx, query, inspection.values()...)
+		if err != nil {
+			return err
+		}
+		query = fmt.Sprintf("SELECT %s FROM attachment_inspections WHERE attachment_id=$1", strings.Join(attachmentInspectionsCols, ","))
+		inspection, err = attachmentInspectionFromRow(tx.QueryRowContext(ctx, query, a.AttachmentId))
+		if err != nil || inspection.State != AttachmentInspectionStatePending {
+			return err
+		}
+		message.State = MessageStateInspecting
+		_, err = tx.ExecContext(ctx, "UPDATE messages SET (state,updated_at)=($1,$2) WHERE message_id=$3", message.State, time.Now(), message.MessageId)
+		return err
+	})
+	if err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	if inspection.State == AttachmentInspectionStatePending {
+		return nil, nil
+	}
+	return inspection, nil
+}
+
+// PendingAttachmentInspections returns the new inspections and the failed ones
+// waiting for retry longer than AttachmentInspectionRetry.
+func PendingAttachmentInspections(ctx context.Context, limit int64) ([]*AttachmentInspection, error) {
+	query := fmt.Sprintf("SELECT %s FROM attachment_inspections WHERE state=$1 AND (updated_at=created_at OR updated_at<$2) ORDER BY state,created_at LIMIT $3", strings.Join(attachmentInspectionsCols, ","))
+	rows, err := session.Database(ctx).QueryContext(ctx, query, AttachmentInspectionStatePending, time.Now().Add(-AttachmentInspectionRetry), limit)
+	if err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	defer rows.Close()
+
+	var inspections []*AttachmentInspection
+	for rows.Next() {
+		i, err := attachmentInspectionFromRow(rows)
+		if err != nil {
+			return nil, session.TransactionError(ctx, err)
+		}
+		inspections = append(inspections, i)
+	}
+	return inspections, nil
+}
+
+// Inspect downloads the attachment and checks it against the QR code
+// detector and the image blocklist. An attachment larger than the limit is
+// blocked, a failed download stays pending for retry until the timeout.
+func (i *AttachmentInspection) Inspect(ctx context.Context) error {
+	i.State, i.Reason = AttachmentInspectionStatePassed, ""
+	data, err := attachmentFetcher.Fetch(ctx, i.AttachmentId, config.AppConfig().System.AttachmentMaxSize)
+	if errors.Is(err, errAttachmentUnavailable) {
+		i.State, i.Reason = AttachmentInspectionStateBlocked, fmt.Sprintf("bot.AttachemntShow error: %+v, id: %s", err, i.AttachmentId)
+	} else if errors.Is(err, errAttachmentTooLarge) {
+		i.State, i.Reason = AttachmentInspectionStateBlocked, err.Error()
+	} else if err != nil {
+		session.Logger(ctx).Errorf("AttachmentFetcher.Fetch ERROR: %+v", err)
+		i.State = AttachmentInspectionStatePending
+		if i.CreatedAt.Before(time.Now().Add(-AttachmentInspectionTimeout)) {
+			i.State, i.Reason = AttachmentInspectionStateBlocked, fmt.Sprintf("AttachmentFetcher.Fetch error: %+v, id: %s", err, i.AttachmentId)
+		}
+	} else if passed, reason := inspectAttachmentData(ctx, data); !passed {
+		i.State, i.Reason = AttachmentInspectionStateBlocked, reason
+	}
+
+	i.UpdatedAt = time.Now()
+	_, err = session.Database(ctx).ExecContext(ctx, "UPDATE attachment_inspections SET (state, reason, updated_at)=($1, $2, $3) WHERE attachment_id=$4", i.State, i.Reason, i.UpdatedAt, i.AttachmentId)
+	if err != nil {
+		return session.TransactionError(ctx, err)
+	}
+	return nil
+}
+
+func inspectAttachmentData(ctx context.Context, data []byte) (bool, string) {
+	system := config.AppConfig().System
+	if system.DetectQRCodeEnabled {
+		if b, err := utils.CheckQRCode(ctx, data); b {
+			if err != nil {
+				return true, ""
+			}
+			return false, "Image contains QR Code"
+		}
+	}
+	if system.DetectImageHashEnabled {
+		hash, err := utils.DifferenceHash(data)
+		if err != nil {
+			session.Logger(ctx).Errorf("DifferenceHash ERROR: %+v", err)
+			return true, ""
+		}
+		blocked, err := matchImageBlocklist(ctx, hash)
+		if err != nil {
+			session.Logger(ctx).Errorf("matchImageBlocklist ERROR: %+v", err)
+			return true, ""
+		}
+		if blocked {
+			return false, "Image matches blocklist"
+		}
+	}
+	return true, ""
+}
+
+func LoopClearUpExpiredAttachmentInspections(ctx context.Context) (int64, error) {
+	query := "DELETE FROM attachment_inspections WHERE attachment_id IN (SELECT attachment_id FROM attachment_inspections WHERE state<>$1 AND updated_at<$2 LIMIT 100)"
+	r, err := session.Database(ctx).ExecContext(ctx, query, AttachmentInspectionStatePending, time.Now().Add(-AttachmentInspectionExpiration))
+	if err != nil {
+		return 0, session.TransactionError(ctx, err)
+	}
+	return r.RowsAffected()
+}
+
+type mixinAttachmentFetcher struct{}
+
+func (f *mixinAttachmentFetcher) Fetch(ctx context.Context, attachmentId string, limit int64) ([]byte, error) {
+	mixin := config.AppConfig().Mixin
+	attachment, err := bot.AttachmentShow(ctx, mixin.ClientId, mixin.SessionId, mixin.SessionKey, attachmentId)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errAttachmentUnavailable, err)
+	}
+	url := strings.Replace(attachment.ViewURL, "assets.zeromesh.net", "s3.cn-north-1.amazonaws.com.cn", 0)
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if !(resp.StatusCode >= 200 && resp.StatusCode < 300) {
+		return nil, fmt.Errorf("download attachment status %d", resp.StatusCode)
+	}
+	if limit <= 0 {
+		return io.ReadAll(resp.Body)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("%w: %s larger than %d bytes", errAttachmentTooLarge, attachmentId, limit)
+	}
+	return data, nil
+}
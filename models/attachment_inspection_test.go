@@ -0,0 +1,131 @@
+package models
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"testing"
+	"time"
+
+	bot "github.com/MixinNetwork/bot-api-go-client/v2"
+	"github.com/MixinNetwork/supergroup.mixin.one/config"
+	"github.com/MixinNetwork/supergroup.mixin.one/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+type fixtureAttachmentFetcher map[string][]byte
+
+func (f fixtureAttachmentFetcher) Fetch(ctx context.Context, attachmentId string, limit int64) ([]byte, error) {
+	data, found := f[attachmentId]
+	if !found {
+		return nil, errAttachmentUnavailable
+	}
+	if data == nil {
+		return nil, fmt.Errorf("download attachment status %d", 500)
+	}
+	if limit > 0 && int64(len(data)) > limit {
+		return nil, errAttachmentTooLarge
+	}
+	return data, nil
+}
+
+func TestAttachmentInspectionCRUD(t *testing.T) {
+	assert := assert.New(t)
+	ctx := setupTestContext()
+	defer teardownTestContext(ctx)
+
+	blocked, passed := bot.UuidNewV4().String(), bot.UuidNewV4().String()
+	large, broken := bot.UuidNewV4().String(), bot.UuidNewV4().String()
+	SetAttachmentFetcher(fixtureAttachmentFetcher{
+		blocked: testImage(t, 120, 80, false),
+		passed:  testImage(t, 120, 80, true),
+		large:   make([]byte, 2*1024*1024),
+		broken:  nil,
+	})
+	defer SetAttachmentFetcher(&mixinAttachmentFetcher{})
+
+	system := &config.AppConfig().System
+	system.DetectImageHashEnabled = true
+	system.ImageHashDistance = 6
+	system.AttachmentMaxSize = 1024 * 1024
+	defer func() {
+		system.DetectImageHashEnabled = false
+		system.ImageHashDistance = 0
+		system.AttachmentMaxSize = 0
+	}()
+	hash, err := utils.DifferenceHash(testImage(t, 240, 160, false))
+	assert.Nil(err)
+	_, err = createImageBlock(ctx, hash, bot.UuidNewV4().String(), bot.UuidNewV4().String())
+	assert.Nil(err)
+
+	user := &User{UserId: bot.UuidNewV4().String(), ActiveAt: time.Now()}
+	for _, id := range []string{blocked, passed} {
+		data := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"attachment_id":"%s","size":1024}`, id)))
+		message, err := CreateMessage(ctx, user, bot.UuidNewV4().String(), MessageCategoryPlainImage, "", data, false, time.Now(), time.Now())
+		assert.Nil(err)
+		inspection, err := inspectMessageAttachment(ctx, message)
+		assert.Nil(err)
+		assert.Nil(inspection)
+	}
+	messages, err := InspectingMessages(ctx, 10)
+	assert.Nil(err)
+	assert.Len(messages, 2)
+	inspection, err := inspectMessageAttachment(ctx, messages[0])
+	assert.Nil(err)
+	assert.Nil(inspection)
+	waiting, err := InspectingMessages(ctx, 1)
+	assert.Nil(err)
+	assert.Len(waiting, 1)
+	assert.Equal(messages[1].MessageId, waiting[0].MessageId)
+
+	inspections, err := PendingAttachmentInspections(ctx, 10)
+	assert.Nil(err)
+	assert.Len(inspections, 2)
+	for _, inspection := range inspections {
+		assert.Nil(inspection.Inspect(ctx))
+	}
+	inspections, err = PendingAttachmentInspections(ctx, 10)
+	assert.Nil(err)
+	assert.Len(inspections, 0)
+
+	for _, message := range messages {
+		inspection, err := inspectMessageAttachment(ctx, message)
+		assert.Nil(err)
+		assert.NotNil(inspection)
+		a, _ := readAttachment(ctx, message.Data)
+		if a.AttachmentId == blocked {
+			assert.Equal(AttachmentInspectionStateBlocked, inspection.State)
+			assert.Equal("Image matches blocklist", inspection.Reason)
+		} else {
+			assert.Equal(AttachmentInspectionStatePassed, inspection.State)
+		}
+	}
+
+	for _, id := range []string{large, broken} {
+		data := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"attachment_id":"%s","size":1024}`, id)))
+		inspection, err := inspectMessageAttachment(ctx, &Message{MessageId: bot.UuidNewV4().String(), Data: data})
+		assert.Nil(err)
+		assert.Nil(inspection)
+	}
+	inspections, err = PendingAttachmentInspections(ctx, 10)
+	assert.Nil(err)
+	assert.Len(inspections, 2)
+	for _, inspection := range inspections {
+		assert.Nil(inspection.Inspect(ctx))
+		if inspection.AttachmentId == large {
+			assert.Equal(AttachmentInspectionStateBlocked, inspection.State)
+		} else {
+			assert.Equal(AttachmentInspectionStatePending, inspection.State)
+		}
+	}
+	inspections, err = PendingAttachmentInspections(ctx, 10)
+	assert.Nil(err)
+	assert.Len(inspections, 0)
+	inspection = &AttachmentInspection{AttachmentId: broken, CreatedAt: time.Now().Add(-AttachmentInspectionTimeout - time.Minute)}
+	assert.Nil(inspection.Inspect(ctx))
+	assert.Equal(AttachmentInspectionStateBlocked, inspection.State)
+
+	count, err := LoopClearUpExpiredAttachmentInspections(ctx)
+	assert.Nil(err)
+	assert.Equal(int64(0), count)
+}
@@ -0,0 +1,123 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	bot "github.com/MixinNetwork/bot-api-go-client/v2"
+	"github.com/MixinNetwork/supergroup.mixin.one/durable"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+)
+
+const (
+	AuditActionBan            = "ban"
+	AuditActionUnban          = "unban"
+	AuditActionKick           = "kick"
+	AuditActionMute           = "mute"
+	AuditActionWarn           = "warn"
+	AuditActionRecall         = "recall"
+	AuditActionPromote        = "promote"
+	AuditActionBlockImage     = "block_image"
+	AuditActionSetProperty    = "set_property"
+	AuditActionSetSetting     = "set_setting"
+	AuditActionAddBroadcaster = "add_broadcaster"
+	AuditActionGrantRole      = "grant_role"
+	AuditActionRevokeRole     = "revoke_role"
+	AuditActionGrantMember    = "grant_membership"
+	AuditActionBroadcast      = "broadcast"
+	AuditActionExportMembers  = "export_members"
+	AuditActionReplayMessages = "replay_messages"
+	AuditActionInvite         = "invite"
+)
+
+type AuditEvent struct {
+	AuditEventId string
+	ActorId      string
+	Action       string
+	TargetId     string
+	Reason       string
+	Before       string
+	After        string
+	CreatedAt    time.Time
+}
+
+var auditEventsCols = []string{"audit_event_id", "actor_id", "action", "target_id", "reason", "before", "after", "created_at"}
+
+func (e *AuditEvent) values() []interface{} {
+	return []interface{}{e.AuditEventId, e.ActorId, e.Action, e.TargetId, e.Reason, e.Before, e.After, e.CreatedAt}
+}
+
+func auditEventFromRow(row durable.Row) (*AuditEvent, error) {
+	var e AuditEvent
+	err := row.Scan(&e.AuditEventId, &e.ActorId, &e.Action, &e.TargetId, &e.Reason, &e.Before, &e.After, &e.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return &e, err
+}
+
+// createAuditEventInTx appends the event in the transaction of the action itself,
+// before and after are stored as JSON, nil means the state didn't exist.
+func createAuditEventInTx(ctx context.Context, tx *sql.Tx, actorId, action, targetId, reason string, before, after interface{}) error {
+	e := &AuditEvent{
+		AuditEventId: bot.UuidNewV4().String(),
+		ActorId:      actorId,
+		Action:       action,
+		TargetId:     targetId,
+		Reason:       reason,
+		CreatedAt:    time.Now(),
+	}
+	for _, s := range []struct {
+		src interface{}
+		dst *string
+	}{{before, &e.Before}, {after, &e.After}} {
+		data, err := json.Marshal(s.src)
+		if err != nil {
+			return err
+		}
+		*s.dst = string(data)
+	}
+	query := durable.PrepareQuery("INSERT INTO audit_events (%s) VALUES (%s)", auditEventsCols)
+	_, err := tx.ExecContext(ctx, query, e.values()...)
+	return err
+}
+
+// AuditEvents lists the events before the offset, newest first, empty filters match all.
+func (current *User) AuditEvents(ctx context.Context, actorId, action string, since, offset time.Time, limit int64) ([]*AuditEvent, error) {
+	if !current.Can(ctx, PermissionManageRoles) {
+		return nil, session.ForbiddenError(ctx)
+	}
+	if offset.IsZero() {
+		offset = time.Now()
+	}
+	query := fmt.Sprintf("SELECT %s FROM audit_events WHERE created_at<$1 AND created_at>$2", strings.Join(auditEventsCols, ","))
+	args := []interface{}{offset, since}
+	if actorId != "" {
+		args = append(args, actorId)
+		query += fmt.Sprintf(" AND actor_id=$%d", len(args))
+	}
+	if action != "" {
+		args = append(args, action)
+		query += fmt.Sprintf(" AND action=$%d", len(args))
+	}
+	query += fmt.Sprintf(" ORDER BY created_at DESC LIMIT %d", limit)
+	rows, err := session.Database(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	defer rows.Close()
+
+	var events []*AuditEvent
+	for rows.Next() {
+		e, err := auditEventFromRow(rows)
+		if err != nil {
+			return nil, session.TransactionError(ctx, err)
+		}
+		events = append(events, e)
+	}
+	return events, nil
+}
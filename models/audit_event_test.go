@@ -0,0 +1,60 @@
+package models
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	bot "github.com/MixinNetwork/bot-api-go-client/v2"
+	"github.com/MixinNetwork/supergroup.mixin.one/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuditEventCRUD(t *testing.T) {
+	assert := assert.New(t)
+	ctx := setupTestContext()
+	defer teardownTestContext(ctx)
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(err)
+	public := base64.RawURLEncoding.EncodeToString(pub)
+	private := base64.RawURLEncoding.EncodeToString(priv)
+	user, err := createUser(ctx, public, private, bot.UuidNewV4().String(), "", bot.UuidNewV4().String(), "1000", "name", "http://localhost")
+	assert.Nil(err)
+	assert.NotNil(user)
+
+	start := time.Now()
+	admin := &User{UserId: config.AppConfig().System.OperatorList[0]}
+	_, err = admin.CreateProperty(ctx, ProhibitedMessage, true)
+	assert.Nil(err)
+	_, err = admin.CreateMute(ctx, user.UserId, time.Hour)
+	assert.Nil(err)
+	err = admin.DeleteUser(ctx, user.UserId)
+	assert.Nil(err)
+
+	events, err := user.AuditEvents(ctx, "", "", time.Time{}, time.Time{}, 100)
+	assert.NotNil(err)
+	assert.Nil(events)
+	events, err = admin.AuditEvents(ctx, "", "", time.Time{}, time.Time{}, 100)
+	assert.Nil(err)
+	assert.Len(events, 3)
+	assert.Equal(AuditActionKick, events[0].Action)
+	assert.Equal(user.UserId, events[0].TargetId)
+	assert.Equal("null", events[0].After)
+	assert.Equal(AuditActionSetProperty, events[2].Action)
+	assert.Equal("false", events[2].Before)
+	assert.Equal("true", events[2].After)
+
+	events, err = admin.AuditEvents(ctx, admin.UserId, AuditActionMute, start, time.Time{}, 100)
+	assert.Nil(err)
+	assert.Len(events, 1)
+	assert.Equal("1h0m0s", events[0].Reason)
+	events, err = admin.AuditEvents(ctx, user.UserId, "", time.Time{}, time.Time{}, 100)
+	assert.Nil(err)
+	assert.Len(events, 0)
+	events, err = admin.AuditEvents(ctx, "", "", time.Time{}, start, 100)
+	assert.Nil(err)
+	assert.Len(events, 0)
+}
@@ -5,49 +5,124 @@ import (
 	"database/sql"
 	"encoding/base64"
 	"fmt"
+	"strings"
+	"time"
 
-	"github.com/MixinNetwork/supergroup.mixin.one/config"
+	"github.com/MixinNetwork/supergroup.mixin.one/durable"
 	"github.com/MixinNetwork/supergroup.mixin.one/session"
 	"github.com/gofrs/uuid/v5"
 	"github.com/lib/pq"
 )
 
 type Blacklist struct {
-	UserId string
+	UserId         string
+	IdentityNumber int64
+	FullName       string
+	OperatorId     string
+	Reason         string
+	MessageId      string
+	ExpiredAt      pq.NullTime
+	CreatedAt      time.Time
 }
 
-func (user *User) CreateBlacklist(ctx context.Context, userId string) (*Blacklist, error) {
-	if id := uuid.FromStringOrNil(userId); id.String() != userId {
+var blacklistsCols = []string{"user_id", "identity_number", "full_name", "operator_id", "reason", "message_id", "expired_at", "created_at"}
+
+func (b *Blacklist) values() []interface{} {
+	return []interface{}{b.UserId, b.IdentityNumber, b.FullName, b.OperatorId, b.Reason, b.MessageId, b.ExpiredAt, b.CreatedAt}
+}
+
+func blacklistFromRow(row durable.Row) (*Blacklist, error) {
+	var b Blacklist
+	err := row.Scan(&b.UserId, &b.IdentityNumber, &b.FullName, &b.OperatorId, &b.Reason, &b.MessageId, &b.ExpiredAt, &b.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return &b, err
+}
+
+// CreateBlacklist removes the user and bans them, a zero duration bans forever.
+func (user *User) CreateBlacklist(ctx context.Context, userId, reason, messageId string, duration time.Duration) (*Blacklist, error) {
+	if id := uuid.FromStringOrNil(userId); id.String() != userId || duration < 0 {
 		return nil, session.BadDataError(ctx)
 	}
-	operators := config.AppConfig.System.Operators
-	if !operators[user.UserId] || operators[userId] {
+	if !user.Can(ctx, PermissionBan) {
 		return nil, nil
 	}
+	return createBlacklist(ctx, user.UserId, user, userId, reason, messageId, duration)
+}
 
-	b := &Blacklist{UserId: userId}
+// createBlacklist bans the user without checking any permission, the operator
+// is recorded as who banned them and the notice goes to the notified user if
+// not nil. The automatic bans pass the bot itself as the operator.
+func createBlacklist(ctx context.Context, operatorId string, notified *User, userId, reason, messageId string, duration time.Duration) (*Blacklist, error) {
+	if isProtected(ctx, userId) {
+		return nil, nil
+	}
+
+	b := &Blacklist{
+		UserId:     userId,
+		OperatorId: operatorId,
+		Reason:     FirstNStringInRune(reason, 256),
+		MessageId:  messageId,
+		CreatedAt:  time.Now(),
+	}
+	if duration > 0 {
+		b.ExpiredAt = pq.NullTime{Time: b.CreatedAt.Add(duration), Valid: true}
+	}
 	err := session.Database(ctx).RunInTransaction(ctx, nil, func(ctx context.Context, tx *sql.Tx) error {
 		u, err := findUserById(ctx, tx, userId)
 		if err != nil || u == nil {
 			return err
 		}
-		data := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("Banned %s, Mixin ID: %d", u.FullName, u.IdentityNumber)))
-		err = createSystemDistributedMessageInTx(ctx, tx, user, MessageCategoryPlainText, data)
+		b.IdentityNumber, b.FullName = u.IdentityNumber, u.FullName
+		if notified != nil {
+			data := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("Banned %s, Mixin ID: %d", u.FullName, u.IdentityNumber)))
+			err = createSystemDistributedMessageInTx(ctx, tx, notified, MessageCategoryPlainText, data)
+			if err != nil {
+				return err
+			}
+		}
+		_, err = tx.ExecContext(ctx, "DELETE FROM users WHERE user_id=$1", u.UserId)
 		if err != nil {
 			return err
 		}
-		_, err = tx.ExecContext(ctx, "DELETE FROM users WHERE user_id=$1", u.UserId)
+
+		query := durable.PrepareQuery("INSERT INTO blacklists (%s) VALUES (%s) ON CONFLICT (user_id) DO UPDATE SET (operator_id, reason, message_id, expired_at, created_at)=(EXCLUDED.operator_id, EXCLUDED.reason, EXCLUDED.message_id, EXCLUDED.expired_at, EXCLUDED.created_at)", blacklistsCols)
+		_, err = tx.ExecContext(ctx, query, b.values()...)
 		if err != nil {
 			return err
 		}
+		return createAuditEventInTx(ctx, tx, operatorId, AuditActionBan, u.UserId, b.Reason, u.auditState(), b.auditState())
+	})
+	if err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	return b, nil
+}
 
-		stmt, err := tx.PrepareContext(ctx, pq.CopyIn("blacklists", "user_id"))
+// DeleteBlacklist lifts the ban, the user has to join the group again.
+func (user *User) DeleteBlacklist(ctx context.Context, userId string) (*Blacklist, error) {
+	if !user.Can(ctx, PermissionBan) {
+		return nil, session.ForbiddenError(ctx)
+	}
+	var b *Blacklist
+	err := session.Database(ctx).RunInTransaction(ctx, nil, func(ctx context.Context, tx *sql.Tx) error {
+		query := fmt.Sprintf("SELECT %s FROM blacklists WHERE user_id=$1", strings.Join(blacklistsCols, ","))
+		var err error
+		b, err = blacklistFromRow(tx.QueryRowContext(ctx, query, userId))
+		if err != nil || b == nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, "DELETE FROM blacklists WHERE user_id=$1", userId)
 		if err != nil {
 			return err
 		}
-		defer stmt.Close()
-		_, err = stmt.ExecContext(ctx, u.UserId)
-		return err
+		err = createAuditEventInTx(ctx, tx, user.UserId, AuditActionUnban, userId, "", b.auditState(), nil)
+		if err != nil {
+			return err
+		}
+		data := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("Unbanned %s, Mixin ID: %d", b.FullName, b.IdentityNumber)))
+		return createSystemDistributedMessageInTx(ctx, tx, user, MessageCategoryPlainText, data)
 	})
 	if err != nil {
 		return nil, session.TransactionError(ctx, err)
@@ -55,6 +130,52 @@ func (user *User) CreateBlacklist(ctx context.Context, userId string) (*Blacklis
 	return b, nil
 }
 
+// Blacklists lists bans created before the offset, newest first, the keywords
+// match the Mixin ID or the name.
+func (user *User) Blacklists(ctx context.Context, offset time.Time, keywords string, limit int64) ([]*Blacklist, error) {
+	if !user.Can(ctx, PermissionBan) {
+		return nil, session.ForbiddenError(ctx)
+	}
+	if offset.IsZero() {
+		offset = time.Now()
+	}
+	query := fmt.Sprintf("SELECT %s FROM blacklists WHERE created_at<$1", strings.Join(blacklistsCols, ","))
+	args := []interface{}{offset}
+	if keywords = strings.TrimSpace(keywords); keywords != "" {
+		query += " AND (CAST(identity_number AS VARCHAR)=$2 OR full_name ILIKE $3)"
+		args = append(args, keywords, "%"+keywords+"%")
+	}
+	query += fmt.Sprintf(" ORDER BY created_at DESC LIMIT %d", limit)
+	rows, err := session.Database(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	defer rows.Close()
+
+	var blacklists []*Blacklist
+	for rows.Next() {
+		b, err := blacklistFromRow(rows)
+		if err != nil {
+			return nil, session.TransactionError(ctx, err)
+		}
+		blacklists = append(blacklists, b)
+	}
+	return blacklists, nil
+}
+
+func (b *Blacklist) auditState() map[string]interface{} {
+	state := map[string]interface{}{
+		"operator_id": b.OperatorId,
+		"reason":      b.Reason,
+		"message_id":  b.MessageId,
+		"expired_at":  nil,
+	}
+	if b.ExpiredAt.Valid {
+		state["expired_at"] = b.ExpiredAt.Time
+	}
+	return state
+}
+
 func ReadBlacklist(ctx context.Context, userId string) (*Blacklist, error) {
 	var b *Blacklist
 	err := session.Database(ctx).RunInTransaction(ctx, nil, func(ctx context.Context, tx *sql.Tx) error {
@@ -69,12 +190,15 @@ func ReadBlacklist(ctx context.Context, userId string) (*Blacklist, error) {
 }
 
 func readBlacklistInTx(ctx context.Context, tx *sql.Tx, userId string) (*Blacklist, error) {
-	var b Blacklist
-	err := tx.QueryRowContext(ctx, "SELECT user_id from blacklists WHERE user_id=$1", userId).Scan(&b.UserId)
-	if err == sql.ErrNoRows {
-		return nil, nil
-	} else if err != nil {
-		return nil, err
+	query := fmt.Sprintf("SELECT %s FROM blacklists WHERE user_id=$1 AND (expired_at IS NULL OR expired_at>$2)", strings.Join(blacklistsCols, ","))
+	return blacklistFromRow(tx.QueryRowContext(ctx, query, userId, time.Now()))
+}
+
+func LoopClearUpExpiredBlacklists(ctx context.Context) (int64, error) {
+	query := "DELETE FROM blacklists WHERE user_id IN (SELECT user_id FROM blacklists WHERE expired_at<$1 LIMIT 100)"
+	r, err := session.Database(ctx).ExecContext(ctx, query, time.Now())
+	if err != nil {
+		return 0, session.TransactionError(ctx, err)
 	}
-	return &b, nil
+	return r.RowsAffected()
 }
@@ -24,7 +24,7 @@ func (b *Broadcaster) values() []interface{} {
 }
 
 func (current *User) CreateBroadcaster(ctx context.Context, identity int64) (*User, error) {
-	if !current.isAdmin() {
+	if !current.Can(ctx, PermissionManageRoles) {
 		return nil, session.ForbiddenError(ctx)
 	}
 
@@ -47,7 +47,10 @@ func (current *User) CreateBroadcaster(ctx context.Context, identity int64) (*Us
 		}
 		defer stmt.Close()
 		_, err = stmt.Exec(b.values()...)
-		return err
+		if err != nil {
+			return err
+		}
+		return createAuditEventInTx(ctx, tx, current.UserId, AuditActionAddBroadcaster, user.UserId, "", nil, user.auditState())
 	})
 	if err != nil {
 		return user, session.TransactionError(ctx, err)
@@ -4,8 +4,8 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
-	"io/ioutil"
 	"log"
+	"math"
 	"testing"
 
 	"github.com/MixinNetwork/supergroup.mixin.one/config"
@@ -19,18 +19,27 @@ const (
 )
 
 const (
-	dropRewardsDDL                  = `DROP TABLE IF EXISTS rewards;`
-	dropBroadcastersDDL             = `DROP TABLE IF EXISTS broadcasters;`
-	dropPropertiesDDL               = `DROP TABLE IF EXISTS properties;`
-	dropParticipantsDDL             = `DROP TABLE IF EXISTS participants;`
-	dropPacketsDDL                  = `DROP TABLE IF EXISTS packets;`
-	dropAssetsDDL                   = `DROP TABLE IF EXISTS assets;`
-	dropBlacklistsDDL               = `DROP TABLE IF EXISTS blacklists;`
-	dropDistributedMessagesDDL      = `DROP TABLE IF EXISTS distributed_messages;`
-	dropMessagesDDL                 = `DROP TABLE IF EXISTS messages;`
-	dropConversationParticipantsDDL = `DROP TABLE IF EXISTS conversation_participants;`
-	dropSessionsDDL                 = `DROP TABLE IF EXISTS sessions;`
-	dropUsersDDL                    = `DROP TABLE IF EXISTS users;`
+	dropSchemaMigrationsDDL = `DROP TABLE IF EXISTS schema_migrations;`
+	dropBaselineDDL         = `DROP TABLE IF EXISTS rate_limits;
+DROP TABLE IF EXISTS warnings;
+DROP TABLE IF EXISTS roles;
+DROP TABLE IF EXISTS audit_events;
+DROP TABLE IF EXISTS mutes;
+DROP TABLE IF EXISTS attachment_inspections;
+DROP TABLE IF EXISTS image_blocklists;
+DROP TABLE IF EXISTS message_fingerprints;
+DROP TABLE IF EXISTS rewards;
+DROP TABLE IF EXISTS broadcasters;
+DROP TABLE IF EXISTS properties;
+DROP TABLE IF EXISTS blacklists;
+DROP TABLE IF EXISTS assets;
+DROP TABLE IF EXISTS participants;
+DROP TABLE IF EXISTS packets;
+DROP TABLE IF EXISTS distributed_messages;
+DROP TABLE IF EXISTS messages;
+DROP TABLE IF EXISTS conversation_participants;
+DROP TABLE IF EXISTS sessions;
+DROP TABLE IF EXISTS users;`
 )
 
 func TestClear(t *testing.T) {
@@ -39,46 +48,38 @@ func TestClear(t *testing.T) {
 }
 
 func teardownTestContext(ctx context.Context) {
-	db := session.Database(ctx)
-	tables := []string{
-		dropConversationParticipantsDDL,
-		dropSessionsDDL,
-		dropUsersDDL,
-		dropMessagesDDL,
-		dropDistributedMessagesDDL,
-		dropBlacklistsDDL,
-		dropAssetsDDL,
-		dropParticipantsDDL,
-		dropPacketsDDL,
-		dropPropertiesDDL,
-		dropBroadcastersDDL,
-		dropRewardsDDL,
+	if _, err := MigrateDown(ctx, math.MaxInt32); err != nil {
+		log.Panicln(err)
 	}
-	for _, q := range tables {
-		if _, err := db.Exec(q); err != nil {
-			log.Panicln(err)
-		}
+	if _, err := session.Database(ctx).Exec(dropBaselineDDL); err != nil {
+		log.Panicln(err)
+	}
+	if _, err := session.Database(ctx).Exec(dropSchemaMigrationsDDL); err != nil {
+		log.Panicln(err)
 	}
 }
 
 func setupTestContext() context.Context {
 	config.Init(testEnvironment)
-	if config.AppConfig.Service.Environment != testEnvironment || config.AppConfig.Database.Name != testDatabase {
-		log.Panicln(config.AppConfig.Service.Environment, config.AppConfig.Database.Name)
+	if config.AppConfig().Service.Environment != testEnvironment || config.AppConfig().Database.Name != testDatabase {
+		log.Panicln(config.AppConfig().Service.Environment, config.AppConfig().Database.Name)
 	}
 
-	connStr := fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=disable", config.AppConfig.Database.User, config.AppConfig.Database.Password, config.AppConfig.Database.Host, config.AppConfig.Database.Port, config.AppConfig.Database.Name)
+	connStr := fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=disable", config.AppConfig().Database.User, config.AppConfig().Database.Password, config.AppConfig().Database.Host, config.AppConfig().Database.Port, config.AppConfig().Database.Name)
 	db, err := sql.Open("postgres", connStr)
 	if err != nil {
 		log.Panicln(err)
 	}
-	data, err := ioutil.ReadFile("./schema.sql")
-	if _, err := db.Exec(string(data)); err != nil {
-		log.Panicln(err)
-	}
 	database, err := durable.NewDatabase(context.Background(), db)
 	if err != nil {
 		log.Panicln(err)
 	}
-	return session.WithDatabase(context.Background(), database)
+	ctx := session.WithDatabase(context.Background(), database)
+	if _, err := MigrateUp(ctx); err != nil {
+		log.Panicln(err)
+	}
+	if err := SeedRoles(ctx); err != nil {
+		log.Panicln(err)
+	}
+	return ctx
 }
@@ -9,9 +9,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"math/big"
-	"net/http"
 	"strings"
 	"time"
 
@@ -19,7 +17,6 @@ import (
 	"github.com/MixinNetwork/supergroup.mixin.one/config"
 	"github.com/MixinNetwork/supergroup.mixin.one/durable"
 	"github.com/MixinNetwork/supergroup.mixin.one/session"
-	"github.com/MixinNetwork/supergroup.mixin.one/utils"
 	"github.com/gofrs/uuid"
 	"github.com/lib/pq"
 	"mvdan.cc/xurls"
@@ -63,8 +60,8 @@ func distributedMessageFromRow(row durable.Row) (*DistributedMessage, error) {
 }
 
 func (message *Message) Distribute(ctx context.Context) error {
-	system := config.AppConfig.System
-	if !system.Operators[message.UserId] {
+	system := config.AppConfig().System
+	if !roleCan(roleOf(ctx, message.UserId), PermissionBroadcast) {
 		switch message.Category {
 		case MessageCategoryPlainText, MessageCategoryEncryptedText:
 			if system.DetectLinkEnabled {
@@ -77,13 +74,25 @@ func (message *Message) Distribute(ctx context.Context) error {
 				}
 			}
 		case MessageCategoryPlainImage, MessageCategoryEncryptedImage:
-			if system.DetectQRCodeEnabled {
-				b, reason := messageQRFilter(ctx, message)
-				if !b {
-					return message.Notify(ctx, reason)
+			if system.DetectQRCodeEnabled || system.DetectImageHashEnabled {
+				inspection, err := inspectMessageAttachment(ctx, message)
+				if err != nil || inspection == nil {
+					return err
+				}
+				if inspection.State == AttachmentInspectionStateBlocked {
+					return message.Notify(ctx, inspection.Reason)
 				}
 			}
 		}
+		if message.UserId != config.AppConfig().Mixin.ClientId {
+			flooded, err := checkMessageFlood(ctx, message)
+			if err != nil {
+				return err
+			}
+			if flooded {
+				return holdFloodedMessage(ctx, message)
+			}
+		}
 	}
 
 	var recall RecallMessage
@@ -178,7 +187,7 @@ func (message *Message) Distribute(ctx context.Context) error {
 					message.Data = base64.RawURLEncoding.EncodeToString(data)
 				}
 
-				conversationId := UniqueConversationId(config.AppConfig.Mixin.ClientId, user.UserId)
+				conversationId := UniqueConversationId(config.AppConfig().Mixin.ClientId, user.UserId)
 				shard, err := shardId(conversationId, user.UserId)
 				if err != nil {
 					return err
@@ -225,10 +234,7 @@ func (message *Message) Distribute(ctx context.Context) error {
 }
 
 func (message *Message) Notify(ctx context.Context, reason string) error {
-	ids := make([]string, 0)
-	for key, _ := range config.AppConfig.System.Operators {
-		ids = append(ids, key)
-	}
+	ids := usersWithPermission(ctx, PermissionRecall)
 	messageIds := make([]string, len(ids))
 	for i, id := range ids {
 		messageIds[i] = UniqueConversationId(id, message.MessageId)
@@ -293,8 +299,8 @@ func notifyTooLarge(ctx context.Context, messageId, category, userId, name strin
 
 		why := fmt.Sprintf("MessageId: %s, Category: %s, Reason: data too large, From: %s", messageId, category, name)
 		data := base64.RawURLEncoding.EncodeToString([]byte(why))
-		mixin := config.AppConfig.Mixin
-		for key, _ := range config.AppConfig.System.Operators {
+		mixin := config.AppConfig().Mixin
+		for _, key := range usersWithPermission(ctx, PermissionRecall) {
 			dm := &DistributedMessage{
 				MessageId:      bot.UuidNewV4().String(),
 				ConversationId: UniqueConversationId(mixin.ClientId, key),
@@ -338,7 +344,7 @@ func createSystemDistributedMessageInTx(ctx context.Context, tx *sql.Tx, user *U
 	if len(reason) == 0 {
 		return nil
 	}
-	dm, err := buildDistributeMessage(ctx, bot.UuidNewV4().String(), bot.UuidNewV4().String(), "", config.AppConfig.Mixin.ClientId, user.UserId, category, reason, false)
+	dm, err := buildDistributeMessage(ctx, bot.UuidNewV4().String(), bot.UuidNewV4().String(), "", config.AppConfig().Mixin.ClientId, user.UserId, category, reason, false)
 	if err != nil {
 		return err
 	}
@@ -453,11 +459,11 @@ func shardId(cid, uid string) (string, error) {
 	io.WriteString(h, minId)
 	io.WriteString(h, maxId)
 
-	b := new(big.Int).SetInt64(config.AppConfig.System.MessageShardSize)
+	b := new(big.Int).SetInt64(config.AppConfig().System.MessageShardSize)
 	c := new(big.Int).SetBytes(h.Sum(nil))
 	m := new(big.Int).Mod(c, b)
 	h = md5.New()
-	h.Write([]byte(config.AppConfig.System.MessageShardModifier))
+	h.Write([]byte(config.AppConfig().System.MessageShardModifier))
 	h.Write(m.Bytes())
 	s := h.Sum(nil)
 	s[6] = (s[6] & 0x0f) | 0x30
@@ -468,57 +474,27 @@ func shardId(cid, uid string) (string, error) {
 
 type Attachment struct {
 	AttachmentId string `json:"attachment_id"`
+	Size         int64  `json:"size"`
 }
 
-func messageQRFilter(ctx context.Context, message *Message) (bool, string) {
+func readAttachment(ctx context.Context, data string) (*Attachment, error) {
 	var a Attachment
-	src, err := base64.RawURLEncoding.DecodeString(message.Data)
+	src, err := base64.RawURLEncoding.DecodeString(data)
 	if err != nil {
-		return false, "message.Data format error is not Base64"
+		return nil, fmt.Errorf("message.Data format error is not Base64")
 	}
 	err = json.Unmarshal(src, &a)
 	if err != nil {
 		session.Logger(ctx).Errorf("validateMessage ERROR: %+v", err)
-		return false, "message.Data Unmarshal error"
-	}
-	mixin := config.AppConfig.Mixin
-	attachment, err := bot.AttachmentShow(ctx, mixin.ClientId, mixin.SessionId, mixin.SessionKey, a.AttachmentId)
-	if err != nil {
-		return false, fmt.Sprintf("bot.AttachemntShow error: %+v, id: %s", err, a.AttachmentId)
-	}
-
-	url := strings.Replace(attachment.ViewURL, "assets.zeromesh.net", "s3.cn-north-1.amazonaws.com.cn", 0)
-	req, err := http.NewRequest(http.MethodGet, url, nil)
-	if err != nil {
-		return true, ""
-	}
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
-	defer cancel()
-	resp, _ := http.DefaultClient.Do(req.WithContext(ctx))
-	if err != nil {
-		return true, ""
-	}
-	if !(resp.StatusCode >= 200 && resp.StatusCode < 300) {
-		return true, ""
-	}
-
-	data, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return true, ""
-	}
-	if b, err := utils.CheckQRCode(ctx, data); b {
-		if err != nil {
-			return true, ""
-		}
-		return false, "Image contains QR Code"
+		return nil, fmt.Errorf("message.Data Unmarshal error")
 	}
-	return true, ""
+	return &a, nil
 }
 
 func buildDistributeMessage(ctx context.Context, messageId, parentId, quoteMessageId, userId, recipientId, category, data string, silent bool) (*DistributedMessage, error) {
 	dm := &DistributedMessage{
 		MessageId:      messageId,
-		ConversationId: UniqueConversationId(config.AppConfig.Mixin.ClientId, recipientId),
+		ConversationId: UniqueConversationId(config.AppConfig().Mixin.ClientId, recipientId),
 		RecipientId:    recipientId,
 		UserId:         userId,
 		ParentId:       parentId,
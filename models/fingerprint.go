@@ -0,0 +1,151 @@
+package models
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/MixinNetwork/supergroup.mixin.one/config"
+	"github.com/MixinNetwork/supergroup.mixin.one/durable"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+)
+
+const (
+	SpamOffenderPeriod = 24 * time.Hour
+)
+
+type Fingerprint struct {
+	MessageId   string
+	UserId      string
+	Fingerprint string
+	Held        bool
+	CreatedAt   time.Time
+}
+
+var fingerprintsCols = []string{"message_id", "user_id", "fingerprint", "held", "created_at"}
+
+func (f *Fingerprint) values() []interface{} {
+	return []interface{}{f.MessageId, f.UserId, f.Fingerprint, f.Held, f.CreatedAt}
+}
+
+// checkMessageFlood records the content fingerprint of the message and reports
+// whether the same content was posted by too many distinct users in the window.
+func checkMessageFlood(ctx context.Context, message *Message) (bool, error) {
+	system := config.AppConfig().System
+	if system.SpamFloodWindow <= 0 || system.SpamFloodThreshold <= 0 {
+		return false, nil
+	}
+	fingerprint := messageFingerprint(message.Category, message.Data)
+	if fingerprint == "" {
+		return false, nil
+	}
+	f := &Fingerprint{
+		MessageId:   message.MessageId,
+		UserId:      message.UserId,
+		Fingerprint: fingerprint,
+		CreatedAt:   time.Now(),
+	}
+	var count int
+	err := session.Database(ctx).RunInTransaction(ctx, nil, func(ctx context.Context, tx *sql.Tx) error {
+		query := durable.PrepareQuery("INSERT INTO message_fingerprints (%s) VALUES (%s) ON CONFLICT (message_id) DO NOTHING", fingerprintsCols)
+		_, err := tx.ExecContext(ctx, query, f.values()...)
+		if err != nil {
+			return err
+		}
+		query = "SELECT COUNT(DISTINCT user_id) FROM message_fingerprints WHERE fingerprint=$1 AND created_at>$2"
+		return tx.QueryRowContext(ctx, query, f.Fingerprint, time.Now().Add(-time.Duration(system.SpamFloodWindow)*time.Second)).Scan(&count)
+	})
+	if err != nil {
+		return false, session.TransactionError(ctx, err)
+	}
+	return count > system.SpamFloodThreshold, nil
+}
+
+// holdFloodedMessage forwards the message to the operators instead of the group,
+// and bans the author as the bot once they have been held too often.
+func holdFloodedMessage(ctx context.Context, message *Message) error {
+	var count int
+	err := session.Database(ctx).RunInTransaction(ctx, nil, func(ctx context.Context, tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, "UPDATE message_fingerprints SET held=true WHERE message_id=$1", message.MessageId)
+		if err != nil {
+			return err
+		}
+		query := "SELECT COUNT(*) FROM message_fingerprints WHERE user_id=$1 AND held=true AND created_at>$2"
+		return tx.QueryRowContext(ctx, query, message.UserId, time.Now().Add(-SpamOffenderPeriod)).Scan(&count)
+	})
+	if err != nil {
+		return session.TransactionError(ctx, err)
+	}
+	err = message.Notify(ctx, "Message flooded by multiple users")
+	if err != nil {
+		return err
+	}
+
+	system := config.AppConfig().System
+	if system.SpamBanThreshold <= 0 || count < system.SpamBanThreshold {
+		return nil
+	}
+	_, err = createBlacklist(ctx, config.AppConfig().Mixin.ClientId, nil, message.UserId, "Message flooded by multiple users", message.MessageId, 0)
+	return err
+}
+
+// LoopClearUpExpiredFingerprints drops the fingerprints older than both the
+// flood window and the offender period, which may be longer either way.
+func LoopClearUpExpiredFingerprints(ctx context.Context) (int64, error) {
+	period := SpamOffenderPeriod
+	if window := time.Duration(config.AppConfig().System.SpamFloodWindow) * time.Second; window > period {
+		period = window
+	}
+	query := "DELETE FROM message_fingerprints WHERE message_id IN (SELECT message_id FROM message_fingerprints WHERE created_at<$1 LIMIT 100)"
+	r, err := session.Database(ctx).ExecContext(ctx, query, time.Now().Add(-period))
+	if err != nil {
+		return 0, session.TransactionError(ctx, err)
+	}
+	return r.RowsAffected()
+}
+
+func messageFingerprint(category, data string) string {
+	src, err := base64.RawURLEncoding.DecodeString(data)
+	if err != nil {
+		return ""
+	}
+	var content string
+	switch category {
+	case MessageCategoryPlainText, MessageCategoryEncryptedText:
+		text := normalizeText(string(src))
+		if len(text) < 8 {
+			return ""
+		}
+		content = "TEXT:" + text
+	case MessageCategoryPlainImage, MessageCategoryEncryptedImage,
+		MessageCategoryPlainVideo, MessageCategoryEncryptedVideo,
+		MessageCategoryPlainData, MessageCategoryEncryptedData:
+		var a Attachment
+		if json.Unmarshal(src, &a) != nil || a.AttachmentId == "" {
+			return ""
+		}
+		content = "ATTACHMENT:" + a.AttachmentId
+	default:
+		return ""
+	}
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// normalizeText drops case, spaces, punctuation and symbols, so trivial
+// variations of the same spam text share one fingerprint.
+func normalizeText(text string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(text) {
+		if unicode.IsLetter(r) || unicode.IsNumber(r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,65 @@
+package models
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+
+	bot "github.com/MixinNetwork/bot-api-go-client/v2"
+	"github.com/MixinNetwork/supergroup.mixin.one/config"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFingerprintCRUD(t *testing.T) {
+	assert := assert.New(t)
+	ctx := setupTestContext()
+	defer teardownTestContext(ctx)
+
+	assert.Equal("buynowcheap", normalizeText("Buy NOW, cheap!!!"))
+	text := base64.RawURLEncoding.EncodeToString([]byte("Buy NOW, cheap!!!"))
+	variant := base64.RawURLEncoding.EncodeToString([]byte("buy now cheap"))
+	assert.Equal(messageFingerprint(MessageCategoryPlainText, text), messageFingerprint(MessageCategoryEncryptedText, variant))
+	assert.Equal("", messageFingerprint(MessageCategoryPlainText, base64.RawURLEncoding.EncodeToString([]byte("ok"))))
+	image := base64.RawURLEncoding.EncodeToString([]byte(`{"attachment_id":"a1b2"}`))
+	assert.NotEqual("", messageFingerprint(MessageCategoryPlainImage, image))
+	assert.Equal("", messageFingerprint(MessageCategoryPlainSticker, image))
+
+	system := &config.AppConfig().System
+	system.SpamFloodWindow = 60
+	system.SpamFloodThreshold = 2
+	defer func() {
+		system.SpamFloodWindow = 0
+		system.SpamFloodThreshold = 0
+	}()
+
+	for i := 0; i < 3; i++ {
+		message := &Message{
+			MessageId: bot.UuidNewV4().String(),
+			UserId:    bot.UuidNewV4().String(),
+			Category:  MessageCategoryPlainText,
+			Data:      text,
+			CreatedAt: time.Now(),
+		}
+		flooded, err := checkMessageFlood(ctx, message)
+		assert.Nil(err)
+		assert.Equal(i >= 2, flooded)
+		flooded, err = checkMessageFlood(ctx, message)
+		assert.Nil(err)
+		assert.Equal(i >= 2, flooded)
+	}
+	count, err := LoopClearUpExpiredFingerprints(ctx)
+	assert.Nil(err)
+	assert.Equal(int64(0), count)
+
+	_, err = session.Database(ctx).Exec("UPDATE message_fingerprints SET created_at=$1", time.Now().Add(-30*time.Hour))
+	assert.Nil(err)
+	system.SpamFloodWindow = 48 * 3600
+	count, err = LoopClearUpExpiredFingerprints(ctx)
+	assert.Nil(err)
+	assert.Equal(int64(0), count)
+	system.SpamFloodWindow = 60
+	count, err = LoopClearUpExpiredFingerprints(ctx)
+	assert.Nil(err)
+	assert.Equal(int64(3), count)
+}
@@ -0,0 +1,284 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	bot "github.com/MixinNetwork/bot-api-go-client/v2"
+	"github.com/MixinNetwork/supergroup.mixin.one/config"
+	"github.com/MixinNetwork/supergroup.mixin.one/durable"
+	"github.com/MixinNetwork/supergroup.mixin.one/externals"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+)
+
+const (
+	GiftStatePending   = "pending"
+	GiftStateDelivered = "delivered"
+	GiftStateRefunded  = "refunded"
+)
+
+// Gift is a membership paid by a user for another one, the gift id is the
+// snapshot id of the payment. A gift to a user who hasn't authorized the bot
+// stays pending until the recipient authorizes, or is refunded to the sender
+// once expired or if it can't be delivered.
+type Gift struct {
+	GiftId      string
+	UserId      string
+	RecipientId string
+	Plan        string
+	AssetId     string
+	Amount      string
+	State       string
+	CreatedAt   time.Time
+}
+
+var giftsCols = []string{"gift_id", "user_id", "recipient_id", "plan", "asset_id", "amount", "state", "created_at"}
+
+func (g *Gift) values() []interface{} {
+	return []interface{}{g.GiftId, g.UserId, g.RecipientId, g.Plan, g.AssetId, g.Amount, g.State, g.CreatedAt}
+}
+
+func giftFromRow(row durable.Row) (*Gift, error) {
+	var g Gift
+	err := row.Scan(&g.GiftId, &g.UserId, &g.RecipientId, &g.Plan, &g.AssetId, &g.Amount, &g.State, &g.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return &g, err
+}
+
+// ResolveGiftRecipient finds the user id of the target, a user id or identity
+// number, the Mixin users who haven't authorized the bot are searched, it
+// returns empty if not found.
+func ResolveGiftRecipient(ctx context.Context, target string) (string, error) {
+	if _, err := bot.UuidFromString(target); err == nil {
+		user, err := FindUser(ctx, target)
+		if err != nil {
+			return "", err
+		} else if user != nil {
+			return user.UserId, nil
+		}
+	} else if identity, err := strconv.ParseInt(target, 10, 64); err == nil && identity > 0 {
+		user, err := findUserByIdentityNumber(ctx, identity)
+		if err != nil {
+			return "", err
+		} else if user != nil {
+			return user.UserId, nil
+		}
+	} else {
+		return "", nil
+	}
+	u, err := externals.SearchUser(ctx, target)
+	if err != nil || u == nil {
+		return "", err
+	}
+	return u.UserId, nil
+}
+
+// PayGift pays the plan matching the asset and amount for the target, it
+// returns the refund memo instead if the gift can't be paid.
+func (sender *User) PayGift(ctx context.Context, snapshotId, target, assetId, amount string) (*Gift, string, error) {
+	plan := MatchMembershipPlan(assetId, amount)
+	if plan == nil {
+		return nil, RefundMemoMismatched, nil
+	}
+	recipientId, err := ResolveGiftRecipient(ctx, target)
+	if err != nil {
+		return nil, "", err
+	}
+	if recipientId == "" || recipientId == sender.UserId {
+		return nil, RefundMemoGiftInvalid, nil
+	}
+	var gift *Gift
+	var refund string
+	err = session.Database(ctx).RunInTransaction(ctx, nil, func(ctx context.Context, tx *sql.Tx) error {
+		var err error
+		gift, refund, err = sender.giftMembershipInTx(ctx, tx, snapshotId, recipientId, plan, assetId, amount, membershipFee(plan, assetId, amount))
+		if err != nil || gift == nil {
+			return err
+		}
+		return resolveSnapshotInTx(ctx, tx, snapshotId, SnapshotPurposeMembership)
+	})
+	if err != nil {
+		return nil, "", session.TransactionError(ctx, err)
+	}
+	return gift, refund, nil
+}
+
+// giftMembershipInTx pays the plan for the recipient and tells both sides, a
+// recipient who hasn't authorized the bot gets it when authorizing. The amount
+// is what the sender paid, and the fee is the price matched by it.
+func (sender *User) giftMembershipInTx(ctx context.Context, tx *sql.Tx, giftId, recipientId string, plan *config.MembershipPlan, assetId, amount, fee string) (*Gift, string, error) {
+	b, err := readBlacklistInTx(ctx, tx, recipientId)
+	if err != nil {
+		return nil, "", err
+	} else if b != nil {
+		return nil, RefundMemoGiftBlocked, nil
+	}
+	gift := &Gift{
+		GiftId:      giftId,
+		UserId:      sender.UserId,
+		RecipientId: recipientId,
+		Plan:        plan.Name,
+		AssetId:     assetId,
+		Amount:      amount,
+		State:       GiftStatePending,
+		CreatedAt:   time.Now(),
+	}
+	recipient, err := findUserById(ctx, tx, recipientId)
+	if err != nil {
+		return nil, "", err
+	}
+	if recipient != nil {
+		paid, err := recipient.payMembershipInTx(ctx, tx, plan, assetId, fee)
+		if err != nil {
+			return nil, "", err
+		}
+		if !paid {
+			return nil, RefundMemoNotAccepted, nil
+		}
+		gift.State = GiftStateDelivered
+	}
+	query := durable.PrepareQuery("INSERT INTO gifts (%s) VALUES (%s)", giftsCols)
+	_, err = tx.ExecContext(ctx, query, gift.values()...)
+	if err != nil {
+		return nil, "", err
+	}
+	if recipient == nil {
+		tips := fmt.Sprintf(config.AppConfig().MessageTemplate.MessageTipsGiftPending, plan.Name)
+		return gift, "", createSystemDistributedMessageInTx(ctx, tx, sender, MessageCategoryPlainText, base64.RawURLEncoding.EncodeToString([]byte(tips)))
+	}
+	return gift, "", gift.notifyInTx(ctx, tx, sender, recipient)
+}
+
+// claimGifts delivers the pending gifts of a user who just authorized the bot,
+// the membership fields of the user are updated in place.
+func (user *User) claimGifts(ctx context.Context) error {
+	err := session.Database(ctx).RunInTransaction(ctx, nil, func(ctx context.Context, tx *sql.Tx) error {
+		query := fmt.Sprintf("SELECT %s FROM gifts WHERE recipient_id=$1 AND state=$2 ORDER BY created_at FOR UPDATE", strings.Join(giftsCols, ","))
+		gifts, err := readGiftsInTx(ctx, tx, query, user.UserId, GiftStatePending)
+		if err != nil {
+			return err
+		}
+
+		recipient := &User{UserId: user.UserId}
+		for _, g := range gifts {
+			plan := FindMembershipPlan(g.Plan)
+			if plan == nil {
+				err := g.refundInTx(ctx, tx, RefundMemoMismatched)
+				if err != nil {
+					return err
+				}
+				continue
+			}
+			paid, err := recipient.payMembershipInTx(ctx, tx, plan, g.AssetId, membershipFee(plan, g.AssetId, g.Amount))
+			if err != nil {
+				return err
+			}
+			if !paid {
+				err := g.refundInTx(ctx, tx, RefundMemoNotAccepted)
+				if err != nil {
+					return err
+				}
+				continue
+			}
+			g.State = GiftStateDelivered
+			_, err = tx.ExecContext(ctx, "UPDATE gifts SET state=$1 WHERE gift_id=$2", g.State, g.GiftId)
+			if err != nil {
+				return err
+			}
+			sender, err := findUserById(ctx, tx, g.UserId)
+			if err != nil {
+				return err
+			}
+			if sender == nil {
+				sender = &User{UserId: g.UserId}
+			}
+			err = g.notifyInTx(ctx, tx, sender, recipient)
+			if err != nil {
+				return err
+			}
+			user.State, user.SubscribedAt, user.PayMethod = recipient.State, recipient.SubscribedAt, recipient.PayMethod
+			user.ProbationUntil, user.PaidUntil = recipient.ProbationUntil, recipient.PaidUntil
+		}
+		return nil
+	})
+	if err != nil {
+		return session.TransactionError(ctx, err)
+	}
+	return nil
+}
+
+// LoopExpiredGifts refunds the pending gifts older than the gift expiration
+// to their senders, the gifts never expire if the expiration is not set.
+func LoopExpiredGifts(ctx context.Context) (int64, error) {
+	expiration := config.AppConfig().System.GiftExpiration
+	if expiration <= 0 {
+		return 0, nil
+	}
+	var count int64
+	err := session.Database(ctx).RunInTransaction(ctx, nil, func(ctx context.Context, tx *sql.Tx) error {
+		query := fmt.Sprintf("SELECT %s FROM gifts WHERE state=$1 AND created_at<$2 ORDER BY created_at LIMIT 100 FOR UPDATE", strings.Join(giftsCols, ","))
+		gifts, err := readGiftsInTx(ctx, tx, query, GiftStatePending, time.Now().Add(-time.Duration(expiration)*time.Second))
+		if err != nil {
+			return err
+		}
+		for _, g := range gifts {
+			err := g.refundInTx(ctx, tx, RefundMemoGiftExpired)
+			if err != nil {
+				return err
+			}
+		}
+		count = int64(len(gifts))
+		return nil
+	})
+	if err != nil {
+		return 0, session.TransactionError(ctx, err)
+	}
+	return count, nil
+}
+
+// refundInTx marks the gift refunded and queues the refund keyed by the gift
+// id, which is the snapshot id of the payment.
+func (g *Gift) refundInTx(ctx context.Context, tx *sql.Tx, memo string) error {
+	g.State = GiftStateRefunded
+	_, err := tx.ExecContext(ctx, "UPDATE gifts SET state=$1 WHERE gift_id=$2", g.State, g.GiftId)
+	if err != nil {
+		return err
+	}
+	_, err = createRefundInTx(ctx, tx, g.GiftId, g.UserId, g.AssetId, g.Amount, memo)
+	return err
+}
+
+func readGiftsInTx(ctx context.Context, tx *sql.Tx, query string, args ...interface{}) ([]*Gift, error) {
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var gifts []*Gift
+	for rows.Next() {
+		g, err := giftFromRow(rows)
+		if err != nil {
+			return nil, err
+		}
+		gifts = append(gifts, g)
+	}
+	return gifts, rows.Err()
+}
+
+func (g *Gift) notifyInTx(ctx context.Context, tx *sql.Tx, sender, recipient *User) error {
+	tips := fmt.Sprintf(config.AppConfig().MessageTemplate.MessageTipsGiftSent, recipient.GetFullName(), g.Plan)
+	err := createSystemDistributedMessageInTx(ctx, tx, sender, MessageCategoryPlainText, base64.RawURLEncoding.EncodeToString([]byte(tips)))
+	if err != nil {
+		return err
+	}
+	tips = fmt.Sprintf(config.AppConfig().MessageTemplate.MessageTipsGiftReceived, sender.GetFullName(), g.Plan)
+	return createSystemDistributedMessageInTx(ctx, tx, recipient, MessageCategoryPlainText, base64.RawURLEncoding.EncodeToString([]byte(tips)))
+}
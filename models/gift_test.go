@@ -0,0 +1,137 @@
+package models
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"testing"
+	"time"
+
+	bot "github.com/MixinNetwork/bot-api-go-client/v2"
+	"github.com/MixinNetwork/supergroup.mixin.one/config"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGiftCRUD(t *testing.T) {
+	assert := assert.New(t)
+	ctx := setupTestContext()
+	defer teardownTestContext(ctx)
+
+	assetId := bot.UuidNewV4().String()
+	system := config.AppConfig().System
+	defer func() { config.AppConfig().System = system }()
+	config.AppConfig().System.MembershipPlanList = []config.MembershipPlan{
+		{Name: "monthly", Duration: 2592000, Prices: []config.PaymentAsset{{Symbol: "XIN", AssetId: assetId, Amount: "0.01"}}},
+	}
+
+	var users []*User
+	for i := 0; i < 4; i++ {
+		pub, priv, err := ed25519.GenerateKey(rand.Reader)
+		assert.Nil(err)
+		public := base64.RawURLEncoding.EncodeToString(pub)
+		private := base64.RawURLEncoding.EncodeToString(priv)
+		userId := bot.UuidNewV4().String()
+		if i == 3 {
+			recipientId, err := ResolveGiftRecipient(ctx, userId)
+			assert.Nil(err)
+			assert.Equal(userId, recipientId)
+			gift, refund, err := users[0].PayGift(ctx, bot.UuidNewV4().String(), userId, assetId, "0.01")
+			assert.Nil(err)
+			assert.Equal("", refund)
+			assert.Equal(GiftStatePending, gift.State)
+		}
+		user, err := createUser(ctx, public, private, bot.UuidNewV4().String(), "", userId, fmt.Sprint(1000+i), "name", "http://localhost")
+		assert.Nil(err)
+		users = append(users, user)
+	}
+	sender, recipient, blocked, late := users[0], users[1], users[2], users[3]
+	admin := &User{UserId: config.AppConfig().System.OperatorList[0]}
+	_, err := admin.CreateBlacklist(ctx, blocked.UserId, "spam", "", 0)
+	assert.Nil(err)
+
+	recipientId, err := ResolveGiftRecipient(ctx, "1001")
+	assert.Nil(err)
+	assert.Equal(recipient.UserId, recipientId)
+	recipientId, err = ResolveGiftRecipient(ctx, "friend")
+	assert.Nil(err)
+	assert.Equal("", recipientId)
+
+	gift, refund, err := sender.PayGift(ctx, bot.UuidNewV4().String(), "1001", assetId, "0.02")
+	assert.Nil(err)
+	assert.Nil(gift)
+	assert.Equal(RefundMemoMismatched, refund)
+	gift, refund, err = sender.PayGift(ctx, bot.UuidNewV4().String(), "1000", assetId, "0.01")
+	assert.Nil(err)
+	assert.Nil(gift)
+	assert.Equal(RefundMemoGiftInvalid, refund)
+	gift, refund, err = sender.PayGift(ctx, bot.UuidNewV4().String(), blocked.UserId, assetId, "0.01")
+	assert.Nil(err)
+	assert.Nil(gift)
+	assert.Equal(RefundMemoGiftBlocked, refund)
+
+	snapshotId := bot.UuidNewV4().String()
+	gift, refund, err = sender.PayGift(ctx, snapshotId, "1001", assetId, "0.01")
+	assert.Nil(err)
+	assert.Equal("", refund)
+	assert.Equal(snapshotId, gift.GiftId)
+	assert.Equal(recipient.UserId, gift.RecipientId)
+	assert.Equal(GiftStateDelivered, gift.State)
+	recipient, err = FindUser(ctx, recipient.UserId)
+	assert.Nil(err)
+	assert.Equal(PaymentStatePaid, recipient.State)
+	sender, err = FindUser(ctx, sender.UserId)
+	assert.Nil(err)
+	assert.Equal(PaymentStatePending, sender.State)
+
+	assert.Equal(PaymentStatePending, late.State)
+	assert.Nil(late.claimGifts(ctx))
+	assert.Equal(PaymentStatePaid, late.State)
+	assert.False(late.PaidUntil.IsZero())
+	assert.NotEqual("", late.AuthenticationToken)
+	late, err = FindUser(ctx, late.UserId)
+	assert.Nil(err)
+	assert.Equal(PaymentStatePaid, late.State)
+	assert.Nil(late.claimGifts(ctx))
+
+	missing := &User{UserId: bot.UuidNewV4().String()}
+	missingGift, refund, err := sender.PayGift(ctx, bot.UuidNewV4().String(), missing.UserId, assetId, "0.01")
+	assert.Nil(err)
+	assert.Equal("", refund)
+	assert.Equal(GiftStatePending, missingGift.State)
+	staleGift, refund, err := sender.PayGift(ctx, bot.UuidNewV4().String(), bot.UuidNewV4().String(), assetId, "0.01")
+	assert.Nil(err)
+	assert.Equal("", refund)
+	assert.Equal(GiftStatePending, staleGift.State)
+
+	plans := config.AppConfig().System.MembershipPlanList
+	config.AppConfig().System.MembershipPlanList = nil
+	assert.Nil(missing.claimGifts(ctx))
+	assert.True(missing.PaidUntil.IsZero())
+	config.AppConfig().System.MembershipPlanList = plans
+
+	config.AppConfig().System.GiftExpiration = 0
+	count, err := LoopExpiredGifts(ctx)
+	assert.Nil(err)
+	assert.Equal(int64(0), count)
+	config.AppConfig().System.GiftExpiration = 3600
+	_, err = session.Database(ctx).Exec("UPDATE gifts SET created_at=$1 WHERE gift_id=$2", time.Now().Add(-2*time.Hour), staleGift.GiftId)
+	assert.Nil(err)
+	count, err = LoopExpiredGifts(ctx)
+	assert.Nil(err)
+	assert.Equal(int64(1), count)
+	count, err = LoopExpiredGifts(ctx)
+	assert.Nil(err)
+	assert.Equal(int64(0), count)
+
+	refunds, err := PendingRefunds(ctx, 100)
+	assert.Nil(err)
+	memos := make(map[string]string)
+	for _, r := range refunds {
+		memos[r.SnapshotId] = r.Memo
+	}
+	assert.Equal(RefundMemoMismatched, memos[missingGift.GiftId])
+	assert.Equal(RefundMemoGiftExpired, memos[staleGift.GiftId])
+	assert.Equal("", memos[snapshotId])
+}
@@ -0,0 +1,117 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/MixinNetwork/supergroup.mixin.one/config"
+	"github.com/MixinNetwork/supergroup.mixin.one/durable"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+	"github.com/MixinNetwork/supergroup.mixin.one/utils"
+)
+
+type ImageBlock struct {
+	Hash      string
+	MessageId string
+	UserId    string
+	CreatedAt time.Time
+}
+
+var imageBlocklistsCols = []string{"hash", "message_id", "user_id", "created_at"}
+
+func (b *ImageBlock) values() []interface{} {
+	return []interface{}{b.Hash, b.MessageId, b.UserId, b.CreatedAt}
+}
+
+// CreateImageBlock adds the image of the message to the blocklist, the id could be
+// the original message or the copy forwarded to the operators.
+func (current *User) CreateImageBlock(ctx context.Context, id string) (*ImageBlock, error) {
+	if !current.Can(ctx, PermissionRecall) {
+		return nil, session.ForbiddenError(ctx)
+	}
+	message, err := FindMessage(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if message == nil {
+		dm, err := FindDistributedMessage(ctx, id)
+		if err != nil || dm == nil {
+			return nil, err
+		}
+		message, err = FindMessage(ctx, dm.ParentId)
+		if err != nil || message == nil {
+			return nil, err
+		}
+	}
+	switch message.Category {
+	case MessageCategoryPlainImage, MessageCategoryEncryptedImage:
+	default:
+		return nil, session.BadDataError(ctx)
+	}
+
+	a, err := readAttachment(ctx, message.Data)
+	if err != nil {
+		return nil, session.BadDataError(ctx)
+	}
+	data, err := attachmentFetcher.Fetch(ctx, a.AttachmentId, config.AppConfig().System.AttachmentMaxSize)
+	if err != nil {
+		return nil, session.ServerError(ctx, err)
+	}
+	hash, err := utils.DifferenceHash(data)
+	if err != nil {
+		return nil, session.BadDataError(ctx)
+	}
+	return createImageBlock(ctx, hash, message.MessageId, current.UserId)
+}
+
+func createImageBlock(ctx context.Context, hash uint64, messageId, userId string) (*ImageBlock, error) {
+	b := &ImageBlock{
+		Hash:      fmt.Sprintf("%016x", hash),
+		MessageId: messageId,
+		UserId:    userId,
+		CreatedAt: time.Now(),
+	}
+	err := session.Database(ctx).RunInTransaction(ctx, nil, func(ctx context.Context, tx *sql.Tx) error {
+		query := durable.PrepareQuery("INSERT INTO image_blocklists (%s) VALUES (%s) ON CONFLICT (hash) DO NOTHING", imageBlocklistsCols)
+		_, err := tx.ExecContext(ctx, query, b.values()...)
+		if err != nil {
+			return err
+		}
+		return createAuditEventInTx(ctx, tx, userId, AuditActionBlockImage, messageId, "", nil, map[string]interface{}{"hash": b.Hash})
+	})
+	if err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	return b, nil
+}
+
+// matchImageBlocklist reports whether the hash is close enough to any blocked image.
+func matchImageBlocklist(ctx context.Context, hash uint64) (bool, error) {
+	rows, err := session.Database(ctx).QueryContext(ctx, "SELECT hash FROM image_blocklists")
+	if err != nil {
+		return false, session.TransactionError(ctx, err)
+	}
+	defer rows.Close()
+
+	distance := config.AppConfig().System.ImageHashDistance
+	for rows.Next() {
+		var h string
+		if err := rows.Scan(&h); err != nil {
+			return false, session.TransactionError(ctx, err)
+		}
+		blocked, err := strconv.ParseUint(h, 16, 64)
+		if err != nil {
+			continue
+		}
+		if utils.HammingDistance(hash, blocked) <= distance {
+			return true, nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return false, session.TransactionError(ctx, err)
+	}
+	return false, nil
+}
@@ -0,0 +1,76 @@
+package models
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+
+	bot "github.com/MixinNetwork/bot-api-go-client/v2"
+	"github.com/MixinNetwork/supergroup.mixin.one/config"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+	"github.com/MixinNetwork/supergroup.mixin.one/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImageBlocklistCRUD(t *testing.T) {
+	assert := assert.New(t)
+	ctx := setupTestContext()
+	defer teardownTestContext(ctx)
+
+	original, err := utils.DifferenceHash(testImage(t, 120, 80, false))
+	assert.Nil(err)
+	resized, err := utils.DifferenceHash(testImage(t, 240, 160, false))
+	assert.Nil(err)
+	flipped, err := utils.DifferenceHash(testImage(t, 120, 80, true))
+	assert.Nil(err)
+	assert.True(utils.HammingDistance(original, resized) <= 6)
+	assert.True(utils.HammingDistance(original, flipped) > 6)
+
+	system := &config.AppConfig().System
+	system.ImageHashDistance = 6
+	defer func() { system.ImageHashDistance = 0 }()
+
+	blocked, err := matchImageBlocklist(ctx, resized)
+	assert.Nil(err)
+	assert.False(blocked)
+	b, err := createImageBlock(ctx, original, bot.UuidNewV4().String(), bot.UuidNewV4().String())
+	assert.Nil(err)
+	assert.Len(b.Hash, 16)
+	b, err = createImageBlock(ctx, original, bot.UuidNewV4().String(), bot.UuidNewV4().String())
+	assert.Nil(err)
+	blocked, err = matchImageBlocklist(ctx, resized)
+	assert.Nil(err)
+	assert.True(blocked)
+	blocked, err = matchImageBlocklist(ctx, flipped)
+	assert.Nil(err)
+	assert.False(blocked)
+
+	user := &User{UserId: bot.UuidNewV4().String()}
+	_, err = user.CreateImageBlock(ctx, bot.UuidNewV4().String())
+	assert.NotNil(err)
+
+	admin := &User{UserId: config.AppConfig().System.OperatorList[0]}
+	assert.Nil(admin.quoteCommandFailed(ctx, "BLOCK", session.BadDataError(ctx)))
+	assert.Nil(admin.quoteCommandFailed(ctx, "BLOCK", session.ServerError(ctx, nil)))
+	assert.NotNil(admin.quoteCommandFailed(ctx, "BLOCK", session.TransactionError(ctx, nil)))
+}
+
+func testImage(t *testing.T, width, height int, flip bool) []byte {
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			v := (x*7/width*37 + y*5/height*23) % 256
+			if flip {
+				v = 255 - v
+			}
+			img.SetGray(x, y, color.Gray{Y: uint8(v)})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,208 @@
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
+	"fmt"
+	"strings"
+	"time"
+
+	number "github.com/MixinNetwork/go-number"
+	"github.com/MixinNetwork/supergroup.mixin.one/config"
+	"github.com/MixinNetwork/supergroup.mixin.one/durable"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+)
+
+// Invitation is an invite code created by a member or an admin, the users who
+// authorize the bot through it are attributed to it by users.invitation_code.
+// A discount of 1 joins the plan for free, a smaller one is taken off the
+// join intents of the plan.
+type Invitation struct {
+	Code      string
+	UserId    string
+	Plan      string
+	Discount  string
+	MaxUses   int64
+	Uses      int64
+	ExpiredAt time.Time
+	CreatedAt time.Time
+
+	Joined int64
+	Paid   int64
+}
+
+var invitationsCols = []string{"code", "user_id", "plan", "discount", "max_uses", "uses", "expired_at", "created_at"}
+
+func (i *Invitation) values() []interface{} {
+	return []interface{}{i.Code, i.UserId, i.Plan, i.Discount, i.MaxUses, i.Uses, i.ExpiredAt, i.CreatedAt}
+}
+
+func invitationFromRow(row durable.Row) (*Invitation, error) {
+	var i Invitation
+	err := row.Scan(&i.Code, &i.UserId, &i.Plan, &i.Discount, &i.MaxUses, &i.Uses, &i.ExpiredAt, &i.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return &i, err
+}
+
+// URL is the link of the invitation, the client keeps the code until the
+// OAuth finishes.
+func (i *Invitation) URL() string {
+	return config.AppConfig().Service.HTTPResourceHost + "/?invitation=" + i.Code
+}
+
+func (i *Invitation) available() bool {
+	if i.MaxUses > 0 && i.Uses >= i.MaxUses {
+		return false
+	}
+	return i.ExpiredAt.IsZero() || i.ExpiredAt.After(time.Now())
+}
+
+// CreateInvitation lets a member invite with the plan, zero max uses or expiry
+// means unlimited, only the admins with settings permission give a discount.
+func (current *User) CreateInvitation(ctx context.Context, planName, discount string, maxUses int64, expiredAt time.Time) (*Invitation, error) {
+	admin := current.Can(ctx, PermissionSettings)
+	if current.State != PaymentStatePaid && !admin {
+		return nil, session.ForbiddenError(ctx)
+	}
+	d := number.FromString(discount)
+	if d.Cmp(number.Zero()) < 0 || d.Cmp(number.FromString("1")) > 0 || maxUses < 0 {
+		return nil, session.BadDataError(ctx)
+	}
+	if !expiredAt.IsZero() && expiredAt.Before(time.Now()) {
+		return nil, session.BadDataError(ctx)
+	}
+	if planName != "" && FindMembershipPlan(planName) == nil {
+		return nil, session.BadDataError(ctx)
+	}
+	if d.Cmp(number.Zero()) > 0 {
+		if !admin {
+			return nil, session.ForbiddenError(ctx)
+		}
+		if planName == "" {
+			return nil, session.BadDataError(ctx)
+		}
+	}
+	code, err := generateInvitationCode()
+	if err != nil {
+		return nil, session.ServerError(ctx, err)
+	}
+	invitation := &Invitation{
+		Code:      code,
+		UserId:    current.UserId,
+		Plan:      planName,
+		Discount:  d.Persist(),
+		MaxUses:   maxUses,
+		ExpiredAt: expiredAt,
+		CreatedAt: time.Now(),
+	}
+	err = session.Database(ctx).RunInTransaction(ctx, nil, func(ctx context.Context, tx *sql.Tx) error {
+		query := durable.PrepareQuery("INSERT INTO invitations (%s) VALUES (%s)", invitationsCols)
+		_, err := tx.ExecContext(ctx, query, invitation.values()...)
+		if err != nil || d.Cmp(number.Zero()) == 0 {
+			return err
+		}
+		return createAuditEventInTx(ctx, tx, current.UserId, AuditActionInvite, code, "", nil, map[string]interface{}{"plan": planName, "discount": invitation.Discount})
+	})
+	if err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	return invitation, nil
+}
+
+func ReadInvitation(ctx context.Context, code string) (*Invitation, error) {
+	query := fmt.Sprintf("SELECT %s FROM invitations WHERE code=$1", strings.Join(invitationsCols, ","))
+	invitation, err := invitationFromRow(session.Database(ctx).QueryRowContext(ctx, query, code))
+	if err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	return invitation, nil
+}
+
+// Invitations lists the invitations of the user with how many users joined
+// through each and how many of them paid, the admins see all of them.
+func (current *User) Invitations(ctx context.Context) ([]*Invitation, error) {
+	cols := make([]string, len(invitationsCols))
+	for i, c := range invitationsCols {
+		cols[i] = "i." + c
+	}
+	query := fmt.Sprintf("SELECT %s,COUNT(u.user_id),COUNT(u.user_id) FILTER (WHERE u.state=$1) FROM invitations i LEFT JOIN users u ON u.invitation_code=i.code", strings.Join(cols, ","))
+	args := []interface{}{PaymentStatePaid}
+	if !current.Can(ctx, PermissionSettings) {
+		query += " WHERE i.user_id=$2"
+		args = append(args, current.UserId)
+	}
+	query += " GROUP BY i.code ORDER BY i.created_at DESC LIMIT 500"
+	rows, err := session.Database(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	defer rows.Close()
+
+	var invitations []*Invitation
+	for rows.Next() {
+		var i Invitation
+		err := rows.Scan(&i.Code, &i.UserId, &i.Plan, &i.Discount, &i.MaxUses, &i.Uses, &i.ExpiredAt, &i.CreatedAt, &i.Joined, &i.Paid)
+		if err != nil {
+			return nil, session.TransactionError(ctx, err)
+		}
+		invitations = append(invitations, &i)
+	}
+	return invitations, nil
+}
+
+// acceptInvitation attributes a new user to the invitation if it's still
+// available, and pays the plan of a free invitation.
+func (user *User) acceptInvitation(ctx context.Context, code string) error {
+	err := session.Database(ctx).RunInTransaction(ctx, nil, func(ctx context.Context, tx *sql.Tx) error {
+		query := fmt.Sprintf("SELECT %s FROM invitations WHERE code=$1 FOR UPDATE", strings.Join(invitationsCols, ","))
+		invitation, err := invitationFromRow(tx.QueryRowContext(ctx, query, code))
+		if err != nil || invitation == nil || !invitation.available() || invitation.UserId == user.UserId {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, "UPDATE invitations SET uses=uses+1 WHERE code=$1", code)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, "UPDATE users SET invitation_code=$1 WHERE user_id=$2", code, user.UserId)
+		if err != nil {
+			return err
+		}
+		user.InvitationCode = code
+		plan := FindMembershipPlan(invitation.Plan)
+		if plan == nil || !number.FromString(invitation.Discount).Equal(number.FromString("1")) {
+			return nil
+		}
+		return user.paymentInTx(ctx, tx, PayMethodInvitation, membershipPaidUntil(time.Now(), plan.Duration))
+	})
+	if err != nil {
+		return session.TransactionError(ctx, err)
+	}
+	return nil
+}
+
+// invitationAmount takes the discount of the invitation the pending user came
+// through off the amount of its plan.
+func (user *User) invitationAmount(ctx context.Context, plan *config.MembershipPlan, amount string) (string, error) {
+	if user.InvitationCode == "" || !user.Joinable() {
+		return amount, nil
+	}
+	invitation, err := ReadInvitation(ctx, user.InvitationCode)
+	if err != nil || invitation == nil || invitation.Plan != plan.Name {
+		return amount, err
+	}
+	off := number.FromString("1").Sub(number.FromString(invitation.Discount))
+	return number.FromString(amount).Mul(off).RoundCeil(8).Persist(), nil
+}
+
+func generateInvitationCode() (string, error) {
+	b := make([]byte, 5)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return strings.ToLower(base32.StdEncoding.EncodeToString(b)), nil
+}
@@ -0,0 +1,95 @@
+package models
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	bot "github.com/MixinNetwork/bot-api-go-client/v2"
+	"github.com/MixinNetwork/supergroup.mixin.one/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInvitationCRUD(t *testing.T) {
+	assert := assert.New(t)
+	ctx := setupTestContext()
+	defer teardownTestContext(ctx)
+
+	assetId := bot.UuidNewV4().String()
+	system := config.AppConfig().System
+	defer func() { config.AppConfig().System = system }()
+	config.AppConfig().System.MembershipPlanList = []config.MembershipPlan{
+		{Name: "monthly", Duration: 2592000, Prices: []config.PaymentAsset{{Symbol: "XIN", AssetId: assetId, Amount: "0.01"}}},
+	}
+
+	var users []*User
+	for i := 0; i < 4; i++ {
+		pub, priv, err := ed25519.GenerateKey(rand.Reader)
+		assert.Nil(err)
+		public := base64.RawURLEncoding.EncodeToString(pub)
+		private := base64.RawURLEncoding.EncodeToString(priv)
+		user, err := createUser(ctx, public, private, bot.UuidNewV4().String(), "", bot.UuidNewV4().String(), "1000", "name", "http://localhost")
+		assert.Nil(err)
+		users = append(users, user)
+	}
+	member, invitee, friend, other := users[0], users[1], users[2], users[3]
+	admin := &User{UserId: config.AppConfig().System.OperatorList[0]}
+
+	_, err := member.CreateInvitation(ctx, "", "0", 0, time.Time{})
+	assert.NotNil(err)
+	paid, err := member.PayMembership(ctx, "", FindMembershipPlan("monthly"), "", "")
+	assert.Nil(err)
+	assert.True(paid)
+	_, err = member.CreateInvitation(ctx, "monthly", "0.5", 0, time.Time{})
+	assert.NotNil(err)
+	_, err = member.CreateInvitation(ctx, "", "0", 0, time.Now().Add(-time.Hour))
+	assert.NotNil(err)
+	_, err = admin.CreateInvitation(ctx, "", "0.5", 0, time.Time{})
+	assert.NotNil(err)
+	_, err = admin.CreateInvitation(ctx, "monthly", "1.5", 0, time.Time{})
+	assert.NotNil(err)
+
+	invitation, err := member.CreateInvitation(ctx, "", "0", 1, time.Time{})
+	assert.Nil(err)
+	assert.Len(invitation.Code, 8)
+	assert.Contains(invitation.URL(), "invitation="+invitation.Code)
+	assert.Nil(invitee.acceptInvitation(ctx, invitation.Code))
+	assert.Equal(invitation.Code, invitee.InvitationCode)
+	assert.Nil(other.acceptInvitation(ctx, invitation.Code))
+	assert.Equal("", other.InvitationCode)
+	invitee, err = FindUser(ctx, invitee.UserId)
+	assert.Nil(err)
+	assert.Equal(invitation.Code, invitee.InvitationCode)
+	assert.Equal(PaymentStatePending, invitee.State)
+
+	discounted, err := admin.CreateInvitation(ctx, "monthly", "0.5", 0, time.Time{})
+	assert.Nil(err)
+	assert.Nil(other.acceptInvitation(ctx, discounted.Code))
+	intent, err := other.CreatePaymentIntent(ctx, PaymentIntentActionJoin, "", "monthly", assetId, "")
+	assert.Nil(err)
+	assert.Equal("0.005", intent.Amount)
+	intent, err = invitee.CreatePaymentIntent(ctx, PaymentIntentActionJoin, "", "monthly", assetId, "")
+	assert.Nil(err)
+	assert.Equal("0.01", intent.Amount)
+
+	free, err := admin.CreateInvitation(ctx, "monthly", "1", 0, time.Now().Add(time.Hour))
+	assert.Nil(err)
+	assert.Nil(friend.acceptInvitation(ctx, free.Code))
+	assert.Equal(PaymentStatePaid, friend.State)
+	assert.Equal(PayMethodInvitation, friend.PayMethod)
+	assert.True(friend.PaidUntil.After(time.Now().Add(29 * 24 * time.Hour)))
+
+	invitations, err := member.Invitations(ctx)
+	assert.Nil(err)
+	assert.Len(invitations, 1)
+	assert.Equal(int64(1), invitations[0].Uses)
+	assert.Equal(int64(1), invitations[0].Joined)
+	assert.Equal(int64(0), invitations[0].Paid)
+	invitations, err = admin.Invitations(ctx)
+	assert.Nil(err)
+	assert.Len(invitations, 3)
+	assert.Equal(free.Code, invitations[0].Code)
+	assert.Equal(int64(1), invitations[0].Paid)
+}
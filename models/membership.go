@@ -0,0 +1,209 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+
+	number "github.com/MixinNetwork/go-number"
+	"github.com/MixinNetwork/supergroup.mixin.one/config"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+)
+
+// FindMembershipPlan returns the plan by name, nil if not found.
+func FindMembershipPlan(name string) *config.MembershipPlan {
+	for _, plan := range config.MembershipPlans() {
+		if plan.Name == name {
+			return &plan
+		}
+	}
+	return nil
+}
+
+// MatchMembershipPlan finds the plan priced at exactly the amount of the asset.
+func MatchMembershipPlan(assetId, amount string) *config.MembershipPlan {
+	for _, plan := range config.MembershipPlans() {
+		for _, asset := range plan.Prices {
+			if asset.AssetId == assetId && number.FromString(amount).Equal(number.FromString(asset.Amount).RoundFloor(8)) {
+				return &plan
+			}
+		}
+	}
+	return nil
+}
+
+// membershipFee is the price of the plan in the asset, the referral share is
+// paid on it instead of the amount received. A plan not priced in the asset,
+// e.g. priced in USD, falls back to the amount.
+func membershipFee(plan *config.MembershipPlan, assetId, amount string) string {
+	for _, asset := range plan.Prices {
+		if asset.AssetId == assetId {
+			return number.FromString(asset.Amount).RoundFloor(8).Persist()
+		}
+	}
+	return amount
+}
+
+// PayMembership lets a pending user join with the plan, or renews a paid one
+// from the current paid_until, a lifetime plan clears paid_until. It returns
+// false if nothing was paid, e.g. the user is banned or a lifetime member.
+// The referrer of a joining user is rewarded with a share of the plan price in
+// the asset paid.
+func (user *User) PayMembership(ctx context.Context, snapshotId string, plan *config.MembershipPlan, assetId, amount string) (bool, error) {
+	var paid bool
+	err := session.Database(ctx).RunInTransaction(ctx, nil, func(ctx context.Context, tx *sql.Tx) error {
+		var err error
+		paid, err = user.payMembershipInTx(ctx, tx, plan, assetId, membershipFee(plan, assetId, amount))
+		if err != nil || !paid {
+			return err
+		}
+		return resolveSnapshotInTx(ctx, tx, snapshotId, SnapshotPurposeMembership)
+	})
+	if err != nil {
+		if sessionErr, ok := err.(session.Error); ok {
+			return false, sessionErr
+		}
+		return false, session.TransactionError(ctx, err)
+	}
+	return paid, nil
+}
+
+// payMembershipInTx pays the plan for the user, the fee is the price matched
+// by the payment and the referral share is computed on it.
+func (user *User) payMembershipInTx(ctx context.Context, tx *sql.Tx, plan *config.MembershipPlan, assetId, fee string) (bool, error) {
+	current, err := findUserById(ctx, tx, user.UserId)
+	if err != nil || current == nil {
+		return false, err
+	}
+	var paid bool
+	if current.Joinable() {
+		err = current.paymentInTx(ctx, tx, PayMethodMixin, membershipPaidUntil(time.Now(), plan.Duration))
+		paid = current.State == PaymentStatePaid
+		if err == nil && paid {
+			err = current.createReferralInTx(ctx, tx, assetId, fee)
+		}
+	} else if current.State == PaymentStatePaid && !current.PaidUntil.IsZero() {
+		current.PaidUntil = membershipPaidUntil(current.PaidUntil, plan.Duration)
+		_, err = tx.ExecContext(ctx, "UPDATE users SET paid_until=$1 WHERE user_id=$2", current.PaidUntil, current.UserId)
+		paid = true
+	}
+	if err != nil {
+		return false, err
+	}
+	*user = *current
+	return paid, nil
+}
+
+// membershipPaidUntil extends the membership by duration seconds from the later
+// of from and now, zero duration means lifetime.
+func membershipPaidUntil(from time.Time, duration int64) time.Time {
+	if duration <= 0 {
+		return time.Time{}
+	}
+	if from.Before(time.Now()) {
+		from = time.Now()
+	}
+	return from.Add(time.Duration(duration) * time.Second)
+}
+
+// LoopMembershipReminders tells the members and trial users expiring within
+// membership_reminder to pay, once for every paid_until.
+func LoopMembershipReminders(ctx context.Context) (int64, error) {
+	reminder := time.Duration(config.AppConfig().System.MembershipReminder) * time.Second
+	if reminder <= 0 {
+		return 0, nil
+	}
+	var count int64
+	err := session.Database(ctx).RunInTransaction(ctx, nil, func(ctx context.Context, tx *sql.Tx) error {
+		query := fmt.Sprintf("SELECT %s FROM users WHERE state IN ($1,$2) AND paid_until>$3 AND paid_until<$4 AND reminded_at<paid_until-$5::INTERVAL LIMIT 100", strings.Join(usersCols, ","))
+		users, err := findUsersByQueryInTx(ctx, tx, query, PaymentStatePaid, PaymentStateTrial, time.Time{}, time.Now().Add(reminder), fmt.Sprintf("%d seconds", int64(reminder.Seconds())))
+		if err != nil {
+			return err
+		}
+		for _, user := range users {
+			_, err = tx.ExecContext(ctx, "UPDATE users SET reminded_at=$1 WHERE user_id=$2", time.Now(), user.UserId)
+			if err != nil {
+				return err
+			}
+			tips := config.AppConfig().MessageTemplate.MessageTipsExpiring
+			if user.State == PaymentStateTrial {
+				tips = config.AppConfig().MessageTemplate.MessageTipsTrialEnding
+			}
+			tips = fmt.Sprintf(tips, user.PaidUntil.Format("2006-01-02 15:04"))
+			data := base64.RawURLEncoding.EncodeToString([]byte(tips))
+			err = createSystemDistributedMessageInTx(ctx, tx, user, MessageCategoryPlainText, data)
+			if err != nil {
+				return err
+			}
+		}
+		count = int64(len(users))
+		return nil
+	})
+	if err != nil {
+		return 0, session.TransactionError(ctx, err)
+	}
+	return count, nil
+}
+
+// LoopExpiredMemberships moves the lapsed members and trial users back to
+// pending, they stop receiving messages until they pay. A user renewed since
+// the select is left as it is.
+func LoopExpiredMemberships(ctx context.Context) (int64, error) {
+	var count int64
+	err := session.Database(ctx).RunInTransaction(ctx, nil, func(ctx context.Context, tx *sql.Tx) error {
+		query := fmt.Sprintf("SELECT %s FROM users WHERE state IN ($1,$2) AND paid_until>$3 AND paid_until<$4 LIMIT 100", strings.Join(usersCols, ","))
+		now := time.Now()
+		users, err := findUsersByQueryInTx(ctx, tx, query, PaymentStatePaid, PaymentStateTrial, time.Time{}, now)
+		if err != nil {
+			return err
+		}
+		for _, user := range users {
+			query := "UPDATE users SET (state,subscribed_at)=($1,$2) WHERE user_id=$3 AND state=$4 AND paid_until<$5"
+			r, err := tx.ExecContext(ctx, query, PaymentStatePending, time.Time{}, user.UserId, user.State, now)
+			if err != nil {
+				return err
+			}
+			if n, err := r.RowsAffected(); err != nil {
+				return err
+			} else if n == 0 {
+				continue
+			}
+			tips := config.AppConfig().MessageTemplate.MessageTipsExpired
+			if user.State == PaymentStateTrial {
+				tips = config.AppConfig().MessageTemplate.MessageTipsTrialEnded
+			}
+			data := base64.RawURLEncoding.EncodeToString([]byte(tips))
+			err = createSystemDistributedMessageInTx(ctx, tx, user, MessageCategoryPlainText, data)
+			if err != nil {
+				return err
+			}
+		}
+		count = int64(len(users))
+		return nil
+	})
+	if err != nil {
+		return 0, session.TransactionError(ctx, err)
+	}
+	return count, nil
+}
+
+func findUsersByQueryInTx(ctx context.Context, tx *sql.Tx, query string, args ...interface{}) ([]*User, error) {
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []*User
+	for rows.Next() {
+		u, err := userFromRow(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
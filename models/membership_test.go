@@ -0,0 +1,183 @@
+package models
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	bot "github.com/MixinNetwork/bot-api-go-client/v2"
+	"github.com/MixinNetwork/supergroup.mixin.one/config"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMembershipCRUD(t *testing.T) {
+	assert := assert.New(t)
+	ctx := setupTestContext()
+	defer teardownTestContext(ctx)
+
+	assetId := bot.UuidNewV4().String()
+	plans, reminder := config.AppConfig().System.MembershipPlanList, config.AppConfig().System.MembershipReminder
+	config.AppConfig().System.MembershipPlanList = []config.MembershipPlan{
+		{Name: "monthly", Duration: 2592000, Prices: []config.PaymentAsset{{Symbol: "XIN", AssetId: assetId, Amount: "0.001"}}},
+		{Name: "lifetime", Duration: 0, Prices: []config.PaymentAsset{{Symbol: "XIN", AssetId: assetId, Amount: "0.05"}}},
+	}
+	config.AppConfig().System.MembershipReminder = 259200
+	defer func() {
+		config.AppConfig().System.MembershipPlanList, config.AppConfig().System.MembershipReminder = plans, reminder
+	}()
+
+	assert.Nil(MatchMembershipPlan(assetId, "0.002"))
+	assert.Nil(MatchMembershipPlan(bot.UuidNewV4().String(), "0.001"))
+	monthly := MatchMembershipPlan(assetId, "0.001")
+	assert.NotNil(monthly)
+	assert.Equal("monthly", monthly.Name)
+	lifetime := MatchMembershipPlan(assetId, "0.05")
+	assert.NotNil(lifetime)
+	assert.Equal("lifetime", lifetime.Name)
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(err)
+	public := base64.RawURLEncoding.EncodeToString(pub)
+	private := base64.RawURLEncoding.EncodeToString(priv)
+	user, err := createUser(ctx, public, private, bot.UuidNewV4().String(), "", bot.UuidNewV4().String(), "1000", "name", "http://localhost")
+	assert.Nil(err)
+	assert.NotNil(user)
+	assert.Equal(PaymentStatePending, user.State)
+
+	paid, err := user.PayMembership(ctx, "", monthly, "", "")
+	assert.Nil(err)
+	assert.True(paid)
+	assert.Equal(PaymentStatePaid, user.State)
+	assert.True(user.PaidUntil.After(time.Now().Add(29 * 24 * time.Hour)))
+	paidUntil := user.PaidUntil
+	paid, err = user.PayMembership(ctx, "", monthly, "", "")
+	assert.Nil(err)
+	assert.True(paid)
+	user, err = FindUser(ctx, user.UserId)
+	assert.Nil(err)
+	assert.Equal(PaymentStatePaid, user.State)
+	assert.True(user.PaidUntil.Sub(paidUntil) > 29*24*time.Hour)
+
+	count, err := LoopMembershipReminders(ctx)
+	assert.Nil(err)
+	assert.Equal(int64(0), count)
+	_, err = session.Database(ctx).Exec("UPDATE users SET paid_until=$1 WHERE user_id=$2", time.Now().Add(time.Hour), user.UserId)
+	assert.Nil(err)
+	count, err = LoopMembershipReminders(ctx)
+	assert.Nil(err)
+	assert.Equal(int64(1), count)
+	count, err = LoopMembershipReminders(ctx)
+	assert.Nil(err)
+	assert.Equal(int64(0), count)
+	count, err = LoopExpiredMemberships(ctx)
+	assert.Nil(err)
+	assert.Equal(int64(0), count)
+
+	_, err = session.Database(ctx).Exec("UPDATE users SET paid_until=$1 WHERE user_id=$2", time.Now().Add(-time.Hour), user.UserId)
+	assert.Nil(err)
+	users, err := subscribedUsers(ctx, genesisStartedAt(), 100, "")
+	assert.Nil(err)
+	assert.Len(users, 1)
+	count, err = LoopExpiredMemberships(ctx)
+	assert.Nil(err)
+	assert.Equal(int64(1), count)
+	user, err = FindUser(ctx, user.UserId)
+	assert.Nil(err)
+	assert.Equal(PaymentStatePending, user.State)
+	users, err = subscribedUsers(ctx, genesisStartedAt(), 100, "")
+	assert.Nil(err)
+	assert.Len(users, 0)
+
+	paid, err = user.PayMembership(ctx, "", lifetime, "", "")
+	assert.Nil(err)
+	assert.True(paid)
+	assert.Equal(PaymentStatePaid, user.State)
+	assert.True(user.PaidUntil.IsZero())
+	paid, err = user.PayMembership(ctx, "", monthly, "", "")
+	assert.Nil(err)
+	assert.False(paid)
+	assert.True(user.PaidUntil.IsZero())
+	count, err = LoopExpiredMemberships(ctx)
+	assert.Nil(err)
+	assert.Equal(int64(0), count)
+}
+
+func TestTrialMembership(t *testing.T) {
+	assert := assert.New(t)
+	ctx := setupTestContext()
+	defer teardownTestContext(ctx)
+
+	assetId := bot.UuidNewV4().String()
+	system := config.AppConfig().System
+	defer func() { config.AppConfig().System = system }()
+	config.AppConfig().System.MembershipPlanList = []config.MembershipPlan{
+		{Name: "monthly", Duration: 2592000, Prices: []config.PaymentAsset{{Symbol: "XIN", AssetId: assetId, Amount: "0.001"}}},
+	}
+	config.AppConfig().System.MembershipReminder = 86400
+	config.AppConfig().System.TrialDuration = 259200
+
+	var users []*User
+	for i := 0; i < 2; i++ {
+		pub, priv, err := ed25519.GenerateKey(rand.Reader)
+		assert.Nil(err)
+		public := base64.RawURLEncoding.EncodeToString(pub)
+		private := base64.RawURLEncoding.EncodeToString(priv)
+		user, err := createUser(ctx, public, private, bot.UuidNewV4().String(), "", bot.UuidNewV4().String(), "1000", "name", "http://localhost")
+		assert.Nil(err)
+		assert.Equal(PaymentStateTrial, user.State)
+		assert.Equal(PayMethodTrial, user.PayMethod)
+		assert.True(user.Joinable())
+		users = append(users, user)
+	}
+	user, other := users[0], users[1]
+	assert.True(user.PaidUntil.After(time.Now().Add(71 * time.Hour)))
+	subscribers, err := subscribedUsers(ctx, genesisStartedAt(), 100, "")
+	assert.Nil(err)
+	assert.Len(subscribers, 2)
+	_, err = user.ClaimPacket(ctx, bot.UuidNewV4().String())
+	assert.NotNil(err)
+
+	paid, err := user.PayMembership(ctx, "", FindMembershipPlan("monthly"), "", "")
+	assert.Nil(err)
+	assert.True(paid)
+	assert.Equal(PaymentStatePaid, user.State)
+	assert.Equal(PayMethodMixin, user.PayMethod)
+	assert.True(user.PaidUntil.After(time.Now().Add(29 * 24 * time.Hour)))
+
+	count, err := LoopMembershipReminders(ctx)
+	assert.Nil(err)
+	assert.Equal(int64(0), count)
+	_, err = session.Database(ctx).Exec("UPDATE users SET paid_until=$1 WHERE user_id=$2", time.Now().Add(time.Hour), other.UserId)
+	assert.Nil(err)
+	count, err = LoopMembershipReminders(ctx)
+	assert.Nil(err)
+	assert.Equal(int64(1), count)
+	_, err = session.Database(ctx).Exec("UPDATE users SET paid_until=$1 WHERE user_id=$2", time.Now().Add(-time.Hour), other.UserId)
+	assert.Nil(err)
+	count, err = LoopExpiredMemberships(ctx)
+	assert.Nil(err)
+	assert.Equal(int64(1), count)
+	other, err = FindUser(ctx, other.UserId)
+	assert.Nil(err)
+	assert.Equal(PaymentStatePending, other.State)
+	subscribers, err = subscribedUsers(ctx, genesisStartedAt(), 100, "")
+	assert.Nil(err)
+	assert.Len(subscribers, 1)
+
+	_, err = session.Database(ctx).Exec("DELETE FROM users WHERE user_id=$1", other.UserId)
+	assert.Nil(err)
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(err)
+	public := base64.RawURLEncoding.EncodeToString(pub)
+	private := base64.RawURLEncoding.EncodeToString(priv)
+	other, err = createUser(ctx, public, private, bot.UuidNewV4().String(), "", other.UserId, "1000", "name", "http://localhost")
+	assert.Nil(err)
+	assert.Equal(PaymentStatePending, other.State)
+	assert.True(other.PaidUntil.IsZero())
+	other, err = FindUser(ctx, other.UserId)
+	assert.Nil(err)
+	assert.Equal(PaymentStatePending, other.State)
+}
@@ -10,6 +10,7 @@ import (
 	"encoding/binary"
 	"encoding/json"
 	"fmt"
+	"math"
 	"math/rand"
 	"strings"
 	"time"
@@ -21,11 +22,13 @@ import (
 	"github.com/MixinNetwork/supergroup.mixin.one/session"
 	"github.com/gofrs/uuid"
 	"golang.org/x/crypto/curve25519"
+	"mvdan.cc/xurls"
 )
 
 const (
-	MessageStatePending = "pending"
-	MessageStateSuccess = "success"
+	MessageStatePending    = "pending"
+	MessageStateInspecting = "inspecting"
+	MessageStateSuccess    = "success"
 
 	MessageCategoryPlainText           = "PLAIN_TEXT"
 	MessageCategoryPlainImage          = "PLAIN_IMAGE"
@@ -115,14 +118,14 @@ func CreateMessage(ctx context.Context, user *User, messageId, category, quoteMe
 	default:
 		return nil, nil
 	}
-	if !user.isAdmin() && user.UserId != config.AppConfig.Mixin.ClientId {
+	if !user.Can(ctx, PermissionBroadcast) && user.UserId != config.AppConfig().Mixin.ClientId {
 		b, err := ReadProhibitedProperty(ctx)
 		if err != nil {
 			return nil, err
 		} else if b {
 			return nil, nil
 		}
-		system := config.AppConfig.System
+		system := config.AppConfig().System
 		switch category {
 		case MessageCategoryPlainImage, MessageCategoryEncryptedImage:
 			if !system.ImageMessageEnable {
@@ -149,10 +152,27 @@ func CreateMessage(ctx context.Context, user *User, messageId, category, quoteMe
 		switch category {
 		case MessageCategoryMessageRecall:
 		default:
-			if !durable.Allow(user.UserId) {
-				text := base64.RawURLEncoding.EncodeToString([]byte(config.AppConfig.MessageTemplate.MessageTipsTooMany))
-				err = CreateSystemDistributedMessage(ctx, user, MessageCategoryPlainText, text)
+			mute, err := ReadActiveMute(ctx, user.UserId)
+			if err != nil {
+				return nil, err
+			} else if mute != nil {
+				tips := fmt.Sprintf(config.AppConfig().MessageTemplate.MessageTipsMuted, mute.ExpiredAt.Format("2006-01-02 15:04"))
+				text := base64.RawURLEncoding.EncodeToString([]byte(tips))
+				return nil, CreateSystemDistributedMessage(ctx, user, MessageCategoryPlainText, text)
+			}
+			if wait, err := takeSlowModeRate(ctx, user); err != nil {
+				return nil, err
+			} else if wait > 0 {
+				seconds := int64(math.Ceil(wait.Seconds()))
+				tips := fmt.Sprintf(config.AppConfig().MessageTemplate.MessageTipsSlowMode, seconds)
+				text := base64.RawURLEncoding.EncodeToString([]byte(tips))
+				return nil, CreateSystemDistributedMessage(ctx, user, MessageCategoryPlainText, text)
+			}
+			if wait, err := takeMessageRate(ctx, user, category); err != nil {
 				return nil, err
+			} else if wait > 0 {
+				text := base64.RawURLEncoding.EncodeToString([]byte(config.AppConfig().MessageTemplate.MessageTipsTooMany))
+				return nil, CreateSystemDistributedMessage(ctx, user, MessageCategoryPlainText, text)
 			}
 		}
 	}
@@ -169,7 +189,7 @@ func CreateMessage(ctx context.Context, user *User, messageId, category, quoteMe
 		MessageCategoryEncryptedContact,
 		MessageCategoryEncryptedTranscript,
 		MessageCategoryEncryptedLocation:
-		mixin := config.AppConfig.Mixin
+		mixin := config.AppConfig().Mixin
 		var err error
 		data, err = bot.DecryptMessageData(data, mixin.SessionId, mixin.SessionKey)
 		if err != nil || data == "" {
@@ -177,7 +197,22 @@ func CreateMessage(ctx context.Context, user *User, messageId, category, quoteMe
 		}
 	}
 
-	if user.isAdmin() && quoteMessageId != "" {
+	if user.InProbation() && !user.Can(ctx, PermissionBroadcast) {
+		if !probationMessageAllowed(category, data) {
+			text := base64.RawURLEncoding.EncodeToString([]byte(config.AppConfig().MessageTemplate.MessageTipsProbation))
+			return nil, CreateSystemDistributedMessage(ctx, user, MessageCategoryPlainText, text)
+		}
+		if category != MessageCategoryMessageRecall {
+			if wait, err := takeProbationRate(ctx, user); err != nil {
+				return nil, err
+			} else if wait > 0 {
+				text := base64.RawURLEncoding.EncodeToString([]byte(config.AppConfig().MessageTemplate.MessageTipsTooMany))
+				return nil, CreateSystemDistributedMessage(ctx, user, MessageCategoryPlainText, text)
+			}
+		}
+	}
+
+	if quoteMessageId != "" && isProtected(ctx, user.UserId) {
 		switch category {
 		case MessageCategoryPlainText, MessageCategoryEncryptedText:
 			if id, _ := bot.UuidFromString(quoteMessageId); id.String() == quoteMessageId {
@@ -185,23 +220,62 @@ func CreateMessage(ctx context.Context, user *User, messageId, category, quoteMe
 				if err != nil {
 					return nil, err
 				}
-				upper := strings.ToUpper(strings.TrimSpace(string(bytes)))
+				text := strings.TrimSpace(string(bytes))
+				upper := strings.ToUpper(text)
+				var duration time.Duration
+				var reason string
+				if fields := strings.Fields(upper); len(fields) == 2 && (fields[0] == "MUTE" || fields[0] == "BAN") {
+					if duration, err = ParseDuration(fields[1]); err == nil && duration > 0 {
+						upper = fields[0]
+					}
+				}
+				if fields := strings.Fields(upper); len(fields) > 0 && fields[0] == "WARN" {
+					upper, reason = "WARN", strings.TrimSpace(text[len("WARN"):])
+				}
+				if !user.Can(ctx, quoteCommandPermissions[upper]) {
+					upper = ""
+				}
 				switch upper {
-				case "BAN", "KICK", "DELETE", "REMOVE":
+				case "WARN":
+					dm, err := FindDistributedMessage(ctx, quoteMessageId)
+					if err != nil || dm == nil {
+						return nil, err
+					}
+					_, err = user.CreateWarning(ctx, dm.UserId, reason, dm.ParentId)
+					if err != nil {
+						return nil, user.quoteCommandFailed(ctx, upper, err)
+					}
+					return nil, nil
+				case "BAN", "KICK", "DELETE", "REMOVE", "BLOCK", "MUTE":
+					if upper == "MUTE" && duration <= 0 {
+						return nil, user.quoteCommandFailed(ctx, upper, session.BadDataError(ctx))
+					}
 					dm, err := FindDistributedMessage(ctx, quoteMessageId)
 					if err != nil || dm == nil {
 						return nil, err
 					}
+					if upper == "MUTE" {
+						_, err = user.CreateMute(ctx, dm.UserId, duration)
+						if err != nil {
+							return nil, user.quoteCommandFailed(ctx, upper, err)
+						}
+					}
 					if upper == "BAN" {
-						_, err = user.CreateBlacklist(ctx, dm.UserId)
+						_, err = user.CreateBlacklist(ctx, dm.UserId, "", dm.ParentId, duration)
 						if err != nil {
-							return nil, err
+							return nil, user.quoteCommandFailed(ctx, upper, err)
 						}
 					}
 					if upper == "KICK" {
 						err = user.DeleteUser(ctx, dm.UserId)
 						if err != nil {
-							return nil, err
+							return nil, user.quoteCommandFailed(ctx, upper, err)
+						}
+					}
+					if upper == "BLOCK" {
+						_, err = user.CreateImageBlock(ctx, dm.ParentId)
+						if err != nil {
+							return nil, user.quoteCommandFailed(ctx, upper, err)
 						}
 					}
 					quoteMessageId = ""
@@ -236,6 +310,7 @@ func CreateMessage(ctx context.Context, user *User, messageId, category, quoteMe
 			}
 		}
 	}
+	var recalled *Message
 	if category == MessageCategoryMessageRecall {
 		bytes, err := base64.RawURLEncoding.DecodeString(data)
 		if err != nil {
@@ -250,30 +325,81 @@ func CreateMessage(ctx context.Context, user *User, messageId, category, quoteMe
 		if err != nil || m == nil {
 			return nil, err
 		}
-		if m.UserId != user.UserId && !user.isAdmin() {
+		canRecall := user.Can(ctx, PermissionRecall)
+		if m.UserId != user.UserId && !canRecall {
 			return nil, nil
 		}
-		if user.isAdmin() {
+		if canRecall {
 			message.UserId = m.UserId
 		}
+		if m.UserId != user.UserId {
+			recalled = m
+		}
 	}
-	query := durable.PrepareQuery("INSERT INTO messages (%s) VALUES (%s) ON CONFLICT (message_id) DO NOTHING", messagesCols)
-	_, err := session.Database(ctx).ExecContext(ctx, query, message.values()...)
+	err := session.Database(ctx).RunInTransaction(ctx, nil, func(ctx context.Context, tx *sql.Tx) error {
+		query := durable.PrepareQuery("INSERT INTO messages (%s) VALUES (%s) ON CONFLICT (message_id) DO NOTHING", messagesCols)
+		_, err := tx.ExecContext(ctx, query, message.values()...)
+		if err != nil || recalled == nil {
+			return err
+		}
+		before := map[string]interface{}{"user_id": recalled.UserId, "category": recalled.Category, "created_at": recalled.CreatedAt}
+		return createAuditEventInTx(ctx, tx, user.UserId, AuditActionRecall, recalled.MessageId, "", before, nil)
+	})
 	if err != nil {
 		return nil, session.TransactionError(ctx, err)
 	}
 	return message, nil
 }
 
+// quoteCommandFailed tells the operator why the quote command didn't apply, a
+// bad command or a failed fetch is not retried, so the message is acknowledged
+// instead of blocking the group, only the transaction errors are returned.
+func (user *User) quoteCommandFailed(ctx context.Context, command string, err error) error {
+	reason := err.Error()
+	if se, ok := err.(session.Error); ok {
+		if se.Code == 10001 {
+			return err
+		}
+		reason = se.Description
+	}
+	session.Logger(ctx).Errorf("quote command %s ERROR: %+v", command, err)
+	data := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%s failed, %s", command, reason)))
+	return CreateSystemDistributedMessage(ctx, user, MessageCategoryPlainText, data)
+}
+
+var quoteCommandPermissions = map[string]string{
+	"BAN":    PermissionBan,
+	"KICK":   PermissionBan,
+	"DELETE": PermissionRecall,
+	"REMOVE": PermissionRecall,
+	"BLOCK":  PermissionRecall,
+	"MUTE":   PermissionMute,
+	"WARN":   PermissionMute,
+}
+
+func probationMessageAllowed(category, data string) bool {
+	switch category {
+	case MessageCategoryMessageRecall:
+		return true
+	case MessageCategoryPlainText, MessageCategoryEncryptedText:
+		bytes, err := base64.RawURLEncoding.DecodeString(data)
+		if err != nil {
+			return false
+		}
+		return !xurls.Relaxed.Match(bytes)
+	}
+	return false
+}
+
 func createSystemRewardMessage(ctx context.Context, tx *sql.Tx, r *Reward, user, receipt *User, asset *Asset) error {
-	label := fmt.Sprintf(config.AppConfig.MessageTemplate.MessageRewardLabel, user.FullName, receipt.FullName, r.Amount, asset.Symbol)
+	label := fmt.Sprintf(config.AppConfig().MessageTemplate.MessageRewardLabel, user.FullName, receipt.FullName, r.Amount, asset.Symbol)
 	if utf8.RuneCountInString(label) > 36 {
-		label = fmt.Sprintf(config.AppConfig.MessageTemplate.MessageRewardLabel, FirstNStringInRune(user.FullName, 5), FirstNStringInRune(receipt.FullName, 5), r.Amount, asset.Symbol)
+		label = fmt.Sprintf(config.AppConfig().MessageTemplate.MessageRewardLabel, FirstNStringInRune(user.FullName, 5), FirstNStringInRune(receipt.FullName, 5), r.Amount, asset.Symbol)
 	}
 	if utf8.RuneCountInString(label) > 36 {
 		label = fmt.Sprintf(FirstNStringInRune(label, 30))
 	}
-	action := config.AppConfig.Service.HTTPResourceHost + "/broadcasters"
+	action := config.AppConfig().Service.HTTPResourceHost + "/broadcasters"
 	colors := []string{"#AA4848", "#B0665E", "#EF8A44", "#A09555", "#727234", "#9CAD23", "#AA9100", "#C49B4B", "#A47758", "#DF694C", "#D65859", "#C2405A", "#A75C96", "#BD637C", "#8F7AC5", "#7983C2", "#728DB8", "#5977C2", "#5E6DA2", "#3D98D0", "#5E97A1"}
 	btns, err := json.Marshal([]interface{}{map[string]string{
 		"label":  label,
@@ -288,12 +414,12 @@ func createSystemRewardMessage(ctx context.Context, tx *sql.Tx, r *Reward, user,
 }
 
 func createSystemJoinMessage(ctx context.Context, tx *sql.Tx, user *User) error {
-	data := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(config.AppConfig.MessageTemplate.MessageTipsJoin, user.FullName)))
+	data := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(config.AppConfig().MessageTemplate.MessageTipsJoin, user.FullName)))
 	return createSystemMessage(ctx, tx, MessageCategoryPlainText, data)
 }
 
 func createSystemMessage(ctx context.Context, tx *sql.Tx, category, data string) error {
-	mixin := config.AppConfig.Mixin
+	mixin := config.AppConfig().Mixin
 	t := time.Now()
 	message := &Message{
 		MessageId:        bot.UuidNewV4().String(),
@@ -310,6 +436,52 @@ func createSystemMessage(ctx context.Context, tx *sql.Tx, category, data string)
 	return err
 }
 
+// CreateBroadcastMessage sends the text to the group from the bot.
+func (current *User) CreateBroadcastMessage(ctx context.Context, text string) error {
+	if !current.Can(ctx, PermissionBroadcast) {
+		return session.ForbiddenError(ctx)
+	}
+	if strings.TrimSpace(text) == "" {
+		return session.BadDataError(ctx)
+	}
+	err := session.Database(ctx).RunInTransaction(ctx, nil, func(ctx context.Context, tx *sql.Tx) error {
+		err := createSystemMessage(ctx, tx, MessageCategoryPlainText, base64.RawURLEncoding.EncodeToString([]byte(text)))
+		if err != nil {
+			return err
+		}
+		return createAuditEventInTx(ctx, tx, current.UserId, AuditActionBroadcast, "", "", nil, FirstNStringInRune(text, 256))
+	})
+	if err != nil {
+		return session.TransactionError(ctx, err)
+	}
+	return nil
+}
+
+// ReplayStuckMessages queues again the messages left pending or inspecting for
+// longer than the duration, e.g. after the message service crashed.
+func (current *User) ReplayStuckMessages(ctx context.Context, duration time.Duration) (int64, error) {
+	if !current.Can(ctx, PermissionRecall) {
+		return 0, session.ForbiddenError(ctx)
+	}
+	var count int64
+	err := session.Database(ctx).RunInTransaction(ctx, nil, func(ctx context.Context, tx *sql.Tx) error {
+		query := "UPDATE messages SET (state,updated_at)=($1,$2) WHERE state IN ($3,$4) AND updated_at<$5"
+		r, err := tx.ExecContext(ctx, query, MessageStatePending, time.Now(), MessageStatePending, MessageStateInspecting, time.Now().Add(-duration))
+		if err != nil {
+			return err
+		}
+		count, err = r.RowsAffected()
+		if err != nil {
+			return err
+		}
+		return createAuditEventInTx(ctx, tx, current.UserId, AuditActionReplayMessages, "", duration.String(), nil, count)
+	})
+	if err != nil {
+		return 0, session.TransactionError(ctx, err)
+	}
+	return count, nil
+}
+
 func PendingMessages(ctx context.Context, limit int64) ([]*Message, error) {
 	var messages []*Message
 	query := fmt.Sprintf("SELECT %s FROM messages WHERE state=$1 ORDER BY state,updated_at LIMIT $2", strings.Join(messagesCols, ","))
@@ -327,6 +499,24 @@ func PendingMessages(ctx context.Context, limit int64) ([]*Message, error) {
 	return messages, nil
 }
 
+func InspectingMessages(ctx context.Context, limit int64) ([]*Message, error) {
+	var messages []*Message
+	query := fmt.Sprintf("SELECT %s FROM messages WHERE state=$1 ORDER BY state,updated_at LIMIT $2", strings.Join(messagesCols, ","))
+	rows, err := session.Database(ctx).QueryContext(ctx, query, MessageStateInspecting, limit)
+	if err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		m, err := messageFromRow(rows)
+		if err != nil {
+			return nil, session.TransactionError(ctx, err)
+		}
+		messages = append(messages, m)
+	}
+	return messages, nil
+}
+
 func LastSucessMessage(ctx context.Context) (*Message, error) {
 	var message *Message
 	query := fmt.Sprintf("SELECT %s FROM messages WHERE state=$1 AND updated_at>$2 AND updated_at<$3 ORDER BY state,updated_at LIMIT 1", strings.Join(messagesCols, ","))
@@ -452,7 +642,7 @@ func decryptMessageData(data string) (string, error) {
 		return "", nil
 	}
 	sessionLen := int(binary.LittleEndian.Uint16(bytes[1:3]))
-	mixin := config.AppConfig.Mixin
+	mixin := config.AppConfig().Mixin
 	prefixSize := 35 + sessionLen*size
 	var key []byte
 	for i := 35; i < prefixSize; i += size {
@@ -506,6 +696,6 @@ func EncryptMessageData(data string, sessions []*Session) (string, error) {
 			PublicKey: s.PublicKey,
 		}
 	}
-	mixin := config.AppConfig.Mixin
+	mixin := config.AppConfig().Mixin
 	return bot.EncryptMessageData(data, ss, mixin.SessionKey)
 }
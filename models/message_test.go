@@ -137,7 +137,7 @@ func TestMessageCRUD(t *testing.T) {
 	assert.Nil(err)
 	assert.Len(messages, 4)
 
-	mixin := config.AppConfig.Mixin
+	mixin := config.AppConfig().Mixin
 	privateBytes, _ := base64.RawURLEncoding.DecodeString(mixin.SessionKey)
 	privateKey := ed25519.PrivateKey(privateBytes)
 	pub, _ = bot.PublicKeyToCurve25519(ed25519.PublicKey(privateKey[32:]))
@@ -171,8 +171,8 @@ func testReadMessage(ctx context.Context, id string) (*Message, error) {
 func testReadDistributedMessages(ctx context.Context) ([]*DistributedMessage, error) {
 	limit := int64(64)
 	dms := make([]*DistributedMessage, 0)
-	for i := int64(0); i < config.AppConfig.System.MessageShardSize; i++ {
-		shard := testShardId(config.AppConfig.System.MessageShardModifier, i)
+	for i := int64(0); i < config.AppConfig().System.MessageShardSize; i++ {
+		shard := testShardId(config.AppConfig().System.MessageShardModifier, i)
 		messages, err := PendingActiveDistributedMessages(ctx, shard, limit)
 		if err != nil {
 			return dms, err
@@ -195,3 +195,45 @@ func testShardId(modifier string, i int64) string {
 	}
 	return id.String()
 }
+
+func TestMessageOperations(t *testing.T) {
+	assert := assert.New(t)
+	ctx := setupTestContext()
+	defer teardownTestContext(ctx)
+
+	err := SeedRoles(ctx)
+	assert.Nil(err)
+	owner := &User{UserId: config.AppConfig().System.OperatorList[0]}
+	user := &User{UserId: bot.UuidNewV4().String(), ActiveAt: time.Now()}
+
+	err = user.CreateBroadcastMessage(ctx, "hello")
+	assert.NotNil(err)
+	err = owner.CreateBroadcastMessage(ctx, " ")
+	assert.NotNil(err)
+	err = owner.CreateBroadcastMessage(ctx, "hello")
+	assert.Nil(err)
+	messages, err := PendingMessages(ctx, 100)
+	assert.Nil(err)
+	assert.Len(messages, 1)
+	assert.Equal(config.AppConfig().Mixin.ClientId, messages[0].UserId)
+
+	data := base64.RawURLEncoding.EncodeToString([]byte("hello"))
+	message, err := CreateMessage(ctx, user, bot.UuidNewV4().String(), MessageCategoryPlainText, "", data, false, time.Now(), time.Now())
+	assert.Nil(err)
+	assert.NotNil(message)
+	_, err = session.Database(ctx).Exec("UPDATE messages SET (state,updated_at)=($1,$2) WHERE message_id=$3", MessageStateInspecting, time.Now().Add(-2*time.Hour), message.MessageId)
+	assert.Nil(err)
+
+	count, err := user.ReplayStuckMessages(ctx, time.Hour)
+	assert.NotNil(err)
+	count, err = owner.ReplayStuckMessages(ctx, time.Hour)
+	assert.Nil(err)
+	assert.Equal(int64(1), count)
+	message, err = testReadMessage(ctx, message.MessageId)
+	assert.Nil(err)
+	assert.Equal(MessageStatePending, message.State)
+	assert.True(message.UpdatedAt.After(time.Now().Add(-time.Minute)))
+	count, err = owner.ReplayStuckMessages(ctx, time.Hour)
+	assert.Nil(err)
+	assert.Equal(int64(0), count)
+}
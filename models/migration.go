@@ -0,0 +1,214 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+)
+
+// The migrations are numbered NNNN_name.up.sql and NNNN_name.down.sql, every
+// migration runs in its own transaction together with its schema_migrations row.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+const (
+	createSchemaMigrationsDDL = `CREATE TABLE IF NOT EXISTS schema_migrations (
+	version             BIGINT PRIMARY KEY,
+	name                VARCHAR(512) NOT NULL,
+	applied_at          TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);`
+
+	// migrationLockId serializes the migrations of replicas started together.
+	migrationLockId = 7001
+
+	// migrationBaselineVersion adopts the existing databases, it's never reverted.
+	migrationBaselineVersion = 1
+)
+
+var migrationFileRegexp = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+type Migration struct {
+	Version   int64
+	Name      string
+	Up        string
+	Down      string
+	AppliedAt *time.Time
+}
+
+func readMigrations() ([]*Migration, error) {
+	entries, err := migrationFiles.ReadDir("migrations")
+	if err != nil {
+		return nil, err
+	}
+	set := make(map[int64]*Migration)
+	for _, e := range entries {
+		matches := migrationFileRegexp.FindStringSubmatch(e.Name())
+		if matches == nil {
+			return nil, fmt.Errorf("invalid migration file %s", e.Name())
+		}
+		version, _ := strconv.ParseInt(matches[1], 10, 64)
+		data, err := migrationFiles.ReadFile(path.Join("migrations", e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		m := set[version]
+		if m == nil {
+			m = &Migration{Version: version, Name: matches[2]}
+			set[version] = m
+		} else if m.Name != matches[2] {
+			return nil, fmt.Errorf("duplicated migration version %d", version)
+		}
+		if matches[3] == "up" {
+			m.Up = string(data)
+		} else {
+			m.Down = string(data)
+		}
+	}
+
+	migrations := make([]*Migration, 0, len(set))
+	for _, m := range set {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s should have both up and down", m.Version, m.Name)
+		}
+		migrations = append(migrations, m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// MigrationStatus lists all the migrations, AppliedAt is nil for pending ones.
+func MigrationStatus(ctx context.Context) ([]*Migration, error) {
+	migrations, err := readMigrations()
+	if err != nil {
+		return nil, err
+	}
+	db := session.Database(ctx)
+	_, err = db.ExecContext(ctx, createSchemaMigrationsDDL)
+	if err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	rows, err := db.QueryContext(ctx, "SELECT version,applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int64]time.Time)
+	for rows.Next() {
+		var version int64
+		var t time.Time
+		err := rows.Scan(&version, &t)
+		if err != nil {
+			return nil, session.TransactionError(ctx, err)
+		}
+		applied[version] = t
+	}
+	for _, m := range migrations {
+		if t, found := applied[m.Version]; found {
+			m.AppliedAt = &t
+			delete(applied, m.Version)
+		}
+	}
+	for version := range applied {
+		return nil, fmt.Errorf("migration %d is applied but unknown to this build", version)
+	}
+	return migrations, nil
+}
+
+// CheckSchema refuses to run against a database with pending migrations.
+func CheckSchema(ctx context.Context) error {
+	migrations, err := MigrationStatus(ctx)
+	if err != nil {
+		return err
+	}
+	for _, m := range migrations {
+		if m.AppliedAt == nil {
+			return fmt.Errorf("migration %d_%s is pending, run -service migrate up", m.Version, m.Name)
+		}
+	}
+	return nil
+}
+
+// MigrateUp applies the pending migrations in order and returns them.
+func MigrateUp(ctx context.Context) ([]*Migration, error) {
+	migrations, err := MigrationStatus(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var applied []*Migration
+	for _, m := range migrations {
+		if m.AppliedAt != nil {
+			continue
+		}
+		err := runMigration(ctx, m, true)
+		if err != nil {
+			return applied, fmt.Errorf("migration %d_%s up: %v", m.Version, m.Name, err)
+		}
+		applied = append(applied, m)
+	}
+	return applied, nil
+}
+
+// MigrateDown rolls back the last steps applied migrations, newest first, it
+// stops at the baseline, which would drop the tables it adopted.
+func MigrateDown(ctx context.Context, steps int) ([]*Migration, error) {
+	migrations, err := MigrationStatus(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var reverted []*Migration
+	for i := len(migrations) - 1; i >= 0 && len(reverted) < steps; i-- {
+		m := migrations[i]
+		if m.Version <= migrationBaselineVersion {
+			break
+		}
+		if m.AppliedAt == nil {
+			continue
+		}
+		err := runMigration(ctx, m, false)
+		if err != nil {
+			return reverted, fmt.Errorf("migration %d_%s down: %v", m.Version, m.Name, err)
+		}
+		reverted = append(reverted, m)
+	}
+	return reverted, nil
+}
+
+// runMigration checks the version again after taking the lock, another
+// replica may have migrated while this one was waiting.
+func runMigration(ctx context.Context, m *Migration, up bool) error {
+	return session.Database(ctx).RunInTransaction(ctx, nil, func(ctx context.Context, tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock($1)", migrationLockId)
+		if err != nil {
+			return err
+		}
+		var count int
+		err = tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM schema_migrations WHERE version=$1", m.Version).Scan(&count)
+		if err != nil || (count > 0) == up {
+			return err
+		}
+		if up {
+			_, err = tx.ExecContext(ctx, m.Up)
+			if err != nil {
+				return err
+			}
+			_, err = tx.ExecContext(ctx, "INSERT INTO schema_migrations (version,name) VALUES ($1,$2)", m.Version, m.Name)
+			return err
+		}
+		_, err = tx.ExecContext(ctx, m.Down)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version=$1", m.Version)
+		return err
+	})
+}
@@ -0,0 +1,66 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMigration(t *testing.T) {
+	assert := assert.New(t)
+	ctx := setupTestContext()
+	defer teardownTestContext(ctx)
+
+	migrations, err := readMigrations()
+	assert.Nil(err)
+	assert.True(len(migrations) > 0)
+	for i, m := range migrations {
+		assert.NotEmpty(m.Up)
+		assert.NotEmpty(m.Down)
+		if i > 0 {
+			assert.True(m.Version > migrations[i-1].Version)
+		}
+	}
+
+	err = CheckSchema(ctx)
+	assert.Nil(err)
+	status, err := MigrationStatus(ctx)
+	assert.Nil(err)
+	assert.Len(status, len(migrations))
+	for _, m := range status {
+		assert.NotNil(m.AppliedAt)
+	}
+	applied, err := MigrateUp(ctx)
+	assert.Nil(err)
+	assert.Len(applied, 0)
+
+	reverted, err := MigrateDown(ctx, 1)
+	assert.Nil(err)
+	assert.Len(reverted, 1)
+	assert.Equal(migrations[len(migrations)-1].Version, reverted[0].Version)
+	err = CheckSchema(ctx)
+	assert.NotNil(err)
+	applied, err = MigrateUp(ctx)
+	assert.Nil(err)
+	assert.Len(applied, 1)
+	err = CheckSchema(ctx)
+	assert.Nil(err)
+
+	reverted, err = MigrateDown(ctx, len(migrations))
+	assert.Nil(err)
+	assert.Len(reverted, len(migrations)-1)
+	status, err = MigrationStatus(ctx)
+	assert.Nil(err)
+	assert.NotNil(status[0].AppliedAt)
+	applied, err = MigrateUp(ctx)
+	assert.Nil(err)
+	assert.Len(applied, len(migrations)-1)
+
+	_, err = session.Database(ctx).Exec("INSERT INTO schema_migrations (version,name) VALUES (99999999,'future')")
+	assert.Nil(err)
+	err = CheckSchema(ctx)
+	assert.NotNil(err)
+	_, err = session.Database(ctx).Exec("DELETE FROM schema_migrations WHERE version=99999999")
+	assert.Nil(err)
+}
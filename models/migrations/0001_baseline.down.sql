@@ -0,0 +1,3 @@
+-- The baseline adopts the tables of the existing databases, so it's never
+-- reverted, MigrateDown stops at version 1.
+SELECT 1;
@@ -0,0 +1,261 @@
+-- The schema before migrations existed, the ALTERs bring databases created by
+-- hand from older versions up to date and do nothing on new ones.
+
+CREATE TABLE IF NOT EXISTS users (
+  user_id           VARCHAR(36) PRIMARY KEY CHECK (user_id ~* '^[0-9a-f-]{36,36}$'),
+  identity_number   BIGINT NOT NULL,
+  full_name         VARCHAR(512) NOT NULL DEFAULT '',
+  access_token      VARCHAR(512) NOT NULL DEFAULT '',
+  authorization_id  VARCHAR(512) NOT NULL DEFAULT '',
+  scope             VARCHAR(512) NOT NULL DEFAULT '',
+  avatar_url        VARCHAR(1024) NOT NULL DEFAULT '',
+  trace_id          VARCHAR(36) NOT NULL CHECK (trace_id ~* '^[0-9a-f-]{36,36}$'),
+  state             VARCHAR(128) NOT NULL,
+  active_at         TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+  subscribed_at     TIMESTAMP WITH TIME ZONE NOT NULL,
+  pay_method        VARCHAR(512) NOT NULL DEFAULT '',
+  probation_until   TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS authorization_id VARCHAR(512) NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS scope VARCHAR(512) NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS active_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW();
+ALTER TABLE users ADD COLUMN IF NOT EXISTS probation_until TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW();
+
+CREATE UNIQUE INDEX IF NOT EXISTS users_identityx ON users(identity_number);
+CREATE INDEX IF NOT EXISTS users_subscribed_activex ON users(subscribed_at, active_at);
+CREATE INDEX IF NOT EXISTS users_activex ON users(active_at);
+
+
+CREATE TABLE IF NOT EXISTS sessions (
+  user_id            VARCHAR(36) NOT NULL,
+  session_id         VARCHAR(36) NOT NULL,
+  public_key         VARCHAR(128) NOT NULL,
+  updated_at         TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+  PRIMARY KEY(user_id, session_id)
+);
+
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW();
+
+
+CREATE TABLE IF NOT EXISTS conversation_participants (
+  conversation_id     VARCHAR(36) NOT NULL,
+  user_id             VARCHAR(36) NOT NULL,
+  PRIMARY KEY(conversation_id, user_id)
+);
+
+
+CREATE TABLE IF NOT EXISTS messages (
+  message_id            VARCHAR(36) PRIMARY KEY CHECK (message_id ~* '^[0-9a-f-]{36,36}$'),
+  user_id               VARCHAR(36) NOT NULL CHECK (user_id ~* '^[0-9a-f-]{36,36}$'),
+  category              VARCHAR(512) NOT NULL,
+  quote_message_id      VARCHAR(36) NOT NULL DEFAULT '',
+  data                  TEXT NOT NULL,
+  silent                BOOLEAN NOT NULL DEFAULT false,
+  created_at            TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+  updated_at            TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+  state                 VARCHAR(128) NOT NULL,
+  last_distribute_at    TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS quote_message_id VARCHAR(36) NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS messages_state_updatedx ON messages(state, updated_at);
+
+
+CREATE TABLE IF NOT EXISTS distributed_messages (
+  message_id            VARCHAR(36) PRIMARY KEY CHECK (message_id ~* '^[0-9a-f-]{36,36}$'),
+  conversation_id       VARCHAR(36) NOT NULL CHECK (conversation_id ~* '^[0-9a-f-]{36,36}$'),
+  recipient_id          VARCHAR(36) NOT NULL CHECK (recipient_id ~* '^[0-9a-f-]{36,36}$'),
+  user_id               VARCHAR(36) NOT NULL CHECK (user_id ~* '^[0-9a-f-]{36,36}$'),
+  parent_id             VARCHAR(36) NOT NULL CHECK (parent_id ~* '^[0-9a-f-]{36,36}$'),
+  quote_message_id      VARCHAR(36) NOT NULL DEFAULT '',
+  shard                 VARCHAR(36) NOT NULL,
+  category              VARCHAR(512) NOT NULL,
+  data                  TEXT NOT NULL,
+  silent                BOOLEAN NOT NULL DEFAULT false,
+  status                VARCHAR(512) NOT NULL,
+  sessions              VARCHAR(512),
+  created_at            TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+ALTER TABLE distributed_messages ADD COLUMN IF NOT EXISTS quote_message_id VARCHAR(36) NOT NULL DEFAULT '';
+ALTER TABLE distributed_messages ADD COLUMN IF NOT EXISTS sessions VARCHAR(512);
+DROP INDEX IF EXISTS message_status;
+
+CREATE INDEX IF NOT EXISTS message_shard_statusx ON distributed_messages(shard, status, created_at);
+
+
+CREATE TABLE IF NOT EXISTS packets (
+  packet_id         VARCHAR(36) PRIMARY KEY CHECK (packet_id ~* '^[0-9a-f-]{36,36}$'),
+  user_id           VARCHAR(36) NOT NULL CHECK (user_id ~* '^[0-9a-f-]{36,36}$'),
+  asset_id          VARCHAR(36) NOT NULL CHECK (asset_id ~* '^[0-9a-f-]{36,36}$'),
+  amount            VARCHAR(128) NOT NULL,
+  greeting          VARCHAR(36) NOT NULL,
+  total_count       BIGINT NOT NULL,
+  remaining_count   BIGINT NOT NULL,
+  remaining_amount  VARCHAR(128) NOT NULL,
+  state             VARCHAR(36) NOT NULL,
+  created_at        TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS packets_state_createdx ON packets(state, created_at);
+
+
+CREATE TABLE IF NOT EXISTS participants (
+  packet_id         VARCHAR(36) NOT NULL REFERENCES packets(packet_id) ON DELETE CASCADE,
+  user_id           VARCHAR(36) NOT NULL CHECK (user_id ~* '^[0-9a-f-]{36,36}$'),
+  amount            VARCHAR(128) NOT NULL,
+  created_at        TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+  paid_at           TIMESTAMP WITH TIME ZONE,
+  PRIMARY KEY(packet_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS participants_created_paidx ON participants(created_at, paid_at);
+
+
+CREATE TABLE IF NOT EXISTS assets (
+  asset_id         VARCHAR(36) PRIMARY KEY CHECK (asset_id ~* '^[0-9a-f-]{36,36}$'),
+  symbol           VARCHAR(512) NOT NULL,
+  name             VARCHAR(512) NOT NULL,
+  icon_url         VARCHAR(1024) NOT NULL,
+  price_btc        VARCHAR(128) NOT NULL,
+  price_usd        VARCHAR(128) NOT NULL
+);
+
+
+CREATE TABLE IF NOT EXISTS blacklists (
+  user_id	          VARCHAR(36) PRIMARY KEY CHECK (user_id ~* '^[0-9a-f-]{36,36}$'),
+  identity_number   BIGINT NOT NULL DEFAULT 0,
+  full_name         VARCHAR(512) NOT NULL DEFAULT '',
+  operator_id       VARCHAR(36) NOT NULL DEFAULT '',
+  reason            VARCHAR(1024) NOT NULL DEFAULT '',
+  message_id        VARCHAR(36) NOT NULL DEFAULT '',
+  expired_at        TIMESTAMP WITH TIME ZONE,
+  created_at        TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+ALTER TABLE blacklists ADD COLUMN IF NOT EXISTS identity_number BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE blacklists ADD COLUMN IF NOT EXISTS full_name VARCHAR(512) NOT NULL DEFAULT '';
+ALTER TABLE blacklists ADD COLUMN IF NOT EXISTS operator_id VARCHAR(36) NOT NULL DEFAULT '';
+ALTER TABLE blacklists ADD COLUMN IF NOT EXISTS reason VARCHAR(1024) NOT NULL DEFAULT '';
+ALTER TABLE blacklists ADD COLUMN IF NOT EXISTS message_id VARCHAR(36) NOT NULL DEFAULT '';
+ALTER TABLE blacklists ADD COLUMN IF NOT EXISTS expired_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE blacklists ADD COLUMN IF NOT EXISTS created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW();
+
+CREATE INDEX IF NOT EXISTS blacklists_createdx ON blacklists(created_at);
+CREATE INDEX IF NOT EXISTS blacklists_expiredx ON blacklists(expired_at);
+
+CREATE TABLE IF NOT EXISTS properties (
+  name               VARCHAR(512) PRIMARY KEY,
+  value              VARCHAR(1024) NOT NULL,
+  created_at         TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+
+CREATE TABLE IF NOT EXISTS broadcasters (
+	user_id	          VARCHAR(36) PRIMARY KEY CHECK (user_id ~* '^[0-9a-f-]{36,36}$'),
+	created_at        TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+	updated_at        TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS broadcasters_updatedx ON broadcasters(updated_at);
+
+
+CREATE TABLE IF NOT EXISTS rewards (
+	reward_id           VARCHAR(36) PRIMARY KEY CHECK (reward_id ~* '^[0-9a-f-]{36,36}$'),
+	user_id	            VARCHAR(36) NOT NULL CHECK (user_id ~* '^[0-9a-f-]{36,36}$'),
+	recipient_id        VARCHAR(36) NOT NULL CHECK (recipient_id ~* '^[0-9a-f-]{36,36}$'),
+	asset_id            VARCHAR(36) NOT NULL CHECK (asset_id ~* '^[0-9a-f-]{36,36}$'),
+	amount              VARCHAR(128) NOT NULL,
+	paid_at             TIMESTAMP WITH TIME ZONE NOT NULL,
+	created_at          TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS rewards_paidx ON rewards(paid_at);
+
+
+CREATE TABLE IF NOT EXISTS message_fingerprints (
+	message_id          VARCHAR(36) PRIMARY KEY CHECK (message_id ~* '^[0-9a-f-]{36,36}$'),
+	user_id	            VARCHAR(36) NOT NULL CHECK (user_id ~* '^[0-9a-f-]{36,36}$'),
+	fingerprint         VARCHAR(64) NOT NULL,
+	held                BOOLEAN NOT NULL DEFAULT false,
+	created_at          TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS message_fingerprints_fingerprint_createdx ON message_fingerprints(fingerprint, created_at);
+CREATE INDEX IF NOT EXISTS message_fingerprints_user_createdx ON message_fingerprints(user_id, created_at);
+
+
+CREATE TABLE IF NOT EXISTS image_blocklists (
+	hash                VARCHAR(16) PRIMARY KEY,
+	message_id          VARCHAR(36) NOT NULL CHECK (message_id ~* '^[0-9a-f-]{36,36}$'),
+	user_id	            VARCHAR(36) NOT NULL CHECK (user_id ~* '^[0-9a-f-]{36,36}$'),
+	created_at          TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+
+CREATE TABLE IF NOT EXISTS attachment_inspections (
+	attachment_id       VARCHAR(36) PRIMARY KEY,
+	state               VARCHAR(32) NOT NULL,
+	reason              VARCHAR(1024) NOT NULL DEFAULT '',
+	created_at          TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+	updated_at          TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS attachment_inspections_state_createdx ON attachment_inspections(state, created_at);
+
+
+CREATE TABLE IF NOT EXISTS mutes (
+	user_id	            VARCHAR(36) PRIMARY KEY CHECK (user_id ~* '^[0-9a-f-]{36,36}$'),
+	operator_id         VARCHAR(36) NOT NULL CHECK (operator_id ~* '^[0-9a-f-]{36,36}$'),
+	expired_at          TIMESTAMP WITH TIME ZONE NOT NULL,
+	created_at          TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS mutes_expiredx ON mutes(expired_at);
+
+
+CREATE TABLE IF NOT EXISTS audit_events (
+	audit_event_id      VARCHAR(36) PRIMARY KEY CHECK (audit_event_id ~* '^[0-9a-f-]{36,36}$'),
+	actor_id            VARCHAR(36) NOT NULL,
+	action              VARCHAR(128) NOT NULL,
+	target_id           VARCHAR(512) NOT NULL,
+	reason              VARCHAR(1024) NOT NULL DEFAULT '',
+	before              TEXT NOT NULL,
+	after               TEXT NOT NULL,
+	created_at          TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS audit_events_createdx ON audit_events(created_at);
+CREATE INDEX IF NOT EXISTS audit_events_actor_createdx ON audit_events(actor_id, created_at);
+CREATE INDEX IF NOT EXISTS audit_events_action_createdx ON audit_events(action, created_at);
+
+
+CREATE TABLE IF NOT EXISTS roles (
+	user_id	            VARCHAR(36) PRIMARY KEY CHECK (user_id ~* '^[0-9a-f-]{36,36}$'),
+	role                VARCHAR(32) NOT NULL,
+	granted_by          VARCHAR(36) NOT NULL DEFAULT '',
+	created_at          TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+
+CREATE TABLE IF NOT EXISTS warnings (
+	warning_id          VARCHAR(36) PRIMARY KEY CHECK (warning_id ~* '^[0-9a-f-]{36,36}$'),
+	user_id	            VARCHAR(36) NOT NULL CHECK (user_id ~* '^[0-9a-f-]{36,36}$'),
+	operator_id         VARCHAR(36) NOT NULL CHECK (operator_id ~* '^[0-9a-f-]{36,36}$'),
+	reason              VARCHAR(1024) NOT NULL DEFAULT '',
+	message_id          VARCHAR(36) NOT NULL DEFAULT '',
+	created_at          TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS warnings_user_createdx ON warnings(user_id, created_at);
+CREATE INDEX IF NOT EXISTS warnings_createdx ON warnings(created_at);
+
+
+CREATE TABLE IF NOT EXISTS rate_limits (
+	key                 VARCHAR(256) PRIMARY KEY,
+	tat                 TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS rate_limits_tatx ON rate_limits(tat);
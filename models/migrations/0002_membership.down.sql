@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS users_state_paid_untilx;
+
+ALTER TABLE users DROP COLUMN IF EXISTS reminded_at;
+ALTER TABLE users DROP COLUMN IF EXISTS paid_until;
@@ -0,0 +1,4 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS paid_until TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT '0001-01-01 00:00:00+00';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS reminded_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT '0001-01-01 00:00:00+00';
+
+CREATE INDEX IF NOT EXISTS users_state_paid_untilx ON users(state, paid_until);
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS payment_quotes (
+  quote_id          VARCHAR(36) PRIMARY KEY CHECK (quote_id ~* '^[0-9a-f-]{36,36}$'),
+  user_id           VARCHAR(36) NOT NULL CHECK (user_id ~* '^[0-9a-f-]{36,36}$'),
+  plan              VARCHAR(128) NOT NULL,
+  asset_id          VARCHAR(36) NOT NULL CHECK (asset_id ~* '^[0-9a-f-]{36,36}$'),
+  amount            VARCHAR(128) NOT NULL,
+  amount_usd        VARCHAR(128) NOT NULL,
+  price_usd         VARCHAR(128) NOT NULL,
+  state             VARCHAR(36) NOT NULL,
+  expired_at        TIMESTAMP WITH TIME ZONE NOT NULL,
+  created_at        TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS payment_quotes_user_assetx ON payment_quotes(user_id, asset_id, state, expired_at);
+CREATE INDEX IF NOT EXISTS payment_quotes_expiredx ON payment_quotes(expired_at);
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS refunds (
+  snapshot_id       VARCHAR(36) PRIMARY KEY CHECK (snapshot_id ~* '^[0-9a-f-]{36,36}$'),
+  trace_id          VARCHAR(36) NOT NULL CHECK (trace_id ~* '^[0-9a-f-]{36,36}$'),
+  user_id           VARCHAR(36) NOT NULL CHECK (user_id ~* '^[0-9a-f-]{36,36}$'),
+  asset_id          VARCHAR(36) NOT NULL CHECK (asset_id ~* '^[0-9a-f-]{36,36}$'),
+  amount            VARCHAR(128) NOT NULL,
+  memo              VARCHAR(256) NOT NULL,
+  state             VARCHAR(36) NOT NULL,
+  created_at        TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS refunds_tracex ON refunds(trace_id);
+CREATE INDEX IF NOT EXISTS refunds_state_createdx ON refunds(state, created_at);
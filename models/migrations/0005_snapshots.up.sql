@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS snapshots (
+  snapshot_id       VARCHAR(36) PRIMARY KEY CHECK (snapshot_id ~* '^[0-9a-f-]{36,36}$'),
+  user_id           VARCHAR(36) NOT NULL,
+  asset_id          VARCHAR(36) NOT NULL,
+  amount            VARCHAR(128) NOT NULL,
+  memo              VARCHAR(1024) NOT NULL,
+  transaction_hash  VARCHAR(128) NOT NULL,
+  purpose           VARCHAR(36) NOT NULL,
+  created_at        TIMESTAMP WITH TIME ZONE NOT NULL,
+  updated_at        TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS snapshots_createdx ON snapshots(created_at);
+CREATE INDEX IF NOT EXISTS snapshots_purpose_createdx ON snapshots(purpose, created_at);
+CREATE INDEX IF NOT EXISTS snapshots_user_createdx ON snapshots(user_id, created_at);
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS discrepancies;
+DROP INDEX IF EXISTS participants_paidx;
+DROP INDEX IF EXISTS snapshots_requestx;
+ALTER TABLE snapshots DROP COLUMN IF EXISTS request_id;
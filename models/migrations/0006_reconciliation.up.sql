@@ -0,0 +1,16 @@
+ALTER TABLE snapshots ADD COLUMN IF NOT EXISTS request_id VARCHAR(36) NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS snapshots_requestx ON snapshots(request_id);
+CREATE INDEX IF NOT EXISTS participants_paidx ON participants(paid_at);
+
+CREATE TABLE IF NOT EXISTS discrepancies (
+  kind              VARCHAR(36) NOT NULL,
+  reference_id      VARCHAR(36) NOT NULL,
+  user_id           VARCHAR(36) NOT NULL,
+  asset_id          VARCHAR(36) NOT NULL,
+  amount            VARCHAR(128) NOT NULL,
+  detail            VARCHAR(1024) NOT NULL,
+  created_at        TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+  PRIMARY KEY(kind, reference_id)
+);
+
+CREATE INDEX IF NOT EXISTS discrepancies_createdx ON discrepancies(created_at);
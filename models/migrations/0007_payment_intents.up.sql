@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS payment_intents (
+  intent_id         VARCHAR(36) PRIMARY KEY CHECK (intent_id ~* '^[0-9a-f-]{36,36}$'),
+  user_id           VARCHAR(36) NOT NULL CHECK (user_id ~* '^[0-9a-f-]{36,36}$'),
+  action            VARCHAR(36) NOT NULL,
+  target            VARCHAR(36) NOT NULL,
+  plan              VARCHAR(128) NOT NULL,
+  asset_id          VARCHAR(36) NOT NULL CHECK (asset_id ~* '^[0-9a-f-]{36,36}$'),
+  amount            VARCHAR(128) NOT NULL,
+  state             VARCHAR(36) NOT NULL,
+  snapshot_id       VARCHAR(36) NOT NULL,
+  expired_at        TIMESTAMP WITH TIME ZONE NOT NULL,
+  created_at        TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS payment_intents_user_createdx ON payment_intents(user_id, created_at);
+CREATE INDEX IF NOT EXISTS payment_intents_state_expiredx ON payment_intents(state, expired_at);
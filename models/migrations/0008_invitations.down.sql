@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS users_invitation_codex;
+ALTER TABLE users DROP COLUMN IF EXISTS invitation_code;
+
+DROP TABLE IF EXISTS invitations;
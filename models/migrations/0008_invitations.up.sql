@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS invitations (
+  code              VARCHAR(16) PRIMARY KEY,
+  user_id           VARCHAR(36) NOT NULL CHECK (user_id ~* '^[0-9a-f-]{36,36}$'),
+  plan              VARCHAR(128) NOT NULL,
+  discount          VARCHAR(128) NOT NULL,
+  max_uses          BIGINT NOT NULL,
+  uses              BIGINT NOT NULL,
+  expired_at        TIMESTAMP WITH TIME ZONE NOT NULL,
+  created_at        TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS invitations_user_createdx ON invitations(user_id, created_at);
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS invitation_code VARCHAR(16) NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS users_invitation_codex ON users(invitation_code);
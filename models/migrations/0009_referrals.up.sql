@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS referrals (
+  user_id           VARCHAR(36) PRIMARY KEY CHECK (user_id ~* '^[0-9a-f-]{36,36}$'),
+  referrer_id       VARCHAR(36) NOT NULL CHECK (referrer_id ~* '^[0-9a-f-]{36,36}$'),
+  invitation_code   VARCHAR(16) NOT NULL,
+  trace_id          VARCHAR(36) NOT NULL CHECK (trace_id ~* '^[0-9a-f-]{36,36}$'),
+  asset_id          VARCHAR(36) NOT NULL CHECK (asset_id ~* '^[0-9a-f-]{36,36}$'),
+  amount            VARCHAR(128) NOT NULL,
+  fee               VARCHAR(128) NOT NULL,
+  state             VARCHAR(36) NOT NULL,
+  created_at        TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS referrals_tracex ON referrals(trace_id);
+CREATE INDEX IF NOT EXISTS referrals_state_createdx ON referrals(state, created_at);
+CREATE INDEX IF NOT EXISTS referrals_referrerx ON referrals(referrer_id);
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS gifts (
+  gift_id           VARCHAR(36) PRIMARY KEY CHECK (gift_id ~* '^[0-9a-f-]{36,36}$'),
+  user_id           VARCHAR(36) NOT NULL CHECK (user_id ~* '^[0-9a-f-]{36,36}$'),
+  recipient_id      VARCHAR(36) NOT NULL CHECK (recipient_id ~* '^[0-9a-f-]{36,36}$'),
+  plan              VARCHAR(128) NOT NULL,
+  asset_id          VARCHAR(36) NOT NULL CHECK (asset_id ~* '^[0-9a-f-]{36,36}$'),
+  amount            VARCHAR(128) NOT NULL,
+  state             VARCHAR(36) NOT NULL,
+  created_at        TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS gifts_recipient_statex ON gifts(recipient_id, state);
+CREATE INDEX IF NOT EXISTS gifts_user_createdx ON gifts(user_id, created_at);
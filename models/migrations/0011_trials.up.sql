@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS trials (
+  user_id           VARCHAR(36) PRIMARY KEY CHECK (user_id ~* '^[0-9a-f-]{36,36}$'),
+  created_at        TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+INSERT INTO trials (user_id, created_at) SELECT user_id, subscribed_at FROM users WHERE pay_method='trial' ON CONFLICT (user_id) DO NOTHING;
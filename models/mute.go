@@ -0,0 +1,112 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MixinNetwork/supergroup.mixin.one/durable"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+	"github.com/gofrs/uuid/v5"
+)
+
+type Mute struct {
+	UserId     string
+	OperatorId string
+	ExpiredAt  time.Time
+	CreatedAt  time.Time
+}
+
+var mutesCols = []string{"user_id", "operator_id", "expired_at", "created_at"}
+
+func (m *Mute) values() []interface{} {
+	return []interface{}{m.UserId, m.OperatorId, m.ExpiredAt, m.CreatedAt}
+}
+
+func muteFromRow(row durable.Row) (*Mute, error) {
+	var m Mute
+	err := row.Scan(&m.UserId, &m.OperatorId, &m.ExpiredAt, &m.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return &m, err
+}
+
+// CreateMute keeps the user in the group but drops their messages until the
+// duration passes, muting again replaces the previous expiry.
+func (current *User) CreateMute(ctx context.Context, userId string, duration time.Duration) (*Mute, error) {
+	if !current.Can(ctx, PermissionMute) {
+		return nil, session.ForbiddenError(ctx)
+	}
+	if id := uuid.FromStringOrNil(userId); id.String() != userId || duration <= 0 {
+		return nil, session.BadDataError(ctx)
+	}
+	if isProtected(ctx, userId) {
+		return nil, nil
+	}
+
+	t := time.Now()
+	m := &Mute{
+		UserId:     userId,
+		OperatorId: current.UserId,
+		ExpiredAt:  t.Add(duration),
+		CreatedAt:  t,
+	}
+	err := session.Database(ctx).RunInTransaction(ctx, nil, func(ctx context.Context, tx *sql.Tx) error {
+		u, err := findUserById(ctx, tx, userId)
+		if err != nil || u == nil {
+			m = nil
+			return err
+		}
+		query := durable.PrepareQuery("INSERT INTO mutes (%s) VALUES (%s) ON CONFLICT (user_id) DO UPDATE SET (operator_id, expired_at, created_at)=(EXCLUDED.operator_id, EXCLUDED.expired_at, EXCLUDED.created_at)", mutesCols)
+		_, err = tx.ExecContext(ctx, query, m.values()...)
+		if err != nil {
+			return err
+		}
+		err = createAuditEventInTx(ctx, tx, current.UserId, AuditActionMute, u.UserId, duration.String(), u.auditState(), map[string]interface{}{"expired_at": m.ExpiredAt})
+		if err != nil {
+			return err
+		}
+		data := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("Muted %s for %s, Mixin ID: %d", u.FullName, duration, u.IdentityNumber)))
+		return createSystemDistributedMessageInTx(ctx, tx, current, MessageCategoryPlainText, data)
+	})
+	if err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	return m, nil
+}
+
+func ReadActiveMute(ctx context.Context, userId string) (*Mute, error) {
+	query := fmt.Sprintf("SELECT %s FROM mutes WHERE user_id=$1 AND expired_at>$2", strings.Join(mutesCols, ","))
+	m, err := muteFromRow(session.Database(ctx).QueryRowContext(ctx, query, userId, time.Now()))
+	if err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	return m, nil
+}
+
+func LoopClearUpExpiredMutes(ctx context.Context) (int64, error) {
+	query := "DELETE FROM mutes WHERE user_id IN (SELECT user_id FROM mutes WHERE expired_at<$1 LIMIT 100)"
+	r, err := session.Database(ctx).ExecContext(ctx, query, time.Now())
+	if err != nil {
+		return 0, session.TransactionError(ctx, err)
+	}
+	return r.RowsAffected()
+}
+
+// ParseDuration accepts Go durations like 30m or 1h, plus days like 7d.
+func ParseDuration(s string) (time.Duration, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
+}
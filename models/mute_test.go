@@ -0,0 +1,75 @@
+package models
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	bot "github.com/MixinNetwork/bot-api-go-client/v2"
+	"github.com/MixinNetwork/supergroup.mixin.one/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMuteCRUD(t *testing.T) {
+	assert := assert.New(t)
+	ctx := setupTestContext()
+	defer teardownTestContext(ctx)
+
+	duration, err := ParseDuration("7d")
+	assert.Nil(err)
+	assert.Equal(7*24*time.Hour, duration)
+	duration, err = ParseDuration("1H")
+	assert.Nil(err)
+	assert.Equal(time.Hour, duration)
+	_, err = ParseDuration("forever")
+	assert.NotNil(err)
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(err)
+	public := base64.RawURLEncoding.EncodeToString(pub)
+	private := base64.RawURLEncoding.EncodeToString(priv)
+	user, err := createUser(ctx, public, private, bot.UuidNewV4().String(), "", bot.UuidNewV4().String(), "1000", "name", "http://localhost")
+	assert.Nil(err)
+	assert.NotNil(user)
+
+	mute, err := user.CreateMute(ctx, user.UserId, time.Hour)
+	assert.NotNil(err)
+	assert.Nil(mute)
+	admin := &User{UserId: config.AppConfig().System.OperatorList[0]}
+	mute, err = admin.CreateMute(ctx, user.UserId, 0)
+	assert.NotNil(err)
+	mute, err = admin.CreateMute(ctx, bot.UuidNewV4().String(), time.Hour)
+	assert.Nil(err)
+	assert.Nil(mute)
+	mute, err = admin.CreateMute(ctx, user.UserId, time.Hour)
+	assert.Nil(err)
+	assert.NotNil(mute)
+	mute, err = ReadActiveMute(ctx, user.UserId)
+	assert.Nil(err)
+	assert.NotNil(mute)
+
+	text := base64.RawURLEncoding.EncodeToString([]byte("hello"))
+	message, err := CreateMessage(ctx, user, bot.UuidNewV4().String(), MessageCategoryPlainText, "", text, false, time.Now(), time.Now())
+	assert.Nil(err)
+	assert.Nil(message)
+
+	mute, err = admin.CreateMute(ctx, user.UserId, time.Millisecond)
+	assert.Nil(err)
+	assert.NotNil(mute)
+	time.Sleep(10 * time.Millisecond)
+	mute, err = ReadActiveMute(ctx, user.UserId)
+	assert.Nil(err)
+	assert.Nil(mute)
+	count, err := LoopClearUpExpiredMutes(ctx)
+	assert.Nil(err)
+	assert.Equal(int64(1), count)
+	message, err = CreateMessage(ctx, user, bot.UuidNewV4().String(), MessageCategoryPlainText, "", text, false, time.Now(), time.Now())
+	assert.Nil(err)
+	assert.NotNil(message)
+	command := base64.RawURLEncoding.EncodeToString([]byte("MUTE"))
+	message, err = CreateMessage(ctx, admin, bot.UuidNewV4().String(), MessageCategoryPlainText, bot.UuidNewV4().String(), command, false, time.Now(), time.Now())
+	assert.Nil(err)
+	assert.Nil(message)
+}
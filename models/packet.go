@@ -73,7 +73,10 @@ func (current *User) Prepare(ctx context.Context) (int64, error) {
 }
 
 func (current *User) CreatePacket(ctx context.Context, assetId string, amount number.Decimal, totalCount int64, greeting string) (*Packet, error) {
-	if !current.isAdmin() {
+	if !current.Can(ctx, PermissionBroadcast) {
+		if current.InProbation() {
+			return nil, session.ForbiddenError(ctx)
+		}
 		b, err := ReadProhibitedProperty(ctx)
 		if err != nil {
 			return nil, err
@@ -87,7 +90,7 @@ func (current *User) CreatePacket(ctx context.Context, assetId string, amount nu
 		if err != nil {
 			return nil, err
 		}
-		if config.AppConfig.System.PriceAssetsEnable {
+		if config.AppConfig().System.PriceAssetsEnable {
 			if number.FromString(asset.PriceUSD).Cmp(number.Zero()) <= 0 {
 				return nil, session.BadDataError(ctx)
 			}
@@ -159,26 +162,17 @@ func (current *User) createPacket(ctx context.Context, assetId string, amount nu
 	return packet, nil
 }
 
-func PayPacket(ctx context.Context, packetId string, assetId, amount string) (*Packet, error) {
+// PayPacket returns nil if the transfer doesn't pay an INITIAL packet with
+// enough of its asset, the caller should refund it.
+func PayPacket(ctx context.Context, snapshotId, packetId string, assetId, amount string) (*Packet, error) {
 	var packet *Packet
 	err := session.Database(ctx).RunInTransaction(ctx, nil, func(ctx context.Context, tx *sql.Tx) error {
 		var err error
-		packet, err = readPacketWithAssetAndUser(ctx, tx, packetId)
+		packet, err = payPacketInTx(ctx, tx, packetId, assetId, amount)
 		if err != nil || packet == nil {
 			return err
 		}
-		if packet.State != PacketStateInitial {
-			return nil
-		}
-		if assetId != packet.AssetId || number.FromString(amount).Cmp(number.FromString(packet.Amount)) < 0 {
-			return nil
-		}
-		packet.State = PacketStatePaid
-		_, err = tx.ExecContext(ctx, "UPDATE packets SET state=$1 WHERE packet_id=$2", packet.State, packet.PacketId)
-		if err != nil {
-			return err
-		}
-		return handlePacketExpiration(ctx, tx, packet)
+		return resolveSnapshotInTx(ctx, tx, snapshotId, SnapshotPurposePacket)
 	})
 	if err != nil {
 		return nil, session.TransactionError(ctx, err)
@@ -186,6 +180,25 @@ func PayPacket(ctx context.Context, packetId string, assetId, amount string) (*P
 	return packet, nil
 }
 
+func payPacketInTx(ctx context.Context, tx *sql.Tx, packetId string, assetId, amount string) (*Packet, error) {
+	packet, err := readPacketWithAssetAndUser(ctx, tx, packetId)
+	if err != nil || packet == nil {
+		return nil, err
+	}
+	if packet.State != PacketStateInitial {
+		return nil, nil
+	}
+	if assetId != packet.AssetId || number.FromString(amount).Cmp(number.FromString(packet.Amount)) < 0 {
+		return nil, nil
+	}
+	packet.State = PacketStatePaid
+	_, err = tx.ExecContext(ctx, "UPDATE packets SET state=$1 WHERE packet_id=$2", packet.State, packet.PacketId)
+	if err != nil {
+		return nil, err
+	}
+	return packet, handlePacketExpiration(ctx, tx, packet)
+}
+
 func ShowPacket(ctx context.Context, packetId string) (*Packet, error) {
 	var packet *Packet
 	err := session.Database(ctx).RunInTransaction(ctx, nil, func(ctx context.Context, tx *sql.Tx) error {
@@ -247,7 +260,7 @@ func (current *User) ClaimPacket(ctx context.Context, packetId string) (*Packet,
 			}
 			b, err := readProhibitedStatus(ctx, tx)
 			if err == nil && !b {
-				dm, err := buildDistributeMessage(ctx, bot.UuidNewV4().String(), bot.UuidNewV4().String(), "", config.AppConfig.Mixin.ClientId, packet.UserId, MessageCategoryPlainText, base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(config.AppConfig.MessageTemplate.GroupOpenedRedPacket, current.FullName))), false)
+				dm, err := buildDistributeMessage(ctx, bot.UuidNewV4().String(), bot.UuidNewV4().String(), "", config.AppConfig().Mixin.ClientId, packet.UserId, MessageCategoryPlainText, base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(config.AppConfig().MessageTemplate.GroupOpenedRedPacket, current.FullName))), false)
 				if err != nil {
 					return err
 				}
@@ -298,7 +311,7 @@ func RefundPacket(ctx context.Context, packetId string) (*Packet, error) {
 }
 
 func SendPacketRefundTransfer(ctx context.Context, packetId string) (*Packet, error) {
-	traceId, err := generatePacketRefundId(packetId)
+	traceId, err := generateRefundTraceId(packetId)
 	if err != nil {
 		return nil, session.ServerError(ctx, err)
 	}
@@ -313,7 +326,7 @@ func SendPacketRefundTransfer(ctx context.Context, packetId string) (*Packet, er
 
 	ma := bot.NewUUIDMixAddress([]string{packet.UserId}, 1)
 	tr := &bot.TransactionRecipient{MixAddress: ma.String(), Amount: packet.RemainingAmount}
-	mixin := config.AppConfig.Mixin
+	mixin := config.AppConfig().Mixin
 	su := &bot.SafeUser{
 		UserId:            mixin.ClientId,
 		SessionId:         mixin.SessionId,
@@ -442,9 +455,11 @@ func readPacket(ctx context.Context, tx *sql.Tx, packetId string) (*Packet, erro
 	return p, nil
 }
 
-func generatePacketRefundId(packetId string) (string, error) {
+// generateRefundTraceId derives the refund trace id from the packet or snapshot
+// id, so a retried refund is never sent twice.
+func generateRefundTraceId(sourceId string) (string, error) {
 	h := md5.New()
-	io.WriteString(h, packetId)
+	io.WriteString(h, sourceId)
 	io.WriteString(h, "REFUND")
 	sum := h.Sum(nil)
 	sum[6] = (sum[6] & 0x0f) | 0x30
@@ -66,10 +66,13 @@ func testPacketCRUD(t *testing.T) {
 	assert.Nil(err)
 	assert.NotNil(packet)
 	assert.Equal(PacketStateInitial, packet.State)
-	packet, err = PayPacket(ctx, packet.PacketId, asset.AssetId, "1")
+	packet, err = PayPacket(ctx, "", packet.PacketId, asset.AssetId, "1")
 	assert.Nil(err)
 	assert.NotNil(packet)
 	assert.Equal(PacketStatePaid, packet.State)
+	paid, err := PayPacket(ctx, "", packet.PacketId, asset.AssetId, "1")
+	assert.Nil(err)
+	assert.Nil(paid)
 	packet, err = ShowPacket(ctx, packet.PacketId)
 	assert.Nil(err)
 	assert.NotNil(packet)
@@ -96,7 +99,7 @@ func testPacketCRUD(t *testing.T) {
 	packet, err = li.createPacket(ctx, asset.AssetId, number.FromString("1"), 2, "Hello Packet Hello Packet Hello Packet Hello Packet Hello")
 	assert.Nil(err)
 	assert.NotNil(packet)
-	packet, err = PayPacket(ctx, packet.PacketId, asset.AssetId, "1")
+	packet, err = PayPacket(ctx, "", packet.PacketId, asset.AssetId, "1")
 	assert.Nil(err)
 	assert.NotNil(packet)
 	assert.Equal(PacketStatePaid, packet.State)
@@ -97,7 +97,7 @@ func SendParticipantTransfer(ctx context.Context, packetId, userId string, amoun
 		}
 		ma := bot.NewUUIDMixAddress([]string{userId}, 1)
 		tr := &bot.TransactionRecipient{MixAddress: ma.String(), Amount: amount}
-		mixin := config.AppConfig.Mixin
+		mixin := config.AppConfig().Mixin
 		su := &bot.SafeUser{
 			UserId:            mixin.ClientId,
 			SessionId:         mixin.SessionId,
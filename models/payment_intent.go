@@ -0,0 +1,316 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	bot "github.com/MixinNetwork/bot-api-go-client/v2"
+	number "github.com/MixinNetwork/go-number"
+	"github.com/MixinNetwork/supergroup.mixin.one/config"
+	"github.com/MixinNetwork/supergroup.mixin.one/durable"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+)
+
+const (
+	PaymentIntentActionJoin   = "join"
+	PaymentIntentActionPacket = "packet"
+	PaymentIntentActionTip    = "tip"
+	PaymentIntentActionGift   = "gift"
+
+	PaymentIntentStatePending = "pending"
+	PaymentIntentStatePaid    = "paid"
+
+	PaymentMemoVersion = 1
+
+	defaultIntentDuration = time.Hour
+)
+
+// PaymentMemo is the memo of a payment intent, the base64 of its JSON. The
+// keys are short to fit the memo size, the intent is the source of truth and
+// the other fields must match it.
+type PaymentMemo struct {
+	Version   int    `json:"v"`
+	Action    string `json:"a"`
+	Target    string `json:"t"`
+	IntentId  string `json:"i"`
+	ExpiredAt int64  `json:"e"`
+}
+
+// ParsePaymentMemo returns nil if the memo is not a payment memo of a known
+// version, e.g. a legacy trace id, REWARD:<uid> or packet id.
+func ParsePaymentMemo(memo string) *PaymentMemo {
+	data, err := base64.RawURLEncoding.DecodeString(memo)
+	if err != nil {
+		return nil
+	}
+	var m PaymentMemo
+	if json.Unmarshal(data, &m) != nil || m.Version != PaymentMemoVersion || m.IntentId == "" {
+		return nil
+	}
+	return &m
+}
+
+func (m *PaymentMemo) Encode() string {
+	data, _ := json.Marshal(m)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// PaymentIntent is created by the API before a payment, the action tells how
+// the target is paid: join and gift pay the plan for the user or the target
+// user, packet pays the target packet and tip rewards the target user.
+type PaymentIntent struct {
+	IntentId   string
+	UserId     string
+	Action     string
+	Target     string
+	Plan       string
+	AssetId    string
+	Amount     string
+	State      string
+	SnapshotId string
+	ExpiredAt  time.Time
+	CreatedAt  time.Time
+
+	Packet *Packet
+}
+
+var paymentIntentsCols = []string{"intent_id", "user_id", "action", "target", "plan", "asset_id", "amount", "state", "snapshot_id", "expired_at", "created_at"}
+
+func (i *PaymentIntent) values() []interface{} {
+	return []interface{}{i.IntentId, i.UserId, i.Action, i.Target, i.Plan, i.AssetId, i.Amount, i.State, i.SnapshotId, i.ExpiredAt, i.CreatedAt}
+}
+
+func paymentIntentFromRow(row durable.Row) (*PaymentIntent, error) {
+	var i PaymentIntent
+	err := row.Scan(&i.IntentId, &i.UserId, &i.Action, &i.Target, &i.Plan, &i.AssetId, &i.Amount, &i.State, &i.SnapshotId, &i.ExpiredAt, &i.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return &i, err
+}
+
+func (i *PaymentIntent) Memo() string {
+	m := &PaymentMemo{
+		Version:   PaymentMemoVersion,
+		Action:    i.Action,
+		Target:    i.Target,
+		IntentId:  i.IntentId,
+		ExpiredAt: i.ExpiredAt.Unix(),
+	}
+	return m.Encode()
+}
+
+// CreatePaymentIntent prices the action, the plan is required by join and gift,
+// the asset and amount by tip, a packet intent uses those of the packet. The
+// gift target is a user id or identity number, resolved to the user id.
+func (current *User) CreatePaymentIntent(ctx context.Context, action, target, planName, assetId, amount string) (*PaymentIntent, error) {
+	intent := &PaymentIntent{
+		IntentId:  bot.UuidNewV4().String(),
+		UserId:    current.UserId,
+		Action:    action,
+		Target:    target,
+		AssetId:   assetId,
+		State:     PaymentIntentStatePending,
+		CreatedAt: time.Now(),
+	}
+	duration := defaultIntentDuration
+	switch action {
+	case PaymentIntentActionJoin, PaymentIntentActionGift:
+		if action == PaymentIntentActionJoin {
+			intent.Target = current.UserId
+		} else if recipientId, err := ResolveGiftRecipient(ctx, target); err != nil {
+			return nil, err
+		} else if recipientId == "" || recipientId == current.UserId {
+			return nil, session.BadDataError(ctx)
+		} else {
+			intent.Target = recipientId
+		}
+		plan := FindMembershipPlan(planName)
+		if plan == nil {
+			return nil, session.BadDataError(ctx)
+		}
+		intent.Plan = plan.Name
+		for _, a := range plan.Prices {
+			if a.AssetId == assetId {
+				intent.Amount = number.FromString(a.Amount).RoundFloor(8).Persist()
+			}
+		}
+		if intent.Amount == "" && number.FromString(plan.PriceUSD).Cmp(number.Zero()) > 0 && config.AppConfig().System.PriceAssetsEnable {
+			var err error
+			intent.Amount, _, err = quotePlanAmount(ctx, plan, assetId)
+			if err != nil {
+				return nil, err
+			}
+			duration = quoteDuration()
+		}
+		if action == PaymentIntentActionJoin && intent.Amount != "" {
+			var err error
+			intent.Amount, err = current.invitationAmount(ctx, plan, intent.Amount)
+			if err != nil {
+				return nil, err
+			}
+		}
+	case PaymentIntentActionPacket:
+		packet, err := ReadPacket(ctx, target)
+		if err != nil {
+			return nil, err
+		}
+		if packet == nil || packet.UserId != current.UserId || packet.State != PacketStateInitial {
+			return nil, session.BadDataError(ctx)
+		}
+		intent.AssetId, intent.Amount = packet.AssetId, packet.Amount
+	case PaymentIntentActionTip:
+		if !isPaymentTarget(ctx, target, current.UserId) {
+			return nil, session.BadDataError(ctx)
+		}
+		intent.Amount = number.FromString(amount).Persist()
+	}
+	if intent.Amount == "" || number.FromString(intent.Amount).Cmp(number.Zero()) <= 0 {
+		return nil, session.BadDataError(ctx)
+	}
+	intent.ExpiredAt = intent.CreatedAt.Add(duration)
+	query := durable.PrepareQuery("INSERT INTO payment_intents (%s) VALUES (%s)", paymentIntentsCols)
+	_, err := session.Database(ctx).ExecContext(ctx, query, intent.values()...)
+	if err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	return intent, nil
+}
+
+func (current *User) ReadPaymentIntent(ctx context.Context, intentId string) (*PaymentIntent, error) {
+	query := fmt.Sprintf("SELECT %s FROM payment_intents WHERE intent_id=$1", strings.Join(paymentIntentsCols, ","))
+	intent, err := paymentIntentFromRow(session.Database(ctx).QueryRowContext(ctx, query, intentId))
+	if err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	if intent == nil || intent.UserId != current.UserId {
+		return nil, session.NotFoundError(ctx)
+	}
+	return intent, nil
+}
+
+// PayPaymentIntent pays the intent of the memo with the transfer of the user
+// made at paidAt, it returns the refund memo instead if the transfer can't pay
+// the intent. A USD priced plan accepts an amount short by quote_tolerance, an
+// amount above the intent is refunded in full instead of kept.
+func (user *User) PayPaymentIntent(ctx context.Context, m *PaymentMemo, snapshotId, assetId, amount string, paidAt time.Time) (*PaymentIntent, string, error) {
+	var intent *PaymentIntent
+	var refund string
+	err := session.Database(ctx).RunInTransaction(ctx, nil, func(ctx context.Context, tx *sql.Tx) error {
+		query := fmt.Sprintf("SELECT %s FROM payment_intents WHERE intent_id=$1 FOR UPDATE", strings.Join(paymentIntentsCols, ","))
+		i, err := paymentIntentFromRow(tx.QueryRowContext(ctx, query, m.IntentId))
+		if err != nil {
+			return err
+		}
+		if i == nil || i.UserId != user.UserId || i.Action != m.Action || i.Target != m.Target || i.ExpiredAt.Before(paidAt) {
+			refund = RefundMemoIntentInvalid
+			return nil
+		}
+		if i.State != PaymentIntentStatePending {
+			refund = RefundMemoIntentPaid
+			return nil
+		}
+		expected := number.FromString(i.Amount)
+		plan := FindMembershipPlan(i.Plan)
+		if plan != nil && number.FromString(plan.PriceUSD).Cmp(number.Zero()) > 0 {
+			expected = expected.Mul(number.FromString("1").Sub(number.FromString(config.AppConfig().System.QuoteTolerance)))
+		}
+		received := number.FromString(amount)
+		if i.AssetId != assetId || received.Cmp(expected) < 0 || received.Cmp(number.FromString(i.Amount)) > 0 {
+			refund = RefundMemoMismatched
+			return nil
+		}
+
+		paid := true
+		switch i.Action {
+		case PaymentIntentActionJoin:
+			recipient, err := findUserById(ctx, tx, i.Target)
+			if err != nil {
+				return err
+			}
+			if recipient == nil || plan == nil {
+				paid = false
+				break
+			}
+			paid, err = recipient.payMembershipInTx(ctx, tx, plan, assetId, i.Amount)
+			if err != nil {
+				return err
+			}
+		case PaymentIntentActionGift:
+			if plan == nil {
+				paid = false
+				break
+			}
+			gift, r, err := user.giftMembershipInTx(ctx, tx, snapshotId, i.Target, plan, assetId, amount, i.Amount)
+			if err != nil {
+				return err
+			}
+			if r != "" {
+				refund = r
+				return nil
+			}
+			paid = gift != nil
+		case PaymentIntentActionPacket:
+			i.Packet, err = payPacketInTx(ctx, tx, i.Target, assetId, amount)
+			if err != nil {
+				return err
+			}
+			paid = i.Packet != nil
+		case PaymentIntentActionTip:
+			reward, err := createRewardInTx(ctx, tx, snapshotId, user.UserId, i.Target, assetId, amount)
+			if err != nil {
+				return err
+			}
+			paid = reward != nil
+		}
+		if !paid {
+			refund = RefundMemoNotAccepted
+			return nil
+		}
+		i.State, i.SnapshotId = PaymentIntentStatePaid, snapshotId
+		_, err = tx.ExecContext(ctx, "UPDATE payment_intents SET (state,snapshot_id)=($1,$2) WHERE intent_id=$3", i.State, i.SnapshotId, i.IntentId)
+		if err != nil {
+			return err
+		}
+		intent = i
+		return resolveSnapshotInTx(ctx, tx, snapshotId, i.purpose())
+	})
+	if err != nil {
+		return nil, "", session.TransactionError(ctx, err)
+	}
+	return intent, refund, nil
+}
+
+// purpose is the snapshot purpose of the payment to the intent.
+func (i *PaymentIntent) purpose() string {
+	switch i.Action {
+	case PaymentIntentActionPacket:
+		return SnapshotPurposePacket
+	case PaymentIntentActionTip:
+		return SnapshotPurposeReward
+	}
+	return SnapshotPurposeMembership
+}
+
+func LoopClearUpExpiredPaymentIntents(ctx context.Context) (int64, error) {
+	query := "DELETE FROM payment_intents WHERE intent_id IN (SELECT intent_id FROM payment_intents WHERE state=$1 AND expired_at<$2 LIMIT 100)"
+	r, err := session.Database(ctx).ExecContext(ctx, query, PaymentIntentStatePending, time.Now().Add(-24*time.Hour))
+	if err != nil {
+		return 0, session.TransactionError(ctx, err)
+	}
+	return r.RowsAffected()
+}
+
+// isPaymentTarget checks the target is another user of the group.
+func isPaymentTarget(ctx context.Context, target, userId string) bool {
+	if target == userId {
+		return false
+	}
+	user, err := FindUser(ctx, target)
+	return err == nil && user != nil
+}
@@ -0,0 +1,134 @@
+package models
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	bot "github.com/MixinNetwork/bot-api-go-client/v2"
+	"github.com/MixinNetwork/supergroup.mixin.one/config"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPaymentIntentCRUD(t *testing.T) {
+	assert := assert.New(t)
+	ctx := setupTestContext()
+	defer teardownTestContext(ctx)
+
+	assetId := bot.UuidNewV4().String()
+	system := config.AppConfig().System
+	defer func() { config.AppConfig().System = system }()
+	config.AppConfig().System.MembershipPlanList = []config.MembershipPlan{
+		{Name: "monthly", Duration: 2592000, Prices: []config.PaymentAsset{{Symbol: "XIN", AssetId: assetId, Amount: "0.001"}}},
+	}
+	err := upsertAssets(ctx, []*Asset{{AssetId: assetId, Symbol: "XIN", Name: "Mixin", PriceBTC: "0", PriceUSD: "100"}})
+	assert.Nil(err)
+
+	assert.Nil(ParsePaymentMemo(""))
+	assert.Nil(ParsePaymentMemo(bot.UuidNewV4().String()))
+	assert.Nil(ParsePaymentMemo("REWARD:" + bot.UuidNewV4().String()))
+	memo := &PaymentMemo{Version: PaymentMemoVersion, Action: PaymentIntentActionJoin, IntentId: bot.UuidNewV4().String()}
+	assert.Equal(memo, ParsePaymentMemo(memo.Encode()))
+	memo.Version = 2
+	assert.Nil(ParsePaymentMemo(memo.Encode()))
+
+	var users []*User
+	for i := 0; i < 2; i++ {
+		pub, priv, err := ed25519.GenerateKey(rand.Reader)
+		assert.Nil(err)
+		public := base64.RawURLEncoding.EncodeToString(pub)
+		private := base64.RawURLEncoding.EncodeToString(priv)
+		user, err := createUser(ctx, public, private, bot.UuidNewV4().String(), "", bot.UuidNewV4().String(), "1000", "name", "http://localhost")
+		assert.Nil(err)
+		users = append(users, user)
+	}
+	user, friend := users[0], users[1]
+
+	_, err = user.CreatePaymentIntent(ctx, PaymentIntentActionJoin, "", "yearly", assetId, "")
+	assert.NotNil(err)
+	_, err = user.CreatePaymentIntent(ctx, PaymentIntentActionJoin, "", "monthly", bot.UuidNewV4().String(), "")
+	assert.NotNil(err)
+	_, err = user.CreatePaymentIntent(ctx, PaymentIntentActionGift, user.UserId, "monthly", assetId, "")
+	assert.NotNil(err)
+	_, err = user.CreatePaymentIntent(ctx, PaymentIntentActionTip, friend.UserId, "", assetId, "0")
+	assert.NotNil(err)
+	_, err = user.CreatePaymentIntent(ctx, "unknown", "", "monthly", assetId, "0.001")
+	assert.NotNil(err)
+
+	intent, err := user.CreatePaymentIntent(ctx, PaymentIntentActionJoin, "", "monthly", assetId, "")
+	assert.Nil(err)
+	assert.Equal(user.UserId, intent.Target)
+	assert.Equal("0.001", intent.Amount)
+	assert.True(intent.ExpiredAt.After(time.Now()))
+	m := ParsePaymentMemo(intent.Memo())
+	assert.NotNil(m)
+	assert.Equal(intent.IntentId, m.IntentId)
+	_, err = friend.ReadPaymentIntent(ctx, intent.IntentId)
+	assert.NotNil(err)
+
+	paid, refund, err := friend.PayPaymentIntent(ctx, m, bot.UuidNewV4().String(), assetId, "0.001", time.Now())
+	assert.Nil(err)
+	assert.Nil(paid)
+	assert.Equal(RefundMemoIntentInvalid, refund)
+	paid, refund, err = user.PayPaymentIntent(ctx, m, bot.UuidNewV4().String(), assetId, "0.0009", time.Now())
+	assert.Nil(err)
+	assert.Nil(paid)
+	assert.Equal(RefundMemoMismatched, refund)
+	paid, refund, err = user.PayPaymentIntent(ctx, m, bot.UuidNewV4().String(), assetId, "0.0011", time.Now())
+	assert.Nil(err)
+	assert.Nil(paid)
+	assert.Equal(RefundMemoMismatched, refund)
+	snapshotId := bot.UuidNewV4().String()
+	paid, refund, err = user.PayPaymentIntent(ctx, m, snapshotId, assetId, "0.001", time.Now())
+	assert.Nil(err)
+	assert.Equal("", refund)
+	assert.Equal(PaymentIntentStatePaid, paid.State)
+	assert.Equal(snapshotId, paid.SnapshotId)
+	intent, err = user.ReadPaymentIntent(ctx, intent.IntentId)
+	assert.Nil(err)
+	assert.Equal(PaymentIntentStatePaid, intent.State)
+	user, err = FindUser(ctx, user.UserId)
+	assert.Nil(err)
+	assert.Equal(PaymentStatePaid, user.State)
+	paid, refund, err = user.PayPaymentIntent(ctx, m, bot.UuidNewV4().String(), assetId, "0.001", time.Now())
+	assert.Nil(err)
+	assert.Nil(paid)
+	assert.Equal(RefundMemoIntentPaid, refund)
+
+	intent, err = user.CreatePaymentIntent(ctx, PaymentIntentActionGift, friend.UserId, "monthly", assetId, "")
+	assert.Nil(err)
+	paid, refund, err = user.PayPaymentIntent(ctx, ParsePaymentMemo(intent.Memo()), bot.UuidNewV4().String(), assetId, "0.001", time.Now())
+	assert.Nil(err)
+	assert.NotNil(paid)
+	friend, err = FindUser(ctx, friend.UserId)
+	assert.Nil(err)
+	assert.Equal(PaymentStatePaid, friend.State)
+
+	intent, err = user.CreatePaymentIntent(ctx, PaymentIntentActionTip, friend.UserId, "", assetId, "0.5")
+	assert.Nil(err)
+	_, err = session.Database(ctx).Exec("UPDATE payment_intents SET expired_at=$1 WHERE intent_id=$2", time.Now().Add(-48*time.Hour), intent.IntentId)
+	assert.Nil(err)
+	paid, refund, err = user.PayPaymentIntent(ctx, ParsePaymentMemo(intent.Memo()), bot.UuidNewV4().String(), assetId, "0.5", time.Now())
+	assert.Nil(err)
+	assert.Nil(paid)
+	assert.Equal(RefundMemoIntentInvalid, refund)
+	deleted, err := LoopClearUpExpiredPaymentIntents(ctx)
+	assert.Nil(err)
+	assert.Equal(int64(1), deleted)
+
+	intent, err = user.CreatePaymentIntent(ctx, PaymentIntentActionTip, friend.UserId, "", assetId, "0.5")
+	assert.Nil(err)
+	_, err = session.Database(ctx).Exec("UPDATE payment_intents SET expired_at=$1 WHERE intent_id=$2", time.Now().Add(-time.Minute), intent.IntentId)
+	assert.Nil(err)
+	snapshotId = bot.UuidNewV4().String()
+	paid, refund, err = user.PayPaymentIntent(ctx, ParsePaymentMemo(intent.Memo()), snapshotId, assetId, "0.5", time.Now().Add(-2*time.Minute))
+	assert.Nil(err)
+	assert.NotNil(paid)
+	rewards, err := PendingRewards(ctx, 10)
+	assert.Nil(err)
+	assert.Len(rewards, 1)
+	assert.Equal(snapshotId, rewards[0].RewardId)
+}
@@ -0,0 +1,264 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	bot "github.com/MixinNetwork/bot-api-go-client/v2"
+	number "github.com/MixinNetwork/go-number"
+	"github.com/MixinNetwork/supergroup.mixin.one/config"
+	"github.com/MixinNetwork/supergroup.mixin.one/durable"
+	"github.com/MixinNetwork/supergroup.mixin.one/externals"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+)
+
+const (
+	PaymentQuoteStatePending = "pending"
+	PaymentQuoteStatePaid    = "paid"
+
+	defaultQuoteDuration = 10 * time.Minute
+)
+
+// PriceSource reads the USD prices of the assets, the prices are stored in
+// the assets table and refreshed by RefreshAssetPrices.
+type PriceSource interface {
+	ReadAssets(ctx context.Context, assetIds []string) ([]*Asset, error)
+}
+
+type mixinPriceSource struct{}
+
+func (mixinPriceSource) ReadAssets(ctx context.Context, assetIds []string) ([]*Asset, error) {
+	var assets []*Asset
+	for _, id := range assetIds {
+		a, err := externals.ReadNetworkAsset(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		assets = append(assets, &Asset{
+			AssetId:  a.AssetID,
+			Symbol:   a.Symbol,
+			Name:     a.Name,
+			IconURL:  a.IconURL,
+			PriceBTC: a.PriceBTC,
+			PriceUSD: a.PriceUSD,
+		})
+	}
+	return assets, nil
+}
+
+var priceSource PriceSource = mixinPriceSource{}
+
+func SetPriceSource(source PriceSource) {
+	priceSource = source
+}
+
+type PaymentQuote struct {
+	QuoteId   string
+	UserId    string
+	Plan      string
+	AssetId   string
+	Amount    string
+	AmountUSD string
+	PriceUSD  string
+	State     string
+	ExpiredAt time.Time
+	CreatedAt time.Time
+}
+
+var paymentQuotesCols = []string{"quote_id", "user_id", "plan", "asset_id", "amount", "amount_usd", "price_usd", "state", "expired_at", "created_at"}
+
+func (q *PaymentQuote) values() []interface{} {
+	return []interface{}{q.QuoteId, q.UserId, q.Plan, q.AssetId, q.Amount, q.AmountUSD, q.PriceUSD, q.State, q.ExpiredAt, q.CreatedAt}
+}
+
+func paymentQuoteFromRow(row durable.Row) (*PaymentQuote, error) {
+	var q PaymentQuote
+	err := row.Scan(&q.QuoteId, &q.UserId, &q.Plan, &q.AssetId, &q.Amount, &q.AmountUSD, &q.PriceUSD, &q.State, &q.ExpiredAt, &q.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return &q, err
+}
+
+// CreatePaymentQuote locks the amount of the asset for the USD price of the
+// plan during quote_duration.
+func (current *User) CreatePaymentQuote(ctx context.Context, planName, assetId string) (*PaymentQuote, *Asset, error) {
+	if !config.AppConfig().System.PriceAssetsEnable {
+		return nil, nil, session.ForbiddenError(ctx)
+	}
+	plan := FindMembershipPlan(planName)
+	if plan == nil || number.FromString(plan.PriceUSD).Cmp(number.Zero()) <= 0 {
+		return nil, nil, session.BadDataError(ctx)
+	}
+	amount, asset, err := quotePlanAmount(ctx, plan, assetId)
+	if err != nil {
+		return nil, nil, err
+	}
+	q := &PaymentQuote{
+		QuoteId:   bot.UuidNewV4().String(),
+		UserId:    current.UserId,
+		Plan:      plan.Name,
+		AssetId:   assetId,
+		Amount:    amount,
+		AmountUSD: plan.PriceUSD,
+		PriceUSD:  asset.PriceUSD,
+		State:     PaymentQuoteStatePending,
+		CreatedAt: time.Now(),
+	}
+	q.ExpiredAt = q.CreatedAt.Add(quoteDuration())
+	query := durable.PrepareQuery("INSERT INTO payment_quotes (%s) VALUES (%s)", paymentQuotesCols)
+	_, err = session.Database(ctx).ExecContext(ctx, query, q.values()...)
+	if err != nil {
+		return nil, nil, session.TransactionError(ctx, err)
+	}
+	return q, asset, nil
+}
+
+// PayPaymentQuote pays the membership with the latest quote of the asset
+// unexpired when the transfer was made at paidAt, the amount may be short of
+// the quote by quote_tolerance but not above it. It returns nil if no quote
+// matches or nothing was paid, and the transfer is refunded in full.
+func (user *User) PayPaymentQuote(ctx context.Context, snapshotId, assetId, amount string, paidAt time.Time) (*PaymentQuote, error) {
+	var quote *PaymentQuote
+	err := session.Database(ctx).RunInTransaction(ctx, nil, func(ctx context.Context, tx *sql.Tx) error {
+		query := fmt.Sprintf("SELECT %s FROM payment_quotes WHERE user_id=$1 AND asset_id=$2 AND state=$3 AND expired_at>$4 ORDER BY created_at DESC LIMIT 10", strings.Join(paymentQuotesCols, ","))
+		rows, err := tx.QueryContext(ctx, query, user.UserId, assetId, PaymentQuoteStatePending, paidAt)
+		if err != nil {
+			return err
+		}
+		var quotes []*PaymentQuote
+		for rows.Next() {
+			q, err := paymentQuoteFromRow(rows)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			quotes = append(quotes, q)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		received := number.FromString(amount)
+		tolerance := number.FromString("1").Sub(number.FromString(config.AppConfig().System.QuoteTolerance))
+		for _, q := range quotes {
+			if received.Cmp(number.FromString(q.Amount).Mul(tolerance)) < 0 || received.Cmp(number.FromString(q.Amount)) > 0 {
+				continue
+			}
+			plan := FindMembershipPlan(q.Plan)
+			if plan == nil {
+				continue
+			}
+			paid, err := user.payMembershipInTx(ctx, tx, plan, assetId, q.Amount)
+			if err != nil || !paid {
+				return err
+			}
+			_, err = tx.ExecContext(ctx, "UPDATE payment_quotes SET state=$1 WHERE quote_id=$2", PaymentQuoteStatePaid, q.QuoteId)
+			if err != nil {
+				return err
+			}
+			q.State = PaymentQuoteStatePaid
+			quote = q
+			return resolveSnapshotInTx(ctx, tx, snapshotId, SnapshotPurposeMembership)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	return quote, nil
+}
+
+// RefreshAssetPrices reads the prices of quote_asset_list from the price source.
+func RefreshAssetPrices(ctx context.Context) (int, error) {
+	var ids []string
+	for _, a := range config.AppConfig().System.QuoteAssetList {
+		ids = append(ids, a.AssetId)
+	}
+	if len(ids) == 0 || !config.AppConfig().System.PriceAssetsEnable {
+		return 0, nil
+	}
+	assets, err := priceSource.ReadAssets(ctx, ids)
+	if err != nil || len(assets) == 0 {
+		return 0, err
+	}
+	err = upsertAssets(ctx, assets)
+	if err != nil {
+		return 0, session.TransactionError(ctx, err)
+	}
+	return len(assets), nil
+}
+
+func LoopClearUpExpiredPaymentQuotes(ctx context.Context) (int64, error) {
+	query := "DELETE FROM payment_quotes WHERE quote_id IN (SELECT quote_id FROM payment_quotes WHERE state=$1 AND expired_at<$2 LIMIT 100)"
+	r, err := session.Database(ctx).ExecContext(ctx, query, PaymentQuoteStatePending, time.Now().Add(-24*time.Hour))
+	if err != nil {
+		return 0, session.TransactionError(ctx, err)
+	}
+	return r.RowsAffected()
+}
+
+// readAssetPrice reads the refreshed price, or asks the price source if the
+// asset hasn't been refreshed yet.
+func readAssetPrice(ctx context.Context, assetId string) (*Asset, error) {
+	var asset *Asset
+	err := session.Database(ctx).RunInTransaction(ctx, nil, func(ctx context.Context, tx *sql.Tx) error {
+		var err error
+		asset, err = findAssetById(ctx, tx, assetId)
+		return err
+	})
+	if err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	if asset != nil && number.FromString(asset.PriceUSD).Cmp(number.Zero()) > 0 {
+		return asset, nil
+	}
+	assets, err := priceSource.ReadAssets(ctx, []string{assetId})
+	if err != nil {
+		return nil, session.ServerError(ctx, err)
+	}
+	if len(assets) != 1 {
+		return nil, session.NotFoundError(ctx)
+	}
+	err = upsertAssets(ctx, assets)
+	if err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	return assets[0], nil
+}
+
+// quotePlanAmount converts the USD price of the plan to the amount of the asset.
+func quotePlanAmount(ctx context.Context, plan *config.MembershipPlan, assetId string) (string, *Asset, error) {
+	if !isQuoteAsset(assetId) {
+		return "", nil, session.BadDataError(ctx)
+	}
+	asset, err := readAssetPrice(ctx, assetId)
+	if err != nil {
+		return "", nil, err
+	}
+	price := number.FromString(asset.PriceUSD)
+	if price.Cmp(number.Zero()) <= 0 {
+		return "", nil, session.BadDataError(ctx)
+	}
+	return number.FromString(plan.PriceUSD).Div(price).RoundCeil(8).Persist(), asset, nil
+}
+
+func quoteDuration() time.Duration {
+	if d := config.AppConfig().System.QuoteDuration; d > 0 {
+		return time.Duration(d) * time.Second
+	}
+	return defaultQuoteDuration
+}
+
+func isQuoteAsset(assetId string) bool {
+	for _, a := range config.AppConfig().System.QuoteAssetList {
+		if a.AssetId == assetId {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,110 @@
+package models
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	bot "github.com/MixinNetwork/bot-api-go-client/v2"
+	"github.com/MixinNetwork/supergroup.mixin.one/config"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+	"github.com/stretchr/testify/assert"
+)
+
+type testPriceSource map[string]string
+
+func (s testPriceSource) ReadAssets(ctx context.Context, assetIds []string) ([]*Asset, error) {
+	var assets []*Asset
+	for _, id := range assetIds {
+		assets = append(assets, &Asset{AssetId: id, Symbol: "XIN", Name: "Mixin", PriceBTC: "0", PriceUSD: s[id]})
+	}
+	return assets, nil
+}
+
+func TestPaymentQuoteCRUD(t *testing.T) {
+	assert := assert.New(t)
+	ctx := setupTestContext()
+	defer teardownTestContext(ctx)
+
+	assetId := bot.UuidNewV4().String()
+	system := config.AppConfig().System
+	defer func() { config.AppConfig().System = system }()
+	config.AppConfig().System.PriceAssetsEnable = true
+	config.AppConfig().System.MembershipPlanList = []config.MembershipPlan{
+		{Name: "monthly", Duration: 2592000, PriceUSD: "10"},
+		{Name: "lifetime", Duration: 0, Prices: []config.PaymentAsset{{Symbol: "XIN", AssetId: assetId, Amount: "0.05"}}},
+	}
+	config.AppConfig().System.QuoteAssetList = []config.PaymentAsset{{Symbol: "XIN", AssetId: assetId}}
+	config.AppConfig().System.QuoteTolerance = "0.01"
+	source := testPriceSource{assetId: "200"}
+	SetPriceSource(source)
+	defer SetPriceSource(mixinPriceSource{})
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(err)
+	public := base64.RawURLEncoding.EncodeToString(pub)
+	private := base64.RawURLEncoding.EncodeToString(priv)
+	user, err := createUser(ctx, public, private, bot.UuidNewV4().String(), "", bot.UuidNewV4().String(), "1000", "name", "http://localhost")
+	assert.Nil(err)
+	assert.NotNil(user)
+
+	quote, asset, err := user.CreatePaymentQuote(ctx, "lifetime", assetId)
+	assert.NotNil(err)
+	quote, asset, err = user.CreatePaymentQuote(ctx, "monthly", bot.UuidNewV4().String())
+	assert.NotNil(err)
+	quote, asset, err = user.CreatePaymentQuote(ctx, "monthly", assetId)
+	assert.Nil(err)
+	assert.NotNil(quote)
+	assert.Equal("200", asset.PriceUSD)
+	assert.Equal("0.05", quote.Amount)
+	assert.True(quote.ExpiredAt.After(time.Now()))
+
+	source[assetId] = "100"
+	count, err := RefreshAssetPrices(ctx)
+	assert.Nil(err)
+	assert.Equal(1, count)
+	quote, asset, err = user.CreatePaymentQuote(ctx, "monthly", assetId)
+	assert.Nil(err)
+	assert.Equal("100", asset.PriceUSD)
+	assert.Equal("0.1", quote.Amount)
+
+	paid, err := user.PayPaymentQuote(ctx, "", assetId, "0.04", time.Now())
+	assert.Nil(err)
+	assert.Nil(paid)
+	paid, err = user.PayPaymentQuote(ctx, "", assetId, "0.2", time.Now())
+	assert.Nil(err)
+	assert.Nil(paid)
+	paid, err = user.PayPaymentQuote(ctx, "", assetId, "0.0995", time.Now())
+	assert.Nil(err)
+	assert.NotNil(paid)
+	assert.Equal(quote.QuoteId, paid.QuoteId)
+	assert.Equal(PaymentQuoteStatePaid, paid.State)
+	user, err = FindUser(ctx, user.UserId)
+	assert.Nil(err)
+	assert.Equal(PaymentStatePaid, user.State)
+	assert.True(user.PaidUntil.After(time.Now().Add(29 * 24 * time.Hour)))
+
+	_, err = session.Database(ctx).Exec("UPDATE payment_quotes SET expired_at=$1", time.Now().Add(-48*time.Hour))
+	assert.Nil(err)
+	paid, err = user.PayPaymentQuote(ctx, "", assetId, "0.05", time.Now())
+	assert.Nil(err)
+	assert.Nil(paid)
+	deleted, err := LoopClearUpExpiredPaymentQuotes(ctx)
+	assert.Nil(err)
+	assert.Equal(int64(1), deleted)
+
+	quote, _, err = user.CreatePaymentQuote(ctx, "monthly", assetId)
+	assert.Nil(err)
+	_, err = session.Database(ctx).Exec("UPDATE payment_quotes SET expired_at=$1 WHERE quote_id=$2", time.Now().Add(-time.Minute), quote.QuoteId)
+	assert.Nil(err)
+	paid, err = user.PayPaymentQuote(ctx, "", assetId, "0.1", time.Now())
+	assert.Nil(err)
+	assert.Nil(paid)
+	paid, err = user.PayPaymentQuote(ctx, "", assetId, "0.1", time.Now().Add(-2*time.Minute))
+	assert.Nil(err)
+	assert.NotNil(paid)
+	assert.Equal(quote.QuoteId, paid.QuoteId)
+}
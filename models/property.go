@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"encoding/base64"
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
@@ -15,6 +16,7 @@ import (
 
 const (
 	ProhibitedMessage = "prohibited-message-property"
+	SlowModeMessage   = "slow-mode-message-property"
 )
 
 type Property struct {
@@ -38,26 +40,36 @@ func propertyFromRow(row durable.Row) (*Property, error) {
 	return &p, err
 }
 
-func CreateProperty(ctx context.Context, name string, value bool) (*Property, error) {
+func (current *User) CreateProperty(ctx context.Context, name string, value bool) (*Property, error) {
+	if !current.Can(ctx, PermissionProhibit) {
+		return nil, session.ForbiddenError(ctx)
+	}
 	property := &Property{
 		Name:      name,
 		Value:     fmt.Sprint(value),
 		CreatedAt: time.Now(),
 	}
 	query := durable.PrepareQuery("INSERT INTO properties (%s) VALUES (%s) ON CONFLICT (name) DO UPDATE SET value=EXCLUDED.value", propertiesColumns)
-	session.Database(ctx).RunInTransaction(ctx, nil, func(ctx context.Context, tx *sql.Tx) error {
-		_, err := tx.ExecContext(ctx, query, property.values()...)
+	err := session.Database(ctx).RunInTransaction(ctx, nil, func(ctx context.Context, tx *sql.Tx) error {
+		old, err := readPropertyAsBool(ctx, tx, name)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, query, property.values()...)
+		if err != nil {
+			return err
+		}
+		err = createAuditEventInTx(ctx, tx, current.UserId, AuditActionSetProperty, name, "", old, value)
 		if err != nil {
 			return err
 		}
-		data := config.AppConfig
+		data := config.AppConfig()
 		text := data.MessageTemplate.MessageAllow
 		if value {
 			text = data.MessageTemplate.MessageProhibit
 		}
 		return createSystemMessage(ctx, tx, MessageCategoryPlainText, base64.RawURLEncoding.EncodeToString([]byte(text)))
 	})
-	_, err := session.Database(ctx).ExecContext(ctx, query, property.values()...)
 	if err != nil {
 		return nil, session.TransactionError(ctx, err)
 	}
@@ -100,3 +112,66 @@ func ReadProhibitedProperty(ctx context.Context) (bool, error) {
 func readProhibitedStatus(ctx context.Context, tx *sql.Tx) (bool, error) {
 	return readPropertyAsBool(ctx, tx, ProhibitedMessage)
 }
+
+// CreateSlowModeProperty allows each member one message every seconds, zero turns it off.
+func (current *User) CreateSlowModeProperty(ctx context.Context, seconds int64) (*Property, error) {
+	if !current.Can(ctx, PermissionProhibit) {
+		return nil, session.ForbiddenError(ctx)
+	}
+	if seconds < 0 {
+		return nil, session.BadDataError(ctx)
+	}
+	property := &Property{
+		Name:      SlowModeMessage,
+		Value:     fmt.Sprint(seconds),
+		CreatedAt: time.Now(),
+	}
+	query := durable.PrepareQuery("INSERT INTO properties (%s) VALUES (%s) ON CONFLICT (name) DO UPDATE SET value=EXCLUDED.value", propertiesColumns)
+	err := session.Database(ctx).RunInTransaction(ctx, nil, func(ctx context.Context, tx *sql.Tx) error {
+		old, err := readPropertyAsInt(ctx, tx, SlowModeMessage)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, query, property.values()...)
+		if err != nil {
+			return err
+		}
+		err = createAuditEventInTx(ctx, tx, current.UserId, AuditActionSetProperty, SlowModeMessage, "", old, seconds)
+		if err != nil {
+			return err
+		}
+		data := config.AppConfig()
+		text := data.MessageTemplate.MessageSlowModeOff
+		if seconds > 0 {
+			text = fmt.Sprintf(data.MessageTemplate.MessageSlowModeOn, seconds)
+		}
+		return createSystemMessage(ctx, tx, MessageCategoryPlainText, base64.RawURLEncoding.EncodeToString([]byte(text)))
+	})
+	if err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	return property, nil
+}
+
+func ReadSlowModeProperty(ctx context.Context) (int64, error) {
+	var seconds int64
+	err := session.Database(ctx).RunInTransaction(ctx, nil, func(ctx context.Context, tx *sql.Tx) error {
+		var err error
+		seconds, err = readPropertyAsInt(ctx, tx, SlowModeMessage)
+		return err
+	})
+	if err != nil {
+		return 0, session.TransactionError(ctx, err)
+	}
+	return seconds, nil
+}
+
+func readPropertyAsInt(ctx context.Context, tx *sql.Tx, name string) (int64, error) {
+	query := fmt.Sprintf("SELECT %s FROM properties WHERE name=$1", strings.Join(propertiesColumns, ","))
+	row := tx.QueryRowContext(ctx, query, name)
+	property, err := propertyFromRow(row)
+	if err != nil || property == nil {
+		return 0, err
+	}
+	return strconv.ParseInt(property.Value, 10, 64)
+}
@@ -4,7 +4,10 @@ import (
 	"context"
 	"database/sql"
 	"testing"
+	"time"
 
+	bot "github.com/MixinNetwork/bot-api-go-client/v2"
+	"github.com/MixinNetwork/supergroup.mixin.one/config"
 	"github.com/MixinNetwork/supergroup.mixin.one/session"
 	"github.com/stretchr/testify/assert"
 )
@@ -14,11 +17,12 @@ func TestPropertyCRUD(t *testing.T) {
 	ctx := setupTestContext()
 	defer teardownTestContext(ctx)
 
+	admin := &User{UserId: config.AppConfig().System.OperatorList[0]}
 	name := ProhibitedMessage
 	b, err := testReadPropertyAsBool(ctx, name)
 	assert.False(b)
 	assert.Nil(err)
-	p, err := CreateProperty(ctx, name, true)
+	p, err := admin.CreateProperty(ctx, name, true)
 	assert.Nil(err)
 	assert.NotNil(p)
 	p, err = ReadProperty(ctx, name)
@@ -31,7 +35,7 @@ func TestPropertyCRUD(t *testing.T) {
 	b, err = testReadPropertyAsBool(ctx, name)
 	assert.True(b)
 	assert.Nil(err)
-	p, err = CreateProperty(ctx, name, false)
+	p, err = admin.CreateProperty(ctx, name, false)
 	assert.Nil(err)
 	assert.NotNil(p)
 	p, err = ReadProperty(ctx, name)
@@ -44,6 +48,36 @@ func TestPropertyCRUD(t *testing.T) {
 	b, err = ReadProhibitedProperty(ctx)
 	assert.Nil(err)
 	assert.False(b)
+
+	seconds, err := ReadSlowModeProperty(ctx)
+	assert.Nil(err)
+	assert.Equal(int64(0), seconds)
+	p, err = (&User{UserId: bot.UuidNewV4().String()}).CreateSlowModeProperty(ctx, 30)
+	assert.NotNil(err)
+	assert.Nil(p)
+	p, err = admin.CreateSlowModeProperty(ctx, -1)
+	assert.NotNil(err)
+	p, err = admin.CreateSlowModeProperty(ctx, 30)
+	assert.Nil(err)
+	assert.NotNil(p)
+	seconds, err = ReadSlowModeProperty(ctx)
+	assert.Nil(err)
+	assert.Equal(int64(30), seconds)
+
+	user := &User{UserId: bot.UuidNewV4().String()}
+	wait, err := takeSlowModeRate(ctx, user)
+	assert.Nil(err)
+	assert.Equal(time.Duration(0), wait)
+	wait, err = takeSlowModeRate(ctx, user)
+	assert.Nil(err)
+	assert.True(wait > 29*time.Second)
+
+	p, err = admin.CreateSlowModeProperty(ctx, 0)
+	assert.Nil(err)
+	assert.NotNil(p)
+	wait, err = takeSlowModeRate(ctx, user)
+	assert.Nil(err)
+	assert.Equal(time.Duration(0), wait)
 }
 
 func testReadPropertyAsBool(ctx context.Context, name string) (bool, error) {
@@ -0,0 +1,83 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"github.com/MixinNetwork/supergroup.mixin.one/config"
+	"github.com/MixinNetwork/supergroup.mixin.one/durable"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+)
+
+// takeMessageRate consumes from the category, the user and the group buckets
+// together, a message rejected by any of them consumes none, and returns the
+// wait of the first empty one.
+func takeMessageRate(ctx context.Context, user *User, category string) (time.Duration, error) {
+	system := config.AppConfig().System
+	policy, found := system.RateLimits[roleOf(ctx, user.UserId)]
+	if !found {
+		policy.Message = config.RateLimit{Duration: system.LimitMessageDuration, Number: system.LimitMessageNumber}
+	}
+	kind, limit := "text", policy.Text
+	if isMediaCategory(category) {
+		kind, limit = "media", policy.Media
+	}
+	wait, err := durable.Take(ctx,
+		rateLimitBucket("user:"+user.UserId+":"+kind, limit),
+		rateLimitBucket("user:"+user.UserId, policy.Message),
+		rateLimitBucket("group", system.GroupRateLimit),
+	)
+	if err != nil {
+		return 0, session.TransactionError(ctx, err)
+	}
+	return wait, nil
+}
+
+// takeSlowModeRate allows one message every slow mode seconds for each member.
+func takeSlowModeRate(ctx context.Context, user *User) (time.Duration, error) {
+	seconds, err := ReadSlowModeProperty(ctx)
+	if err != nil || seconds <= 0 {
+		return 0, err
+	}
+	return takeRateLimit(ctx, "slow:"+user.UserId, config.RateLimit{Duration: seconds, Number: 1})
+}
+
+func takeProbationRate(ctx context.Context, user *User) (time.Duration, error) {
+	system := config.AppConfig().System
+	limit := config.RateLimit{Duration: system.ProbationLimitDuration, Number: system.ProbationLimitNumber}
+	return takeRateLimit(ctx, "probation:"+user.UserId, limit)
+}
+
+func takeRateLimit(ctx context.Context, key string, limit config.RateLimit) (time.Duration, error) {
+	wait, err := durable.Take(ctx, rateLimitBucket(key, limit))
+	if err != nil {
+		return 0, session.TransactionError(ctx, err)
+	}
+	return wait, nil
+}
+
+func rateLimitBucket(key string, limit config.RateLimit) durable.Bucket {
+	return durable.Bucket{Key: key, Period: time.Duration(limit.Duration) * time.Second, Number: limit.Number}
+}
+
+func isMediaCategory(category string) bool {
+	switch category {
+	case MessageCategoryPlainImage, MessageCategoryEncryptedImage,
+		MessageCategoryPlainVideo, MessageCategoryEncryptedVideo,
+		MessageCategoryPlainLive, MessageCategoryEncryptedLive,
+		MessageCategoryPlainAudio, MessageCategoryEncryptedAudio,
+		MessageCategoryPlainData, MessageCategoryEncryptedData,
+		MessageCategoryPlainSticker, MessageCategoryEncryptedSticker:
+		return true
+	}
+	return false
+}
+
+func LoopClearUpExpiredRateLimits(ctx context.Context) (int64, error) {
+	query := "DELETE FROM rate_limits WHERE key IN (SELECT key FROM rate_limits WHERE tat<$1 LIMIT 100)"
+	r, err := session.Database(ctx).ExecContext(ctx, query, time.Now())
+	if err != nil {
+		return 0, session.TransactionError(ctx, err)
+	}
+	return r.RowsAffected()
+}
@@ -0,0 +1,90 @@
+package models
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	bot "github.com/MixinNetwork/bot-api-go-client/v2"
+	"github.com/MixinNetwork/supergroup.mixin.one/config"
+	"github.com/MixinNetwork/supergroup.mixin.one/durable"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimit(t *testing.T) {
+	assert := assert.New(t)
+	ctx := setupTestContext()
+	defer teardownTestContext(ctx)
+	defer durable.SetLimiterStore(durable.NewMemoryLimiterStore())
+
+	for _, store := range []durable.LimiterStore{durable.NewMemoryLimiterStore(), durable.NewPostgresLimiterStore(session.Database(ctx))} {
+		durable.SetLimiterStore(store)
+		limit := config.RateLimit{Duration: 60, Number: 2}
+		wait, err := takeRateLimit(ctx, "key", limit)
+		assert.Nil(err)
+		assert.Equal(time.Duration(0), wait)
+		wait, err = takeRateLimit(ctx, "key", limit)
+		assert.Nil(err)
+		assert.Equal(time.Duration(0), wait)
+		wait, err = takeRateLimit(ctx, "key", limit)
+		assert.Nil(err)
+		assert.True(wait > 29*time.Second && wait <= 30*time.Second)
+		wait, err = takeRateLimit(ctx, "other", limit)
+		assert.Nil(err)
+		assert.Equal(time.Duration(0), wait)
+		wait, err = takeRateLimit(ctx, "key", config.RateLimit{})
+		assert.Nil(err)
+		assert.Equal(time.Duration(0), wait)
+
+		wide, narrow := rateLimitBucket("wide", limit), rateLimitBucket("narrow", config.RateLimit{Duration: 60, Number: 1})
+		wait, err = durable.Take(ctx, wide, narrow)
+		assert.Nil(err)
+		assert.Equal(time.Duration(0), wait)
+		wait, err = durable.Take(ctx, wide, narrow)
+		assert.Nil(err)
+		assert.True(wait > 0)
+		wait, err = durable.Take(ctx, wide)
+		assert.Nil(err)
+		assert.Equal(time.Duration(0), wait)
+		wait, err = durable.Take(ctx, wide)
+		assert.Nil(err)
+		assert.True(wait > 0)
+	}
+	count, err := LoopClearUpExpiredRateLimits(ctx)
+	assert.Nil(err)
+	assert.Equal(int64(0), count)
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(err)
+	public := base64.RawURLEncoding.EncodeToString(pub)
+	private := base64.RawURLEncoding.EncodeToString(priv)
+	user, err := createUser(ctx, public, private, bot.UuidNewV4().String(), "", bot.UuidNewV4().String(), "1000", "name", "http://localhost")
+	assert.Nil(err)
+	assert.NotNil(user)
+
+	config.AppConfig().System.RateLimits = map[string]config.RateLimitPolicy{
+		RoleUser: {
+			Message: config.RateLimit{Duration: 60, Number: 3},
+			Media:   config.RateLimit{Duration: 60, Number: 1},
+		},
+	}
+	defer func() { config.AppConfig().System.RateLimits = nil }()
+	wait, err := takeMessageRate(ctx, user, MessageCategoryPlainImage)
+	assert.Nil(err)
+	assert.Equal(time.Duration(0), wait)
+	wait, err = takeMessageRate(ctx, user, MessageCategoryEncryptedImage)
+	assert.Nil(err)
+	assert.True(wait > 0)
+	wait, err = takeMessageRate(ctx, user, MessageCategoryPlainText)
+	assert.Nil(err)
+	assert.Equal(time.Duration(0), wait)
+	wait, err = takeMessageRate(ctx, user, MessageCategoryPlainText)
+	assert.Nil(err)
+	assert.Equal(time.Duration(0), wait)
+	wait, err = takeMessageRate(ctx, user, MessageCategoryPlainText)
+	assert.Nil(err)
+	assert.True(wait > 0)
+}
@@ -0,0 +1,418 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+
+	bot "github.com/MixinNetwork/bot-api-go-client/v2"
+	number "github.com/MixinNetwork/go-number"
+	"github.com/MixinNetwork/supergroup.mixin.one/config"
+	"github.com/MixinNetwork/supergroup.mixin.one/durable"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+)
+
+const (
+	DiscrepancyMissedReceipt    = "missed_receipt"
+	DiscrepancyUnknownPayout    = "unknown_payout"
+	DiscrepancyDuplicatePayout  = "duplicate_payout"
+	DiscrepancyMismatchedPayout = "mismatched_payout"
+	DiscrepancyMissingPayout    = "missing_payout"
+
+	ReconciliationOffset = "reconciliation-offset-property"
+
+	// reconciliationDelay leaves the recent snapshots to the Blaze stream.
+	reconciliationDelay = 10 * time.Minute
+	// payoutMargin is how long a payout snapshot may lag its paid_at.
+	payoutMargin = time.Minute
+)
+
+// Wallet pages the snapshots of the bot after the offset in ascending order.
+type Wallet interface {
+	ReadSnapshots(ctx context.Context, offset time.Time, limit int) ([]*bot.SafeSnapshot, error)
+}
+
+type mixinWallet struct{}
+
+func (mixinWallet) ReadSnapshots(ctx context.Context, offset time.Time, limit int) ([]*bot.SafeSnapshot, error) {
+	mixin := config.AppConfig().Mixin
+	return bot.SafeSnapshots(ctx, limit, "", "", "", offset.Format(time.RFC3339Nano), mixin.ClientId, mixin.SessionId, mixin.SessionKey)
+}
+
+var wallet Wallet = mixinWallet{}
+
+func SetWallet(w Wallet) {
+	wallet = w
+}
+
+// Discrepancy is reported to the operators once for every kind and reference,
+// the reference is the snapshot id or the trace id of the missing payout.
+type Discrepancy struct {
+	Kind        string
+	ReferenceId string
+	UserId      string
+	AssetId     string
+	Amount      string
+	Detail      string
+	CreatedAt   time.Time
+}
+
+var discrepanciesCols = []string{"kind", "reference_id", "user_id", "asset_id", "amount", "detail", "created_at"}
+
+func (d *Discrepancy) values() []interface{} {
+	return []interface{}{d.Kind, d.ReferenceId, d.UserId, d.AssetId, d.Amount, d.Detail, d.CreatedAt}
+}
+
+func discrepancyFromRow(row durable.Row) (*Discrepancy, error) {
+	var d Discrepancy
+	err := row.Scan(&d.Kind, &d.ReferenceId, &d.UserId, &d.AssetId, &d.Amount, &d.Detail, &d.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return &d, err
+}
+
+// ReadWalletSnapshots reads the snapshots after the reconciliation offset that
+// are older than reconciliationDelay, the offset starts from the first call.
+// It returns the time the snapshots are complete until, which is passed to
+// AdvanceReconciliation after they are reconciled.
+func ReadWalletSnapshots(ctx context.Context, limit int) ([]*bot.SafeSnapshot, time.Time, error) {
+	offset, err := readReconciliationOffset(ctx)
+	if err != nil {
+		return nil, offset, err
+	}
+	snapshots, err := wallet.ReadSnapshots(ctx, offset, limit)
+	if err != nil {
+		return nil, offset, session.ServerError(ctx, err)
+	}
+	until := time.Now().Add(-reconciliationDelay)
+	for i, s := range snapshots {
+		if s.CreatedAt.After(until) {
+			return snapshots[:i], until, nil
+		}
+	}
+	if len(snapshots) == limit {
+		return snapshots, snapshots[len(snapshots)-1].CreatedAt, nil
+	}
+	return snapshots, until, nil
+}
+
+// ReconcilePayout records the outbound snapshot as a payout, and reports it if
+// its request id is paid twice, or matches no participant, refund or packet
+// refund of the opponent, or the amount differs.
+func ReconcilePayout(ctx context.Context, s *bot.SafeSnapshot) error {
+	payout := &Snapshot{
+		SnapshotId:      s.SnapshotID,
+		UserId:          s.OpponentID,
+		AssetId:         s.AssetID,
+		Amount:          s.Amount,
+		Memo:            FirstNStringInRune(s.Memo, 1024),
+		TransactionHash: s.TransactionHash,
+		RequestId:       s.RequestId,
+		Purpose:         SnapshotPurposePayout,
+		CreatedAt:       s.CreatedAt,
+		UpdatedAt:       time.Now(),
+	}
+	err := session.Database(ctx).RunInTransaction(ctx, nil, func(ctx context.Context, tx *sql.Tx) error {
+		query := durable.PrepareQuery("INSERT INTO snapshots (%s) VALUES (%s) ON CONFLICT (snapshot_id) DO NOTHING", snapshotsCols)
+		r, err := tx.ExecContext(ctx, query, payout.values()...)
+		if err != nil {
+			return err
+		}
+		if affected, err := r.RowsAffected(); err != nil || affected == 0 {
+			return err
+		}
+		d := &Discrepancy{
+			ReferenceId: s.SnapshotID,
+			UserId:      s.OpponentID,
+			AssetId:     s.AssetID,
+			Amount:      s.Amount,
+			CreatedAt:   time.Now(),
+		}
+		var count int64
+		err = tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM snapshots WHERE request_id=$1 AND purpose=$2", s.RequestId, SnapshotPurposePayout).Scan(&count)
+		if err != nil {
+			return err
+		}
+		if count > 1 {
+			d.Kind, d.Detail = DiscrepancyDuplicatePayout, fmt.Sprintf("request %s paid %d times", s.RequestId, count)
+			return reportDiscrepancyInTx(ctx, tx, d)
+		}
+		expected, err := expectedPayoutInTx(ctx, tx, s.OpponentID, s.RequestId, s.CreatedAt)
+		if err != nil {
+			return err
+		}
+		if expected == "" {
+			d.Kind, d.Detail = DiscrepancyUnknownPayout, fmt.Sprintf("request %s", s.RequestId)
+			return reportDiscrepancyInTx(ctx, tx, d)
+		}
+		if !number.FromString(expected).Equal(number.FromString(s.Amount).Neg()) {
+			d.Kind, d.Detail = DiscrepancyMismatchedPayout, fmt.Sprintf("request %s expected %s", s.RequestId, expected)
+			return reportDiscrepancyInTx(ctx, tx, d)
+		}
+		return nil
+	})
+	if err != nil {
+		return session.TransactionError(ctx, err)
+	}
+	return nil
+}
+
+// expectedPayoutInTx finds the amount the request id should pay the user, the
+// trace ids of rewards, participants and packet refunds are derived, so only
+// the recent ones of the user are compared.
+func expectedPayoutInTx(ctx context.Context, tx *sql.Tx, userId, requestId string, createdAt time.Time) (string, error) {
+	var amount string
+	err := tx.QueryRowContext(ctx, "SELECT amount FROM refunds WHERE trace_id=$1 AND user_id=$2", requestId, userId).Scan(&amount)
+	if err != sql.ErrNoRows {
+		return amount, err
+	}
+	err = tx.QueryRowContext(ctx, "SELECT amount FROM referrals WHERE trace_id=$1 AND referrer_id=$2", requestId, userId).Scan(&amount)
+	if err != sql.ErrNoRows {
+		return amount, err
+	}
+
+	query := "SELECT reward_id,amount FROM rewards WHERE recipient_id=$1 AND created_at>$2 AND created_at<$3"
+	rows, err := tx.QueryContext(ctx, query, userId, createdAt.Add(-7*24*time.Hour), createdAt)
+	if err != nil {
+		return "", err
+	}
+	amount, err = matchPayoutRows(rows, requestId, generateRewardId)
+	if err != nil || amount != "" {
+		return amount, err
+	}
+
+	query = "SELECT packet_id,amount FROM participants WHERE user_id=$1 AND paid_at>$2 AND paid_at<$3"
+	rows, err = tx.QueryContext(ctx, query, userId, createdAt.Add(-24*time.Hour), createdAt.Add(24*time.Hour))
+	if err != nil {
+		return "", err
+	}
+	amount, err = matchPayoutRows(rows, requestId, func(packetId string) (string, error) {
+		return generateParticipantId(packetId, userId)
+	})
+	if err != nil || amount != "" {
+		return amount, err
+	}
+
+	query = "SELECT packet_id,remaining_amount FROM packets WHERE user_id=$1 AND state=$2 AND created_at>$3 AND created_at<$4"
+	rows, err = tx.QueryContext(ctx, query, userId, PacketStateRefunded, createdAt.Add(-7*24*time.Hour), createdAt)
+	if err != nil {
+		return "", err
+	}
+	return matchPayoutRows(rows, requestId, generateRefundTraceId)
+}
+
+func matchPayoutRows(rows *sql.Rows, requestId string, traceId func(string) (string, error)) (string, error) {
+	defer rows.Close()
+	for rows.Next() {
+		var id, amount string
+		err := rows.Scan(&id, &amount)
+		if err != nil {
+			return "", err
+		}
+		trace, err := traceId(id)
+		if err != nil {
+			return "", err
+		}
+		if trace == requestId {
+			return amount, nil
+		}
+	}
+	return "", rows.Err()
+}
+
+// AdvanceReconciliation reports the participants, rewards, refunds and referrals paid
+// since the offset without a payout snapshot, then moves the offset to until.
+func AdvanceReconciliation(ctx context.Context, until time.Time) (int64, error) {
+	offset, err := readReconciliationOffset(ctx)
+	if err != nil || !until.After(offset) {
+		return 0, err
+	}
+	var count int64
+	err = session.Database(ctx).RunInTransaction(ctx, nil, func(ctx context.Context, tx *sql.Tx) error {
+		from, to := offset.Add(-payoutMargin), until.Add(-payoutMargin)
+		var missing []*Discrepancy
+		rows, err := tx.QueryContext(ctx, "SELECT packet_id,user_id,amount FROM participants WHERE paid_at>$1 AND paid_at<=$2", from, to)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var packetId, userId, amount string
+			err = rows.Scan(&packetId, &userId, &amount)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			if number.FromString(amount).Exhausted() {
+				continue
+			}
+			traceId, err := generateParticipantId(packetId, userId)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			missing = append(missing, &Discrepancy{ReferenceId: traceId, UserId: userId, Amount: amount, Detail: fmt.Sprintf("packet %s", packetId)})
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		query := fmt.Sprintf("SELECT %s FROM rewards WHERE paid_at>$1 AND paid_at<=$2", strings.Join(rewardColumns, ","))
+		rows, err = tx.QueryContext(ctx, query, from, to)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			r, err := rewardFromRow(rows)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			traceId, err := generateRewardId(r.RewardId)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			missing = append(missing, &Discrepancy{ReferenceId: traceId, UserId: r.RecipientId, AssetId: r.AssetId, Amount: r.Amount, Detail: fmt.Sprintf("reward %s", r.RewardId)})
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		query = fmt.Sprintf("SELECT %s FROM refunds WHERE state=$1 AND created_at>$2 AND created_at<=$3", strings.Join(refundsCols, ","))
+		rows, err = tx.QueryContext(ctx, query, RefundStateSent, from, to)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			r, err := refundFromRow(rows)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			missing = append(missing, &Discrepancy{ReferenceId: r.TraceId, UserId: r.UserId, AssetId: r.AssetId, Amount: r.Amount, Detail: fmt.Sprintf("refund %s", r.SnapshotId)})
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		query = fmt.Sprintf("SELECT %s FROM referrals WHERE state=$1 AND created_at>$2 AND created_at<=$3", strings.Join(referralsCols, ","))
+		rows, err = tx.QueryContext(ctx, query, ReferralStateSent, from, to)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			r, err := referralFromRow(rows)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			missing = append(missing, &Discrepancy{ReferenceId: r.TraceId, UserId: r.ReferrerId, AssetId: r.AssetId, Amount: r.Amount, Detail: fmt.Sprintf("referral %s", r.UserId)})
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, d := range missing {
+			var exists bool
+			err = tx.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM snapshots WHERE request_id=$1 AND purpose=$2)", d.ReferenceId, SnapshotPurposePayout).Scan(&exists)
+			if err != nil {
+				return err
+			}
+			if exists {
+				continue
+			}
+			d.Kind, d.CreatedAt = DiscrepancyMissingPayout, time.Now()
+			err = reportDiscrepancyInTx(ctx, tx, d)
+			if err != nil {
+				return err
+			}
+			count++
+		}
+		return writeReconciliationOffsetInTx(ctx, tx, until)
+	})
+	if err != nil {
+		return 0, session.TransactionError(ctx, err)
+	}
+	return count, nil
+}
+
+// ReportDiscrepancy records the discrepancy and tells the users with the
+// settings permission, a discrepancy already reported is ignored.
+func ReportDiscrepancy(ctx context.Context, kind, referenceId, userId, assetId, amount, detail string) error {
+	d := &Discrepancy{
+		Kind:        kind,
+		ReferenceId: referenceId,
+		UserId:      userId,
+		AssetId:     assetId,
+		Amount:      amount,
+		Detail:      detail,
+		CreatedAt:   time.Now(),
+	}
+	err := session.Database(ctx).RunInTransaction(ctx, nil, func(ctx context.Context, tx *sql.Tx) error {
+		return reportDiscrepancyInTx(ctx, tx, d)
+	})
+	if err != nil {
+		return session.TransactionError(ctx, err)
+	}
+	return nil
+}
+
+func reportDiscrepancyInTx(ctx context.Context, tx *sql.Tx, d *Discrepancy) error {
+	d.Detail = FirstNStringInRune(d.Detail, 1024)
+	query := durable.PrepareQuery("INSERT INTO discrepancies (%s) VALUES (%s) ON CONFLICT (kind,reference_id) DO NOTHING", discrepanciesCols)
+	r, err := tx.ExecContext(ctx, query, d.values()...)
+	if err != nil {
+		return err
+	}
+	if affected, err := r.RowsAffected(); err != nil || affected == 0 {
+		return err
+	}
+	tips := fmt.Sprintf(config.AppConfig().MessageTemplate.MessageTipsDiscrepancy, d.Kind, d.UserId, d.Amount, d.AssetId, d.Detail)
+	data := base64.RawURLEncoding.EncodeToString([]byte(tips))
+	for _, id := range usersWithPermission(ctx, PermissionSettings) {
+		err = createSystemDistributedMessageInTx(ctx, tx, &User{UserId: id}, MessageCategoryPlainText, data)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readReconciliationOffset starts the reconciliation from now on the first
+// run, the snapshots before it are never backfilled.
+func readReconciliationOffset(ctx context.Context) (time.Time, error) {
+	p, err := ReadProperty(ctx, ReconciliationOffset)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if p != nil {
+		return time.Parse(time.RFC3339Nano, p.Value)
+	}
+	offset := time.Now().Add(-reconciliationDelay)
+	err = session.Database(ctx).RunInTransaction(ctx, nil, func(ctx context.Context, tx *sql.Tx) error {
+		return writeReconciliationOffsetInTx(ctx, tx, offset)
+	})
+	if err != nil {
+		return time.Time{}, session.TransactionError(ctx, err)
+	}
+	return offset, nil
+}
+
+func writeReconciliationOffsetInTx(ctx context.Context, tx *sql.Tx, offset time.Time) error {
+	property := &Property{
+		Name:      ReconciliationOffset,
+		Value:     offset.UTC().Format(time.RFC3339Nano),
+		CreatedAt: time.Now(),
+	}
+	query := durable.PrepareQuery("INSERT INTO properties (%s) VALUES (%s) ON CONFLICT (name) DO UPDATE SET value=EXCLUDED.value", propertiesColumns)
+	_, err := tx.ExecContext(ctx, query, property.values()...)
+	return err
+}
@@ -0,0 +1,112 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	bot "github.com/MixinNetwork/bot-api-go-client/v2"
+	"github.com/MixinNetwork/supergroup.mixin.one/durable"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+	"github.com/stretchr/testify/assert"
+)
+
+type testWallet []*bot.SafeSnapshot
+
+func (w testWallet) ReadSnapshots(ctx context.Context, offset time.Time, limit int) ([]*bot.SafeSnapshot, error) {
+	var snapshots []*bot.SafeSnapshot
+	for _, s := range w {
+		if s.CreatedAt.After(offset) && len(snapshots) < limit {
+			snapshots = append(snapshots, s)
+		}
+	}
+	return snapshots, nil
+}
+
+func TestReconciliationCRUD(t *testing.T) {
+	assert := assert.New(t)
+	ctx := setupTestContext()
+	defer teardownTestContext(ctx)
+
+	userId, assetId := bot.UuidNewV4().String(), bot.UuidNewV4().String()
+	refund, err := CreateRefund(ctx, bot.UuidNewV4().String(), userId, assetId, "0.1", RefundMemoMismatched)
+	assert.Nil(err)
+	assert.Nil(refund.markSent(ctx))
+	missing, err := CreateRefund(ctx, bot.UuidNewV4().String(), userId, assetId, "0.2", RefundMemoMismatched)
+	assert.Nil(err)
+	assert.Nil(missing.markSent(ctx))
+	_, err = session.Database(ctx).Exec("UPDATE refunds SET created_at=$1", time.Now().Add(-time.Hour))
+	assert.Nil(err)
+
+	reward := &Reward{RewardId: bot.UuidNewV4().String(), UserId: bot.UuidNewV4().String(), RecipientId: userId, AssetId: assetId, Amount: "0.5", PaidAt: time.Now().Add(-time.Hour), CreatedAt: time.Now().Add(-2 * time.Hour)}
+	_, err = session.Database(ctx).Exec(durable.PrepareQuery("INSERT INTO rewards (%s) VALUES (%s)", rewardColumns), reward.values()...)
+	assert.Nil(err)
+	rewardTraceId, err := generateRewardId(reward.RewardId)
+	assert.Nil(err)
+	tip := &bot.SafeSnapshot{SnapshotID: bot.UuidNewV4().String(), OpponentID: userId, AssetID: assetId, Amount: "-0.5", RequestId: rewardTraceId, CreatedAt: time.Now().Add(-55 * time.Minute)}
+
+	paid := &bot.SafeSnapshot{SnapshotID: bot.UuidNewV4().String(), OpponentID: userId, AssetID: assetId, Amount: "-0.1", RequestId: refund.TraceId, CreatedAt: time.Now().Add(-time.Hour)}
+	unknown := &bot.SafeSnapshot{SnapshotID: bot.UuidNewV4().String(), OpponentID: userId, AssetID: assetId, Amount: "-0.3", RequestId: bot.UuidNewV4().String(), CreatedAt: time.Now().Add(-50 * time.Minute)}
+	duplicate := &bot.SafeSnapshot{SnapshotID: bot.UuidNewV4().String(), OpponentID: userId, AssetID: assetId, Amount: "-0.1", RequestId: refund.TraceId, CreatedAt: time.Now().Add(-40 * time.Minute)}
+	recent := &bot.SafeSnapshot{SnapshotID: bot.UuidNewV4().String(), OpponentID: userId, AssetID: assetId, Amount: "1", CreatedAt: time.Now()}
+	SetWallet(testWallet{paid, unknown, duplicate, recent})
+	defer SetWallet(mixinWallet{})
+
+	snapshots, until, err := ReadWalletSnapshots(ctx, 10)
+	assert.Nil(err)
+	assert.Len(snapshots, 0)
+	assert.True(until.Before(time.Now().Add(-reconciliationDelay)))
+	_, err = session.Database(ctx).Exec("UPDATE properties SET value=$1 WHERE name=$2", time.Now().Add(-2*time.Hour).UTC().Format(time.RFC3339Nano), ReconciliationOffset)
+	assert.Nil(err)
+	snapshots, until, err = ReadWalletSnapshots(ctx, 10)
+	assert.Nil(err)
+	assert.Len(snapshots, 3)
+	snapshots, _, err = ReadWalletSnapshots(ctx, 2)
+	assert.Nil(err)
+	assert.Len(snapshots, 2)
+
+	for _, s := range []*bot.SafeSnapshot{paid, paid, tip, unknown, duplicate} {
+		assert.Nil(ReconcilePayout(ctx, s))
+	}
+	s, err := FindSnapshot(ctx, paid.SnapshotID)
+	assert.Nil(err)
+	assert.Equal(SnapshotPurposePayout, s.Purpose)
+	assert.Equal(refund.TraceId, s.RequestId)
+	discrepancies := readTestDiscrepancies(ctx, t)
+	assert.Len(discrepancies, 2)
+	assert.Equal(DiscrepancyUnknownPayout, discrepancies[unknown.SnapshotID].Kind)
+	assert.Equal(DiscrepancyDuplicatePayout, discrepancies[duplicate.SnapshotID].Kind)
+
+	count, err := AdvanceReconciliation(ctx, until)
+	assert.Nil(err)
+	assert.Equal(int64(1), count)
+	discrepancies = readTestDiscrepancies(ctx, t)
+	assert.Equal(DiscrepancyMissingPayout, discrepancies[missing.TraceId].Kind)
+	count, err = AdvanceReconciliation(ctx, until)
+	assert.Nil(err)
+	assert.Equal(int64(0), count)
+	snapshots, _, err = ReadWalletSnapshots(ctx, 10)
+	assert.Nil(err)
+	assert.Len(snapshots, 0)
+
+	assert.Nil(ReportDiscrepancy(ctx, DiscrepancyMissedReceipt, recent.SnapshotID, userId, assetId, "1", "backfilled as refunded"))
+	assert.Nil(ReportDiscrepancy(ctx, DiscrepancyMissedReceipt, recent.SnapshotID, userId, assetId, "1", "backfilled as refunded"))
+	assert.Len(readTestDiscrepancies(ctx, t), 4)
+}
+
+func readTestDiscrepancies(ctx context.Context, t *testing.T) map[string]*Discrepancy {
+	query := fmt.Sprintf("SELECT %s FROM discrepancies", strings.Join(discrepanciesCols, ","))
+	rows, err := session.Database(ctx).Query(query)
+	assert.Nil(t, err)
+	defer rows.Close()
+
+	discrepancies := make(map[string]*Discrepancy)
+	for rows.Next() {
+		d, err := discrepancyFromRow(rows)
+		assert.Nil(t, err)
+		discrepancies[d.ReferenceId] = d
+	}
+	return discrepancies
+}
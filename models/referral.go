@@ -0,0 +1,264 @@
+package models
+
+import (
+	"context"
+	"crypto/md5"
+	"database/sql"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	bot "github.com/MixinNetwork/bot-api-go-client/v2"
+	number "github.com/MixinNetwork/go-number"
+	"github.com/MixinNetwork/supergroup.mixin.one/config"
+	"github.com/MixinNetwork/supergroup.mixin.one/durable"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+	"github.com/gofrs/uuid"
+	"github.com/lib/pq"
+)
+
+const (
+	ReferralStatePending = "pending"
+	ReferralStateSent    = "sent"
+
+	ReferralMemo = "Referral reward"
+)
+
+// Referral is the reward of the referrer when the invited user pays to join,
+// a user refers at most once, so the trace id is derived from the user id.
+type Referral struct {
+	UserId         string
+	ReferrerId     string
+	InvitationCode string
+	TraceId        string
+	AssetId        string
+	Amount         string
+	Fee            string
+	State          string
+	CreatedAt      time.Time
+}
+
+var referralsCols = []string{"user_id", "referrer_id", "invitation_code", "trace_id", "asset_id", "amount", "fee", "state", "created_at"}
+
+func (r *Referral) values() []interface{} {
+	return []interface{}{r.UserId, r.ReferrerId, r.InvitationCode, r.TraceId, r.AssetId, r.Amount, r.Fee, r.State, r.CreatedAt}
+}
+
+func referralFromRow(row durable.Row) (*Referral, error) {
+	var r Referral
+	err := row.Scan(&r.UserId, &r.ReferrerId, &r.InvitationCode, &r.TraceId, &r.AssetId, &r.Amount, &r.Fee, &r.State, &r.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return &r, err
+}
+
+// ReferralEarning sums the rewards of a referrer in one asset.
+type ReferralEarning struct {
+	AssetId   string
+	Symbol    string
+	Referrals int64
+	Amount    string
+}
+
+// Referrer is a row of the leaderboard, ranked by the paid referrals.
+type Referrer struct {
+	User      *User
+	Referrals int64
+	Earnings  []*ReferralEarning
+}
+
+// createReferralInTx rewards the referrer with referral_share of the join fee,
+// it's called when the invited user just paid to join, a free join has no fee.
+func (user *User) createReferralInTx(ctx context.Context, tx *sql.Tx, assetId, fee string) error {
+	share := number.FromString(config.AppConfig().System.ReferralShare)
+	if user.InvitationCode == "" || assetId == "" || share.Cmp(number.Zero()) <= 0 || share.Cmp(number.FromString("1")) > 0 {
+		return nil
+	}
+	amount := number.FromString(fee).Mul(share).RoundFloor(8)
+	if amount.Cmp(number.Zero()) <= 0 {
+		return nil
+	}
+	var referrerId string
+	err := tx.QueryRowContext(ctx, "SELECT user_id FROM invitations WHERE code=$1", user.InvitationCode).Scan(&referrerId)
+	if err == sql.ErrNoRows || referrerId == user.UserId {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	traceId, err := generateReferralTraceId(user.UserId)
+	if err != nil {
+		return err
+	}
+	r := &Referral{
+		UserId:         user.UserId,
+		ReferrerId:     referrerId,
+		InvitationCode: user.InvitationCode,
+		TraceId:        traceId,
+		AssetId:        assetId,
+		Amount:         amount.Persist(),
+		Fee:            number.FromString(fee).Persist(),
+		State:          ReferralStatePending,
+		CreatedAt:      time.Now(),
+	}
+	query := durable.PrepareQuery("INSERT INTO referrals (%s) VALUES (%s) ON CONFLICT (user_id) DO NOTHING", referralsCols)
+	_, err = tx.ExecContext(ctx, query, r.values()...)
+	return err
+}
+
+func PendingReferrals(ctx context.Context, limit int) ([]*Referral, error) {
+	query := fmt.Sprintf("SELECT %s FROM referrals WHERE state=$1 ORDER BY state,created_at LIMIT $2", strings.Join(referralsCols, ","))
+	rows, err := session.Database(ctx).QueryContext(ctx, query, ReferralStatePending, limit)
+	if err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	defer rows.Close()
+
+	var referrals []*Referral
+	for rows.Next() {
+		r, err := referralFromRow(rows)
+		if err != nil {
+			return nil, session.TransactionError(ctx, err)
+		}
+		referrals = append(referrals, r)
+	}
+	return referrals, nil
+}
+
+// SendReferralTransfer pays the referrer through the Safe API with the trace
+// id of the referral, a retry after a failed update doesn't pay twice, a
+// referral already spent is only marked sent.
+func SendReferralTransfer(ctx context.Context, r *Referral) error {
+	trace, _ := bot.GetTransactionById(ctx, r.TraceId)
+	if trace != nil && trace.State == "spent" {
+		return r.markSent(ctx)
+	}
+	ma := bot.NewUUIDMixAddress([]string{r.ReferrerId}, 1)
+	tr := &bot.TransactionRecipient{MixAddress: ma.String(), Amount: r.Amount}
+	mixin := config.AppConfig().Mixin
+	su := &bot.SafeUser{
+		UserId:            mixin.ClientId,
+		SessionId:         mixin.SessionId,
+		SessionPrivateKey: mixin.SessionKey,
+		SpendPrivateKey:   mixin.SessionAssetPIN[:64],
+	}
+	_, err := bot.SendTransaction(ctx, r.AssetId, []*bot.TransactionRecipient{tr}, r.TraceId, []byte(ReferralMemo), nil, su)
+	if err != nil {
+		return session.ServerError(ctx, err)
+	}
+	return r.markSent(ctx)
+}
+
+func (r *Referral) markSent(ctx context.Context) error {
+	r.State = ReferralStateSent
+	_, err := session.Database(ctx).ExecContext(ctx, "UPDATE referrals SET state=$1 WHERE user_id=$2", r.State, r.UserId)
+	if err != nil {
+		return session.TransactionError(ctx, err)
+	}
+	return nil
+}
+
+// ReferralEarnings sums the rewards of the user by asset, pending ones included.
+func (user *User) ReferralEarnings(ctx context.Context) ([]*ReferralEarning, error) {
+	referrers, err := readReferrers(ctx, "WHERE r.referrer_id=$1", user.UserId)
+	if err != nil || len(referrers) == 0 {
+		return nil, err
+	}
+	return referrers[0].Earnings, nil
+}
+
+// ReferralLeaderboard ranks the referrers by how many invited users paid.
+func ReferralLeaderboard(ctx context.Context, limit int) ([]*Referrer, error) {
+	query := "SELECT referrer_id FROM referrals GROUP BY referrer_id ORDER BY COUNT(*) DESC,referrer_id LIMIT $1"
+	rows, err := session.Database(ctx).QueryContext(ctx, query, limit)
+	if err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		err := rows.Scan(&id)
+		if err != nil {
+			return nil, session.TransactionError(ctx, err)
+		}
+		ids = append(ids, id)
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	ranked, err := readReferrers(ctx, "WHERE r.referrer_id=ANY($1)", pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	set := make(map[string]*Referrer, len(ranked))
+	for _, r := range ranked {
+		set[r.User.UserId] = r
+	}
+	query = fmt.Sprintf("SELECT %s FROM users WHERE user_id=ANY($1)", strings.Join(usersCols, ","))
+	users, err := session.Database(ctx).QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	defer users.Close()
+	for users.Next() {
+		u, err := userFromRow(users)
+		if err != nil {
+			return nil, session.TransactionError(ctx, err)
+		}
+		if r := set[u.UserId]; r != nil {
+			r.User = u
+		}
+	}
+
+	referrers := make([]*Referrer, 0, len(ids))
+	for _, id := range ids {
+		if r := set[id]; r != nil {
+			referrers = append(referrers, r)
+		}
+	}
+	return referrers, nil
+}
+
+func readReferrers(ctx context.Context, where string, args ...interface{}) ([]*Referrer, error) {
+	query := fmt.Sprintf("SELECT r.referrer_id,r.asset_id,COALESCE(MAX(a.symbol),''),COUNT(*),SUM(r.amount::NUMERIC)::VARCHAR FROM referrals r LEFT JOIN assets a ON a.asset_id=r.asset_id %s GROUP BY r.referrer_id,r.asset_id ORDER BY r.referrer_id,r.asset_id", where)
+	rows, err := session.Database(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	defer rows.Close()
+
+	var referrers []*Referrer
+	for rows.Next() {
+		var userId string
+		var e ReferralEarning
+		err := rows.Scan(&userId, &e.AssetId, &e.Symbol, &e.Referrals, &e.Amount)
+		if err != nil {
+			return nil, session.TransactionError(ctx, err)
+		}
+		e.Amount = number.FromString(e.Amount).Persist()
+		if len(referrers) == 0 || referrers[len(referrers)-1].User.UserId != userId {
+			referrers = append(referrers, &Referrer{User: &User{UserId: userId}})
+		}
+		r := referrers[len(referrers)-1]
+		r.Referrals += e.Referrals
+		r.Earnings = append(r.Earnings, &e)
+	}
+	return referrers, nil
+}
+
+// generateReferralTraceId derives the trace id of the referral from the invited
+// user id, so the referrer is never paid twice for the same user.
+func generateReferralTraceId(userId string) (string, error) {
+	h := md5.New()
+	io.WriteString(h, userId)
+	io.WriteString(h, "REFERRAL")
+	sum := h.Sum(nil)
+	sum[6] = (sum[6] & 0x0f) | 0x30
+	sum[8] = (sum[8] & 0x3f) | 0x80
+	id, err := uuid.FromBytes(sum)
+	return id.String(), err
+}
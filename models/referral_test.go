@@ -0,0 +1,108 @@
+package models
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	bot "github.com/MixinNetwork/bot-api-go-client/v2"
+	"github.com/MixinNetwork/supergroup.mixin.one/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReferralCRUD(t *testing.T) {
+	assert := assert.New(t)
+	ctx := setupTestContext()
+	defer teardownTestContext(ctx)
+
+	assetId := bot.UuidNewV4().String()
+	system := config.AppConfig().System
+	defer func() { config.AppConfig().System = system }()
+	config.AppConfig().System.MembershipPlanList = []config.MembershipPlan{
+		{Name: "monthly", Duration: 2592000, Prices: []config.PaymentAsset{{Symbol: "XIN", AssetId: assetId, Amount: "0.01"}}},
+	}
+	config.AppConfig().System.ReferralShare = "0.1"
+	monthly := FindMembershipPlan("monthly")
+
+	var users []*User
+	for i := 0; i < 4; i++ {
+		pub, priv, err := ed25519.GenerateKey(rand.Reader)
+		assert.Nil(err)
+		public := base64.RawURLEncoding.EncodeToString(pub)
+		private := base64.RawURLEncoding.EncodeToString(priv)
+		user, err := createUser(ctx, public, private, bot.UuidNewV4().String(), "", bot.UuidNewV4().String(), "1000", "name", "http://localhost")
+		assert.Nil(err)
+		users = append(users, user)
+	}
+	referrer, invitee, friend, other := users[0], users[1], users[2], users[3]
+
+	paid, err := referrer.PayMembership(ctx, "", monthly, assetId, "0.01")
+	assert.Nil(err)
+	assert.True(paid)
+	referrals, err := PendingReferrals(ctx, 10)
+	assert.Nil(err)
+	assert.Len(referrals, 0)
+
+	invitation, err := referrer.CreateInvitation(ctx, "", "0", 0, time.Time{})
+	assert.Nil(err)
+	assert.Nil(invitee.acceptInvitation(ctx, invitation.Code))
+	assert.Nil(friend.acceptInvitation(ctx, invitation.Code))
+	paid, err = invitee.PayMembership(ctx, "", monthly, assetId, "0.05")
+	assert.Nil(err)
+	assert.True(paid)
+	paid, err = invitee.PayMembership(ctx, "", monthly, assetId, "0.01")
+	assert.Nil(err)
+	assert.True(paid)
+	paid, err = other.PayMembership(ctx, "", monthly, assetId, "0.01")
+	assert.Nil(err)
+	assert.True(paid)
+
+	referrals, err = PendingReferrals(ctx, 10)
+	assert.Nil(err)
+	assert.Len(referrals, 1)
+	r := referrals[0]
+	assert.Equal(invitee.UserId, r.UserId)
+	assert.Equal(referrer.UserId, r.ReferrerId)
+	assert.Equal("0.001", r.Amount)
+	assert.Equal("0.01", r.Fee)
+	traceId, err := generateReferralTraceId(invitee.UserId)
+	assert.Nil(err)
+	assert.Equal(traceId, r.TraceId)
+	assert.Nil(r.markSent(ctx))
+	referrals, err = PendingReferrals(ctx, 10)
+	assert.Nil(err)
+	assert.Len(referrals, 0)
+
+	config.AppConfig().System.ReferralShare = "0"
+	paid, err = friend.PayMembership(ctx, "", monthly, assetId, "0.01")
+	assert.Nil(err)
+	assert.True(paid)
+	referrals, err = PendingReferrals(ctx, 10)
+	assert.Nil(err)
+	assert.Len(referrals, 0)
+
+	earnings, err := referrer.ReferralEarnings(ctx)
+	assert.Nil(err)
+	assert.Len(earnings, 1)
+	assert.Equal(assetId, earnings[0].AssetId)
+	assert.Equal(int64(1), earnings[0].Referrals)
+	assert.Equal("0.001", earnings[0].Amount)
+	earnings, err = invitee.ReferralEarnings(ctx)
+	assert.Nil(err)
+	assert.Len(earnings, 0)
+
+	referrers, err := ReferralLeaderboard(ctx, 10)
+	assert.Nil(err)
+	assert.Len(referrers, 1)
+	assert.Equal(referrer.UserId, referrers[0].User.UserId)
+	assert.Equal("name", referrers[0].User.FullName)
+	assert.Equal(int64(1), referrers[0].Referrals)
+
+	SetWallet(testWallet{})
+	defer SetWallet(mixinWallet{})
+	payout := &bot.SafeSnapshot{SnapshotID: bot.UuidNewV4().String(), OpponentID: referrer.UserId, AssetID: assetId, Amount: "-0.001", RequestId: traceId, CreatedAt: time.Now()}
+	assert.Nil(ReconcilePayout(ctx, payout))
+	assert.Len(readTestDiscrepancies(ctx, t), 0)
+}
@@ -0,0 +1,148 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	bot "github.com/MixinNetwork/bot-api-go-client/v2"
+	"github.com/MixinNetwork/supergroup.mixin.one/config"
+	"github.com/MixinNetwork/supergroup.mixin.one/durable"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+)
+
+const (
+	RefundStatePending = "pending"
+	RefundStateSent    = "sent"
+
+	RefundMemoUnrecognised   = "Refund: unrecognised payment"
+	RefundMemoMismatched     = "Refund: the asset or amount doesn't match any price"
+	RefundMemoAlreadyPaid    = "Refund: you are already a member"
+	RefundMemoNotAccepted    = "Refund: the payment can't be accepted for your account"
+	RefundMemoPacketNotReady = "Refund: the packet is not waiting for this payment"
+	RefundMemoRewardInvalid  = "Refund: the reward recipient or asset is not found"
+	RefundMemoIntentInvalid  = "Refund: the payment intent is not found or expired"
+	RefundMemoIntentPaid     = "Refund: the payment intent is already paid"
+	RefundMemoGiftInvalid    = "Refund: the gift recipient is not found"
+	RefundMemoGiftBlocked    = "Refund: the gift recipient is blocked"
+	RefundMemoGiftExpired    = "Refund: the gift recipient didn't authorize in time"
+)
+
+// Refund returns an inbound snapshot that matched nothing to the sender, the
+// trace id is derived from the snapshot id.
+type Refund struct {
+	SnapshotId string
+	TraceId    string
+	UserId     string
+	AssetId    string
+	Amount     string
+	Memo       string
+	State      string
+	CreatedAt  time.Time
+}
+
+var refundsCols = []string{"snapshot_id", "trace_id", "user_id", "asset_id", "amount", "memo", "state", "created_at"}
+
+func (r *Refund) values() []interface{} {
+	return []interface{}{r.SnapshotId, r.TraceId, r.UserId, r.AssetId, r.Amount, r.Memo, r.State, r.CreatedAt}
+}
+
+func refundFromRow(row durable.Row) (*Refund, error) {
+	var r Refund
+	err := row.Scan(&r.SnapshotId, &r.TraceId, &r.UserId, &r.AssetId, &r.Amount, &r.Memo, &r.State, &r.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return &r, err
+}
+
+// CreateRefund queues the refund of the snapshot, a snapshot is refunded once.
+func CreateRefund(ctx context.Context, snapshotId, userId, assetId, amount, memo string) (*Refund, error) {
+	var r *Refund
+	err := session.Database(ctx).RunInTransaction(ctx, nil, func(ctx context.Context, tx *sql.Tx) error {
+		var err error
+		r, err = createRefundInTx(ctx, tx, snapshotId, userId, assetId, amount, memo)
+		return err
+	})
+	if err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	return r, nil
+}
+
+func createRefundInTx(ctx context.Context, tx *sql.Tx, snapshotId, userId, assetId, amount, memo string) (*Refund, error) {
+	traceId, err := generateRefundTraceId(snapshotId)
+	if err != nil {
+		return nil, err
+	}
+	r := &Refund{
+		SnapshotId: snapshotId,
+		TraceId:    traceId,
+		UserId:     userId,
+		AssetId:    assetId,
+		Amount:     amount,
+		Memo:       memo,
+		State:      RefundStatePending,
+		CreatedAt:  time.Now(),
+	}
+	query := durable.PrepareQuery("INSERT INTO refunds (%s) VALUES (%s) ON CONFLICT (snapshot_id) DO NOTHING", refundsCols)
+	_, err = tx.ExecContext(ctx, query, r.values()...)
+	if err != nil {
+		return nil, err
+	}
+	return r, resolveSnapshotInTx(ctx, tx, snapshotId, SnapshotPurposeRefunded)
+}
+
+func PendingRefunds(ctx context.Context, limit int) ([]*Refund, error) {
+	query := fmt.Sprintf("SELECT %s FROM refunds WHERE state=$1 ORDER BY state,created_at LIMIT $2", strings.Join(refundsCols, ","))
+	rows, err := session.Database(ctx).QueryContext(ctx, query, RefundStatePending, limit)
+	if err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	defer rows.Close()
+
+	var refunds []*Refund
+	for rows.Next() {
+		r, err := refundFromRow(rows)
+		if err != nil {
+			return nil, session.TransactionError(ctx, err)
+		}
+		refunds = append(refunds, r)
+	}
+	return refunds, nil
+}
+
+// SendRefundTransfer sends the refund through the Safe API with its trace id,
+// so a retry after a failed update doesn't pay twice, a refund already spent
+// is only marked sent.
+func SendRefundTransfer(ctx context.Context, r *Refund) error {
+	trace, _ := bot.GetTransactionById(ctx, r.TraceId)
+	if trace != nil && trace.State == "spent" {
+		return r.markSent(ctx)
+	}
+	ma := bot.NewUUIDMixAddress([]string{r.UserId}, 1)
+	tr := &bot.TransactionRecipient{MixAddress: ma.String(), Amount: r.Amount}
+	mixin := config.AppConfig().Mixin
+	su := &bot.SafeUser{
+		UserId:            mixin.ClientId,
+		SessionId:         mixin.SessionId,
+		SessionPrivateKey: mixin.SessionKey,
+		SpendPrivateKey:   mixin.SessionAssetPIN[:64],
+	}
+	_, err := bot.SendTransaction(ctx, r.AssetId, []*bot.TransactionRecipient{tr}, r.TraceId, []byte(r.Memo), nil, su)
+	if err != nil {
+		return session.ServerError(ctx, err)
+	}
+	return r.markSent(ctx)
+}
+
+func (r *Refund) markSent(ctx context.Context) error {
+	r.State = RefundStateSent
+	_, err := session.Database(ctx).ExecContext(ctx, "UPDATE refunds SET state=$1 WHERE snapshot_id=$2", r.State, r.SnapshotId)
+	if err != nil {
+		return session.TransactionError(ctx, err)
+	}
+	return nil
+}
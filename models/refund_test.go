@@ -0,0 +1,44 @@
+package models
+
+import (
+	"testing"
+
+	bot "github.com/MixinNetwork/bot-api-go-client/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRefundCRUD(t *testing.T) {
+	assert := assert.New(t)
+	ctx := setupTestContext()
+	defer teardownTestContext(ctx)
+
+	snapshotId, userId, assetId := bot.UuidNewV4().String(), bot.UuidNewV4().String(), bot.UuidNewV4().String()
+	refund, err := CreateRefund(ctx, snapshotId, userId, assetId, "0.1", RefundMemoMismatched)
+	assert.Nil(err)
+	assert.NotNil(refund)
+	assert.NotEqual(snapshotId, refund.TraceId)
+	traceId, err := generateRefundTraceId(snapshotId)
+	assert.Nil(err)
+	assert.Equal(traceId, refund.TraceId)
+	refund, err = CreateRefund(ctx, snapshotId, userId, assetId, "0.1", RefundMemoUnrecognised)
+	assert.Nil(err)
+	assert.Equal(traceId, refund.TraceId)
+
+	refunds, err := PendingRefunds(ctx, 10)
+	assert.Nil(err)
+	assert.Len(refunds, 1)
+	assert.Equal(RefundMemoMismatched, refunds[0].Memo)
+	assert.Equal(RefundStatePending, refunds[0].State)
+
+	err = refunds[0].markSent(ctx)
+	assert.Nil(err)
+	assert.Equal(RefundStateSent, refunds[0].State)
+	refunds, err = PendingRefunds(ctx, 10)
+	assert.Nil(err)
+	assert.Len(refunds, 0)
+	_, err = CreateRefund(ctx, snapshotId, userId, assetId, "0.1", RefundMemoMismatched)
+	assert.Nil(err)
+	refunds, err = PendingRefunds(ctx, 10)
+	assert.Nil(err)
+	assert.Len(refunds, 0)
+}
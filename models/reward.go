@@ -43,44 +43,12 @@ func rewardFromRow(row durable.Row) (*Reward, error) {
 func CreateReward(ctx context.Context, traceId, userId, recipientId, assetId, amount string) (*Reward, error) {
 	var reward *Reward
 	err := session.Database(ctx).RunInTransaction(ctx, nil, func(ctx context.Context, tx *sql.Tx) error {
-		r, err := readRewardById(ctx, tx, traceId)
-		if err != nil {
-			return err
-		}
-		if r != nil {
-			reward = r
-			return nil
-		}
-		user, err := findUserById(ctx, tx, userId)
-		if err != nil || user == nil {
-			return err
-		}
-		recipient, err := findUserById(ctx, tx, recipientId)
-		if err != nil || recipient == nil {
-			return err
-		}
-		asset, err := findAssetById(ctx, tx, assetId)
-		if err != nil || asset == nil {
-			return err
-		}
-		if number.FromString(amount).Cmp(number.Zero()) <= 0 {
-			return nil
-		}
-
-		reward = &Reward{
-			RewardId:    traceId,
-			UserId:      userId,
-			RecipientId: recipientId,
-			AssetId:     assetId,
-			Amount:      amount,
-			PaidAt:      time.Time{},
-			CreatedAt:   time.Now(),
-		}
-		_, err = tx.ExecContext(ctx, durable.PrepareQuery("INSERT INTO rewards (%s) VALUES (%s)", rewardColumns), reward.values()...)
-		if err != nil {
+		var err error
+		reward, err = createRewardInTx(ctx, tx, traceId, userId, recipientId, assetId, amount)
+		if err != nil || reward == nil {
 			return err
 		}
-		return createSystemRewardMessage(ctx, tx, reward, user, recipient, asset)
+		return resolveSnapshotInTx(ctx, tx, traceId, SnapshotPurposeReward)
 	})
 	if err != nil {
 		return nil, session.TransactionError(ctx, err)
@@ -88,6 +56,43 @@ func CreateReward(ctx context.Context, traceId, userId, recipientId, assetId, am
 	return reward, nil
 }
 
+func createRewardInTx(ctx context.Context, tx *sql.Tx, traceId, userId, recipientId, assetId, amount string) (*Reward, error) {
+	r, err := readRewardById(ctx, tx, traceId)
+	if err != nil || r != nil {
+		return r, err
+	}
+	user, err := findUserById(ctx, tx, userId)
+	if err != nil || user == nil {
+		return nil, err
+	}
+	recipient, err := findUserById(ctx, tx, recipientId)
+	if err != nil || recipient == nil {
+		return nil, err
+	}
+	asset, err := findAssetById(ctx, tx, assetId)
+	if err != nil || asset == nil {
+		return nil, err
+	}
+	if number.FromString(amount).Cmp(number.Zero()) <= 0 {
+		return nil, nil
+	}
+
+	reward := &Reward{
+		RewardId:    traceId,
+		UserId:      userId,
+		RecipientId: recipientId,
+		AssetId:     assetId,
+		Amount:      amount,
+		PaidAt:      time.Time{},
+		CreatedAt:   time.Now(),
+	}
+	_, err = tx.ExecContext(ctx, durable.PrepareQuery("INSERT INTO rewards (%s) VALUES (%s)", rewardColumns), reward.values()...)
+	if err != nil {
+		return nil, err
+	}
+	return reward, createSystemRewardMessage(ctx, tx, reward, user, recipient, asset)
+}
+
 func readRewardById(ctx context.Context, tx *sql.Tx, id string) (*Reward, error) {
 	query := fmt.Sprintf("SELECT %s FROM rewards WHERE reward_id=$1", strings.Join(rewardColumns, ","))
 	row := tx.QueryRowContext(ctx, query, id)
@@ -129,7 +134,7 @@ func SendRewardTransfer(ctx context.Context, reward *Reward) error {
 		if err != nil {
 			return err
 		}
-		memo := fmt.Sprintf(config.AppConfig.MessageTemplate.MessageRewardMemo, user.FullName)
+		memo := fmt.Sprintf(config.AppConfig().MessageTemplate.MessageRewardMemo, user.FullName)
 		if len(memo) > 140 {
 			memo = memo[:120]
 		}
@@ -140,7 +145,7 @@ func SendRewardTransfer(ctx context.Context, reward *Reward) error {
 				TraceId:     traceId,
 				Memo:        memo,
 			}
-			mixin := config.AppConfig.Mixin
+			mixin := config.AppConfig().Mixin
 			_, err = bot.CreateTransfer(ctx, in, mixin.ClientId, mixin.SessionId, mixin.SessionKey, mixin.SessionAssetPIN, mixin.PinToken)
 			if err != nil {
 				return session.ServerError(ctx, err)
@@ -0,0 +1,283 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MixinNetwork/supergroup.mixin.one/config"
+	"github.com/MixinNetwork/supergroup.mixin.one/durable"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+	"github.com/gofrs/uuid/v5"
+)
+
+const (
+	RoleOwner       = "owner"
+	RoleAdmin       = "admin"
+	RoleModerator   = "moderator"
+	RoleBroadcaster = "broadcaster"
+	RoleUser        = "user"
+
+	PermissionBan         = "ban"
+	PermissionMute        = "mute"
+	PermissionRecall      = "recall"
+	PermissionProhibit    = "prohibit"
+	PermissionManageRoles = "manage_roles"
+	PermissionBroadcast   = "broadcast"
+	PermissionSettings    = "settings"
+
+	roleCacheDuration = 10 * time.Second
+)
+
+var rolePermissions = map[string][]string{
+	RoleOwner:       {PermissionBan, PermissionMute, PermissionRecall, PermissionProhibit, PermissionManageRoles, PermissionBroadcast, PermissionSettings},
+	RoleAdmin:       {PermissionBan, PermissionMute, PermissionRecall, PermissionProhibit, PermissionManageRoles, PermissionBroadcast, PermissionSettings},
+	RoleModerator:   {PermissionMute, PermissionRecall},
+	RoleBroadcaster: {PermissionBroadcast},
+}
+
+var roleRanks = map[string]int{
+	RoleUser:        0,
+	RoleBroadcaster: 1,
+	RoleModerator:   2,
+	RoleAdmin:       3,
+	RoleOwner:       4,
+}
+
+type Role struct {
+	UserId    string
+	Role      string
+	GrantedBy string
+	CreatedAt time.Time
+}
+
+var rolesCols = []string{"user_id", "role", "granted_by", "created_at"}
+
+func (r *Role) values() []interface{} {
+	return []interface{}{r.UserId, r.Role, r.GrantedBy, r.CreatedAt}
+}
+
+func roleFromRow(row durable.Row) (*Role, error) {
+	var r Role
+	err := row.Scan(&r.UserId, &r.Role, &r.GrantedBy, &r.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return &r, err
+}
+
+// roleCache is shared by the http and the message services, both reload it
+// from the roles table every roleCacheDuration.
+var roleCache = struct {
+	sync.RWMutex
+	roles    map[string]string
+	loadedAt time.Time
+}{roles: make(map[string]string)}
+
+// SeedRoles makes the operators in the config owners when they have no role yet,
+// so a role changed or revoked in the database is kept across restarts.
+func SeedRoles(ctx context.Context) error {
+	err := session.Database(ctx).RunInTransaction(ctx, nil, func(ctx context.Context, tx *sql.Tx) error {
+		for _, id := range config.AppConfig().System.OperatorList {
+			r := &Role{UserId: id, Role: RoleOwner, CreatedAt: time.Now()}
+			query := durable.PrepareQuery("INSERT INTO roles (%s) VALUES (%s) ON CONFLICT (user_id) DO NOTHING", rolesCols)
+			_, err := tx.ExecContext(ctx, query, r.values()...)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return session.TransactionError(ctx, err)
+	}
+	return loadRoles(ctx)
+}
+
+func loadRoles(ctx context.Context) error {
+	roles, err := readRoles(ctx)
+	if err != nil {
+		return err
+	}
+	set := make(map[string]string)
+	for _, r := range roles {
+		set[r.UserId] = r.Role
+	}
+	roleCache.Lock()
+	roleCache.roles = set
+	roleCache.loadedAt = time.Now()
+	roleCache.Unlock()
+	return nil
+}
+
+func readRoles(ctx context.Context) ([]*Role, error) {
+	query := fmt.Sprintf("SELECT %s FROM roles ORDER BY created_at", strings.Join(rolesCols, ","))
+	rows, err := session.Database(ctx).QueryContext(ctx, query)
+	if err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	defer rows.Close()
+
+	var roles []*Role
+	for rows.Next() {
+		r, err := roleFromRow(rows)
+		if err != nil {
+			return nil, session.TransactionError(ctx, err)
+		}
+		roles = append(roles, r)
+	}
+	return roles, nil
+}
+
+func cachedRole(userId string) string {
+	roleCache.RLock()
+	defer roleCache.RUnlock()
+	if role := roleCache.roles[userId]; role != "" {
+		return role
+	}
+	return RoleUser
+}
+
+func refreshRoles(ctx context.Context) {
+	roleCache.RLock()
+	stale := time.Since(roleCache.loadedAt) > roleCacheDuration
+	roleCache.RUnlock()
+	if !stale {
+		return
+	}
+	if err := loadRoles(ctx); err != nil {
+		session.Logger(ctx).Errorf("loadRoles ERROR: %+v", err)
+	}
+}
+
+func roleOf(ctx context.Context, userId string) string {
+	refreshRoles(ctx)
+	return cachedRole(userId)
+}
+
+func roleCan(role, permission string) bool {
+	for _, p := range rolePermissions[role] {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// usersWithPermission lists the staff, used to pick who receives held messages.
+func usersWithPermission(ctx context.Context, permission string) []string {
+	refreshRoles(ctx)
+	set := make(map[string]bool)
+	roleCache.RLock()
+	for id, role := range roleCache.roles {
+		if roleCan(role, permission) {
+			set[id] = true
+		}
+	}
+	roleCache.RUnlock()
+	ids := make([]string, 0, len(set))
+	for id := range set {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// GetRole returns the cached role, it may lag the database by roleCacheDuration.
+func (user *User) GetRole() string {
+	return cachedRole(user.UserId)
+}
+
+func (user *User) Can(ctx context.Context, permission string) bool {
+	return roleCan(roleOf(ctx, user.UserId), permission)
+}
+
+func (user *User) Permissions(ctx context.Context) []string {
+	return rolePermissions[roleOf(ctx, user.UserId)]
+}
+
+// isProtected reports whether the user is staff, staff can't be moderated.
+func isProtected(ctx context.Context, userId string) bool {
+	return roleRanks[roleOf(ctx, userId)] >= roleRanks[RoleModerator]
+}
+
+// GrantRole sets the role of the user, only roles below the current user's own can be granted.
+func (current *User) GrantRole(ctx context.Context, userId, role string) (*Role, error) {
+	if id := uuid.FromStringOrNil(userId); id.String() != userId {
+		return nil, session.BadDataError(ctx)
+	}
+	if _, found := rolePermissions[role]; !found || role == RoleOwner {
+		return nil, session.BadDataError(ctx)
+	}
+	currentRole := roleOf(ctx, current.UserId)
+	if !roleCan(currentRole, PermissionManageRoles) || roleRanks[role] >= roleRanks[currentRole] {
+		return nil, session.ForbiddenError(ctx)
+	}
+	if roleRanks[roleOf(ctx, userId)] >= roleRanks[currentRole] {
+		return nil, session.ForbiddenError(ctx)
+	}
+
+	r := &Role{UserId: userId, Role: role, GrantedBy: current.UserId, CreatedAt: time.Now()}
+	err := session.Database(ctx).RunInTransaction(ctx, nil, func(ctx context.Context, tx *sql.Tx) error {
+		old, err := roleFromRow(tx.QueryRowContext(ctx, "SELECT user_id,role,granted_by,created_at FROM roles WHERE user_id=$1 FOR UPDATE", userId))
+		if err != nil {
+			return err
+		}
+		query := durable.PrepareQuery("INSERT INTO roles (%s) VALUES (%s) ON CONFLICT (user_id) DO UPDATE SET (role, granted_by, created_at)=(EXCLUDED.role, EXCLUDED.granted_by, EXCLUDED.created_at)", rolesCols)
+		_, err = tx.ExecContext(ctx, query, r.values()...)
+		if err != nil {
+			return err
+		}
+		var before interface{}
+		if old != nil {
+			before = old.Role
+		}
+		return createAuditEventInTx(ctx, tx, current.UserId, AuditActionGrantRole, userId, "", before, role)
+	})
+	if err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	roleCache.Lock()
+	roleCache.roles[userId] = role
+	roleCache.Unlock()
+	return r, nil
+}
+
+func (current *User) RevokeRole(ctx context.Context, userId string) (*Role, error) {
+	currentRole := roleOf(ctx, current.UserId)
+	if !roleCan(currentRole, PermissionManageRoles) || roleRanks[roleOf(ctx, userId)] >= roleRanks[currentRole] {
+		return nil, session.ForbiddenError(ctx)
+	}
+
+	var r *Role
+	err := session.Database(ctx).RunInTransaction(ctx, nil, func(ctx context.Context, tx *sql.Tx) error {
+		var err error
+		r, err = roleFromRow(tx.QueryRowContext(ctx, "SELECT user_id,role,granted_by,created_at FROM roles WHERE user_id=$1 FOR UPDATE", userId))
+		if err != nil || r == nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, "DELETE FROM roles WHERE user_id=$1", userId)
+		if err != nil {
+			return err
+		}
+		return createAuditEventInTx(ctx, tx, current.UserId, AuditActionRevokeRole, userId, "", r.Role, nil)
+	})
+	if err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	roleCache.Lock()
+	delete(roleCache.roles, userId)
+	roleCache.Unlock()
+	return r, nil
+}
+
+func (current *User) Roles(ctx context.Context) ([]*Role, error) {
+	if !current.Can(ctx, PermissionManageRoles) {
+		return nil, session.ForbiddenError(ctx)
+	}
+	return readRoles(ctx)
+}
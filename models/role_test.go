@@ -0,0 +1,84 @@
+package models
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	bot "github.com/MixinNetwork/bot-api-go-client/v2"
+	"github.com/MixinNetwork/supergroup.mixin.one/config"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoleCRUD(t *testing.T) {
+	assert := assert.New(t)
+	ctx := setupTestContext()
+	defer teardownTestContext(ctx)
+
+	err := SeedRoles(ctx)
+	assert.Nil(err)
+	owner := &User{UserId: config.AppConfig().System.OperatorList[0]}
+	assert.Equal(RoleOwner, owner.GetRole())
+	assert.True(owner.Can(ctx, PermissionManageRoles))
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(err)
+	public := base64.RawURLEncoding.EncodeToString(pub)
+	private := base64.RawURLEncoding.EncodeToString(priv)
+	user, err := createUser(ctx, public, private, bot.UuidNewV4().String(), "", bot.UuidNewV4().String(), "1000", "name", "http://localhost")
+	assert.Nil(err)
+	assert.NotNil(user)
+	assert.Equal(RoleUser, user.GetRole())
+	assert.False(user.Can(ctx, PermissionMute))
+	assert.Len(user.Permissions(ctx), 0)
+	assert.False(isProtected(ctx, user.UserId))
+
+	role, err := user.GrantRole(ctx, user.UserId, RoleAdmin)
+	assert.NotNil(err)
+	assert.Nil(role)
+	role, err = owner.GrantRole(ctx, user.UserId, RoleOwner)
+	assert.NotNil(err)
+	role, err = owner.GrantRole(ctx, user.UserId, "root")
+	assert.NotNil(err)
+	role, err = owner.GrantRole(ctx, user.UserId, RoleModerator)
+	assert.Nil(err)
+	assert.NotNil(role)
+	assert.Equal(RoleModerator, user.GetRole())
+	assert.True(user.Can(ctx, PermissionMute))
+	assert.False(user.Can(ctx, PermissionBan))
+	assert.True(isProtected(ctx, user.UserId))
+	assert.Contains(usersWithPermission(ctx, PermissionRecall), user.UserId)
+
+	role, err = user.GrantRole(ctx, bot.UuidNewV4().String(), RoleBroadcaster)
+	assert.NotNil(err)
+	_, err = user.RevokeRole(ctx, owner.UserId)
+	assert.NotNil(err)
+	roles, err := user.Roles(ctx)
+	assert.NotNil(err)
+	roles, err = owner.Roles(ctx)
+	assert.Nil(err)
+	assert.Len(roles, len(config.AppConfig().System.OperatorList)+1)
+
+	role, err = owner.RevokeRole(ctx, user.UserId)
+	assert.Nil(err)
+	assert.NotNil(role)
+	assert.Equal(RoleModerator, role.Role)
+	assert.Equal(RoleUser, user.GetRole())
+	role, err = owner.RevokeRole(ctx, user.UserId)
+	assert.Nil(err)
+	assert.Nil(role)
+
+	events, err := owner.AuditEvents(ctx, owner.UserId, "", time.Time{}, time.Time{}, 100)
+	assert.Nil(err)
+	assert.Len(events, 2)
+	assert.Equal(AuditActionRevokeRole, events[0].Action)
+	assert.Equal(AuditActionGrantRole, events[1].Action)
+
+	_, err = session.Database(ctx).Exec("UPDATE roles SET role=$1 WHERE user_id=$2", RoleAdmin, owner.UserId)
+	assert.Nil(err)
+	assert.Nil(SeedRoles(ctx))
+	assert.Equal(RoleAdmin, owner.GetRole())
+}
@@ -0,0 +1,352 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/MixinNetwork/supergroup.mixin.one/config"
+	"github.com/MixinNetwork/supergroup.mixin.one/durable"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+)
+
+const (
+	SettingKindBool     = "bool"
+	SettingKindInt      = "int"
+	SettingKindDuration = "duration"
+	SettingKindString   = "string"
+
+	settingPropertyPrefix = "setting."
+)
+
+// settingDefinition points a setting to the config field it overrides,
+// int fields may be int or int64, duration fields are seconds in int64.
+type settingDefinition struct {
+	Kind  string
+	field func(c *config.Config) interface{}
+}
+
+var settingDefinitions = map[string]settingDefinition{
+	"audio_message_enable":      {SettingKindBool, func(c *config.Config) interface{} { return &c.System.AudioMessageEnable }},
+	"image_message_enable":      {SettingKindBool, func(c *config.Config) interface{} { return &c.System.ImageMessageEnable }},
+	"video_message_enable":      {SettingKindBool, func(c *config.Config) interface{} { return &c.System.VideoMessageEnable }},
+	"live_message_enable":       {SettingKindBool, func(c *config.Config) interface{} { return &c.System.LiveMessageEnable }},
+	"contact_message_enable":    {SettingKindBool, func(c *config.Config) interface{} { return &c.System.ContactMessageEnable }},
+	"detect_image":              {SettingKindBool, func(c *config.Config) interface{} { return &c.System.DetectQRCodeEnabled }},
+	"detect_link":               {SettingKindBool, func(c *config.Config) interface{} { return &c.System.DetectLinkEnabled }},
+	"detect_image_hash":         {SettingKindBool, func(c *config.Config) interface{} { return &c.System.DetectImageHashEnabled }},
+	"image_hash_distance":       {SettingKindInt, func(c *config.Config) interface{} { return &c.System.ImageHashDistance }},
+	"attachment_max_size":       {SettingKindInt, func(c *config.Config) interface{} { return &c.System.AttachmentMaxSize }},
+	"limit_message_duration":    {SettingKindDuration, func(c *config.Config) interface{} { return &c.System.LimitMessageDuration }},
+	"limit_message_number":      {SettingKindInt, func(c *config.Config) interface{} { return &c.System.LimitMessageNumber }},
+	"spam_flood_window":         {SettingKindDuration, func(c *config.Config) interface{} { return &c.System.SpamFloodWindow }},
+	"spam_flood_threshold":      {SettingKindInt, func(c *config.Config) interface{} { return &c.System.SpamFloodThreshold }},
+	"spam_ban_threshold":        {SettingKindInt, func(c *config.Config) interface{} { return &c.System.SpamBanThreshold }},
+	"probation_duration":        {SettingKindDuration, func(c *config.Config) interface{} { return &c.System.ProbationDuration }},
+	"probation_limit_duration":  {SettingKindDuration, func(c *config.Config) interface{} { return &c.System.ProbationLimitDuration }},
+	"probation_limit_number":    {SettingKindInt, func(c *config.Config) interface{} { return &c.System.ProbationLimitNumber }},
+	"warning_decay":             {SettingKindDuration, func(c *config.Config) interface{} { return &c.System.WarningDecay }},
+	"membership_reminder":       {SettingKindDuration, func(c *config.Config) interface{} { return &c.System.MembershipReminder }},
+	"trial_duration":            {SettingKindDuration, func(c *config.Config) interface{} { return &c.System.TrialDuration }},
+	"quote_duration":            {SettingKindDuration, func(c *config.Config) interface{} { return &c.System.QuoteDuration }},
+	"gift_expiration":           {SettingKindDuration, func(c *config.Config) interface{} { return &c.System.GiftExpiration }},
+	"home_welcome_message":      {SettingKindString, func(c *config.Config) interface{} { return &c.Appearance.HomeWelcomeMessage }},
+	"welcome_message":           {SettingKindString, func(c *config.Config) interface{} { return &c.MessageTemplate.WelcomeMessage }},
+	"message_tips_guest":        {SettingKindString, func(c *config.Config) interface{} { return &c.MessageTemplate.MessageTipsGuest }},
+	"message_tips_help":         {SettingKindString, func(c *config.Config) interface{} { return &c.MessageTemplate.MessageTipsHelp }},
+	"message_tips_join":         {SettingKindString, func(c *config.Config) interface{} { return &c.MessageTemplate.MessageTipsJoin }},
+	"message_prohibit":          {SettingKindString, func(c *config.Config) interface{} { return &c.MessageTemplate.MessageProhibit }},
+	"message_allow":             {SettingKindString, func(c *config.Config) interface{} { return &c.MessageTemplate.MessageAllow }},
+	"message_slow_mode_on":      {SettingKindString, func(c *config.Config) interface{} { return &c.MessageTemplate.MessageSlowModeOn }},
+	"message_slow_mode_off":     {SettingKindString, func(c *config.Config) interface{} { return &c.MessageTemplate.MessageSlowModeOff }},
+	"message_tips_too_many":     {SettingKindString, func(c *config.Config) interface{} { return &c.MessageTemplate.MessageTipsTooMany }},
+	"message_tips_probation":    {SettingKindString, func(c *config.Config) interface{} { return &c.MessageTemplate.MessageTipsProbation }},
+	"message_tips_muted":        {SettingKindString, func(c *config.Config) interface{} { return &c.MessageTemplate.MessageTipsMuted }},
+	"message_tips_warned":       {SettingKindString, func(c *config.Config) interface{} { return &c.MessageTemplate.MessageTipsWarned }},
+	"message_tips_slow_mode":    {SettingKindString, func(c *config.Config) interface{} { return &c.MessageTemplate.MessageTipsSlowMode }},
+	"message_tips_expiring":     {SettingKindString, func(c *config.Config) interface{} { return &c.MessageTemplate.MessageTipsExpiring }},
+	"message_tips_expired":      {SettingKindString, func(c *config.Config) interface{} { return &c.MessageTemplate.MessageTipsExpired }},
+	"message_tips_trial":        {SettingKindString, func(c *config.Config) interface{} { return &c.MessageTemplate.MessageTipsTrial }},
+	"message_tips_trial_ending": {SettingKindString, func(c *config.Config) interface{} { return &c.MessageTemplate.MessageTipsTrialEnding }},
+	"message_tips_trial_ended":  {SettingKindString, func(c *config.Config) interface{} { return &c.MessageTemplate.MessageTipsTrialEnded }},
+}
+
+var settingVerbRegexp = regexp.MustCompile(`%[a-z]`)
+
+type Setting struct {
+	Name       string
+	Kind       string
+	Value      interface{}
+	Default    interface{}
+	Overridden bool
+	UpdatedAt  time.Time
+}
+
+// settingsCache keeps the config as loaded from the file, every load applies
+// the overrides to a copy of it and swaps it with config.SetAppConfig, so the
+// readers of the config never see a half applied change.
+var settingsCache = struct {
+	sync.Mutex
+	base    *config.Config
+	applied *config.Config
+	values  map[string]*Property
+}{values: make(map[string]*Property)}
+
+// LoadSettings reads the overrides from the properties table and applies them.
+func LoadSettings(ctx context.Context) error {
+	query := fmt.Sprintf("SELECT %s FROM properties WHERE name LIKE $1", strings.Join(propertiesColumns, ","))
+	rows, err := session.Database(ctx).QueryContext(ctx, query, settingPropertyPrefix+"%")
+	if err != nil {
+		return session.TransactionError(ctx, err)
+	}
+	defer rows.Close()
+
+	values := make(map[string]*Property)
+	for rows.Next() {
+		p, err := propertyFromRow(rows)
+		if err != nil {
+			return session.TransactionError(ctx, err)
+		}
+		values[strings.TrimPrefix(p.Name, settingPropertyPrefix)] = p
+	}
+	if err := rows.Err(); err != nil {
+		return session.TransactionError(ctx, err)
+	}
+
+	settingsCache.Lock()
+	defer settingsCache.Unlock()
+	applySettings(ctx, values)
+	return nil
+}
+
+func applySettings(ctx context.Context, values map[string]*Property) {
+	if settingsCache.base == nil || config.AppConfig() != settingsCache.applied {
+		base := *config.AppConfig()
+		settingsCache.base = &base
+	}
+	next := *settingsCache.base
+	next.Service.Retry = config.AppConfig().Service.Retry
+	for name, p := range values {
+		def, found := settingDefinitions[name]
+		if !found {
+			continue
+		}
+		v, err := parseSetting(def.Kind, json.RawMessage(p.Value))
+		if err != nil {
+			session.Logger(ctx).Errorf("parseSetting(%s) ERROR: %+v", name, err)
+			continue
+		}
+		setSettingField(def.field(&next), v)
+	}
+	settingsCache.values = values
+	settingsCache.applied = &next
+	config.SetAppConfig(&next)
+}
+
+func (current *User) Settings(ctx context.Context) ([]*Setting, error) {
+	if !current.Can(ctx, PermissionSettings) {
+		return nil, session.ForbiddenError(ctx)
+	}
+	settingsCache.Lock()
+	defer settingsCache.Unlock()
+	if settingsCache.base == nil || config.AppConfig() != settingsCache.applied {
+		applySettings(ctx, settingsCache.values)
+	}
+	return readSettings(), nil
+}
+
+// UpdateSettings validates all the values before writing any of them, a null
+// value removes the override and restores the config file value.
+func (current *User) UpdateSettings(ctx context.Context, changes map[string]json.RawMessage) ([]*Setting, error) {
+	if !current.Can(ctx, PermissionSettings) {
+		return nil, session.ForbiddenError(ctx)
+	}
+	settingsCache.Lock()
+	defer settingsCache.Unlock()
+	if settingsCache.base == nil || config.AppConfig() != settingsCache.applied {
+		applySettings(ctx, settingsCache.values)
+	}
+
+	parsed := make(map[string]interface{})
+	for name, raw := range changes {
+		def, found := settingDefinitions[name]
+		if !found {
+			return nil, session.BadDataError(ctx)
+		}
+		if string(raw) == "null" {
+			parsed[name] = nil
+			continue
+		}
+		v, err := parseSetting(def.Kind, raw)
+		if err != nil || validateSetting(v, def.field(settingsCache.base)) != nil {
+			return nil, session.BadDataError(ctx)
+		}
+		parsed[name] = v
+	}
+
+	values := make(map[string]*Property)
+	for name, p := range settingsCache.values {
+		values[name] = p
+	}
+	err := session.Database(ctx).RunInTransaction(ctx, nil, func(ctx context.Context, tx *sql.Tx) error {
+		for name, v := range parsed {
+			def := settingDefinitions[name]
+			before := settingValue(def, config.AppConfig())
+			if v == nil {
+				_, err := tx.ExecContext(ctx, "DELETE FROM properties WHERE name=$1", settingPropertyPrefix+name)
+				if err != nil {
+					return err
+				}
+				delete(values, name)
+				v = settingValue(def, settingsCache.base)
+			} else {
+				v = settingJSON(v)
+				data, err := json.Marshal(v)
+				if err != nil {
+					return err
+				}
+				p := &Property{Name: settingPropertyPrefix + name, Value: string(data), CreatedAt: time.Now()}
+				query := durable.PrepareQuery("INSERT INTO properties (%s) VALUES (%s) ON CONFLICT (name) DO UPDATE SET (value, created_at)=(EXCLUDED.value, EXCLUDED.created_at)", propertiesColumns)
+				_, err = tx.ExecContext(ctx, query, p.values()...)
+				if err != nil {
+					return err
+				}
+				values[name] = p
+			}
+			err := createAuditEventInTx(ctx, tx, current.UserId, AuditActionSetSetting, name, "", before, v)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	applySettings(ctx, values)
+	return readSettings(), nil
+}
+
+func readSettings() []*Setting {
+	names := make([]string, 0, len(settingDefinitions))
+	for name := range settingDefinitions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	settings := make([]*Setting, len(names))
+	for i, name := range names {
+		def := settingDefinitions[name]
+		s := &Setting{
+			Name:    name,
+			Kind:    def.Kind,
+			Value:   settingValue(def, settingsCache.applied),
+			Default: settingValue(def, settingsCache.base),
+		}
+		if p := settingsCache.values[name]; p != nil {
+			s.Overridden, s.UpdatedAt = true, p.CreatedAt
+		}
+		settings[i] = s
+	}
+	return settings
+}
+
+// parseSetting decodes the JSON value, durations are strings like 30s or 7d,
+// and are kept as time.Duration until they are set to the config.
+func parseSetting(kind string, raw json.RawMessage) (interface{}, error) {
+	switch kind {
+	case SettingKindBool:
+		var v bool
+		err := json.Unmarshal(raw, &v)
+		return v, err
+	case SettingKindInt:
+		var v int64
+		err := json.Unmarshal(raw, &v)
+		return v, err
+	case SettingKindDuration:
+		var s string
+		err := json.Unmarshal(raw, &s)
+		if err != nil {
+			return nil, err
+		}
+		return ParseDuration(s)
+	case SettingKindString:
+		var v string
+		err := json.Unmarshal(raw, &v)
+		return v, err
+	}
+	return nil, fmt.Errorf("invalid setting kind %s", kind)
+}
+
+func validateSetting(v interface{}, base interface{}) error {
+	switch val := v.(type) {
+	case int64:
+		if val < 0 {
+			return fmt.Errorf("negative value %d", val)
+		}
+	case time.Duration:
+		if val < 0 || val%time.Second != 0 {
+			return fmt.Errorf("invalid duration %s", val)
+		}
+	case string:
+		if utf8.RuneCountInString(val) > 1024 {
+			return fmt.Errorf("string too long")
+		}
+		old := settingVerbRegexp.FindAllString(*base.(*string), -1)
+		verbs := settingVerbRegexp.FindAllString(val, -1)
+		if strings.Join(old, "") != strings.Join(verbs, "") {
+			return fmt.Errorf("template verbs %v mismatch %v", verbs, old)
+		}
+	}
+	return nil
+}
+
+func setSettingField(field interface{}, v interface{}) {
+	switch f := field.(type) {
+	case *bool:
+		*f = v.(bool)
+	case *int:
+		*f = int(v.(int64))
+	case *int64:
+		switch val := v.(type) {
+		case time.Duration:
+			*f = int64(val / time.Second)
+		case int64:
+			*f = val
+		}
+	case *string:
+		*f = v.(string)
+	}
+}
+
+// settingValue reads the field in the form it's stored in the properties.
+func settingValue(def settingDefinition, c *config.Config) interface{} {
+	switch f := def.field(c).(type) {
+	case *bool:
+		return *f
+	case *int:
+		return int64(*f)
+	case *int64:
+		if def.Kind == SettingKindDuration {
+			return settingJSON(time.Duration(*f) * time.Second)
+		}
+		return *f
+	case *string:
+		return *f
+	}
+	return nil
+}
+
+func settingJSON(v interface{}) interface{} {
+	if d, ok := v.(time.Duration); ok {
+		return d.String()
+	}
+	return v
+}
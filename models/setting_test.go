@@ -0,0 +1,83 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	bot "github.com/MixinNetwork/bot-api-go-client/v2"
+	"github.com/MixinNetwork/supergroup.mixin.one/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSettingCRUD(t *testing.T) {
+	assert := assert.New(t)
+	ctx := setupTestContext()
+	defer teardownTestContext(ctx)
+
+	err := LoadSettings(ctx)
+	assert.Nil(err)
+	imageEnabled := config.AppConfig().System.ImageMessageEnable
+	tips := config.AppConfig().MessageTemplate.MessageTipsMuted
+
+	user := &User{UserId: bot.UuidNewV4().String()}
+	settings, err := user.Settings(ctx)
+	assert.NotNil(err)
+	assert.Nil(settings)
+	admin := &User{UserId: config.AppConfig().System.OperatorList[0]}
+	settings, err = admin.Settings(ctx)
+	assert.Nil(err)
+	assert.Len(settings, len(settingDefinitions))
+	for _, s := range settings {
+		assert.False(s.Overridden)
+	}
+
+	for _, invalid := range []map[string]json.RawMessage{
+		{"unknown": json.RawMessage(`true`)},
+		{"image_message_enable": json.RawMessage(`"yes"`)},
+		{"limit_message_number": json.RawMessage(`-1`)},
+		{"limit_message_duration": json.RawMessage(`"forever"`)},
+		{"message_tips_muted": json.RawMessage(`"muted"`)},
+		{"api_root": json.RawMessage(`[]`)},
+	} {
+		_, err = admin.UpdateSettings(ctx, invalid)
+		assert.NotNil(err)
+	}
+
+	settings, err = admin.UpdateSettings(ctx, map[string]json.RawMessage{
+		"image_message_enable":   json.RawMessage(`false`),
+		"limit_message_number":   json.RawMessage(`3`),
+		"limit_message_duration": json.RawMessage(`"1m"`),
+		"message_tips_muted":     json.RawMessage(`"muted until %s"`),
+	})
+	assert.Nil(err)
+	assert.Len(settings, len(settingDefinitions))
+	assert.False(config.AppConfig().System.ImageMessageEnable)
+	assert.Equal(3, config.AppConfig().System.LimitMessageNumber)
+	assert.Equal(int64(60), config.AppConfig().System.LimitMessageDuration)
+	assert.Equal("muted until %s", config.AppConfig().MessageTemplate.MessageTipsMuted)
+	for _, s := range settings {
+		if s.Name == "limit_message_duration" {
+			assert.True(s.Overridden)
+			assert.Equal("1m0s", s.Value)
+		}
+	}
+
+	config.AppConfig().System.ImageMessageEnable = true
+	err = LoadSettings(ctx)
+	assert.Nil(err)
+	assert.False(config.AppConfig().System.ImageMessageEnable)
+
+	_, err = admin.UpdateSettings(ctx, map[string]json.RawMessage{
+		"image_message_enable": json.RawMessage(`null`),
+		"message_tips_muted":   json.RawMessage(`null`),
+	})
+	assert.Nil(err)
+	assert.Equal(imageEnabled, config.AppConfig().System.ImageMessageEnable)
+	assert.Equal(tips, config.AppConfig().MessageTemplate.MessageTipsMuted)
+	assert.Equal(3, config.AppConfig().System.LimitMessageNumber)
+
+	events, err := admin.AuditEvents(ctx, admin.UserId, AuditActionSetSetting, time.Time{}, time.Time{}, 100)
+	assert.Nil(err)
+	assert.Len(events, 6)
+}
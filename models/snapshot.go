@@ -0,0 +1,137 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/MixinNetwork/supergroup.mixin.one/durable"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+)
+
+const (
+	SnapshotPurposeMembership = "membership"
+	SnapshotPurposePacket     = "packet"
+	SnapshotPurposeReward     = "reward"
+	SnapshotPurposeRefunded   = "refunded"
+	SnapshotPurposePayout     = "payout"
+	SnapshotPurposeUnknown    = "unknown"
+)
+
+// Snapshot is an inbound transfer to the bot, recorded before it's handled,
+// a snapshot with a resolved purpose is never handled again. The purpose is
+// resolved in the transaction of the payment or refund it makes. The outbound
+// transfers found by the reconciliation are recorded as payouts with their
+// request id and a negative amount.
+type Snapshot struct {
+	SnapshotId      string
+	UserId          string
+	AssetId         string
+	Amount          string
+	Memo            string
+	TransactionHash string
+	RequestId       string
+	Purpose         string
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+}
+
+var snapshotsCols = []string{"snapshot_id", "user_id", "asset_id", "amount", "memo", "transaction_hash", "request_id", "purpose", "created_at", "updated_at"}
+
+func (s *Snapshot) values() []interface{} {
+	return []interface{}{s.SnapshotId, s.UserId, s.AssetId, s.Amount, s.Memo, s.TransactionHash, s.RequestId, s.Purpose, s.CreatedAt, s.UpdatedAt}
+}
+
+func snapshotFromRow(row durable.Row) (*Snapshot, error) {
+	var s Snapshot
+	err := row.Scan(&s.SnapshotId, &s.UserId, &s.AssetId, &s.Amount, &s.Memo, &s.TransactionHash, &s.RequestId, &s.Purpose, &s.CreatedAt, &s.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return &s, err
+}
+
+// RecordSnapshot inserts the snapshot with an unknown purpose, or returns the
+// recorded one if the snapshot_id exists.
+func RecordSnapshot(ctx context.Context, snapshotId, userId, assetId, amount, memo, hash string, createdAt time.Time) (*Snapshot, error) {
+	s := &Snapshot{
+		SnapshotId:      snapshotId,
+		UserId:          userId,
+		AssetId:         assetId,
+		Amount:          amount,
+		Memo:            FirstNStringInRune(memo, 1024),
+		TransactionHash: hash,
+		Purpose:         SnapshotPurposeUnknown,
+		CreatedAt:       createdAt,
+		UpdatedAt:       time.Now(),
+	}
+	err := session.Database(ctx).RunInTransaction(ctx, nil, func(ctx context.Context, tx *sql.Tx) error {
+		query := durable.PrepareQuery("INSERT INTO snapshots (%s) VALUES (%s) ON CONFLICT (snapshot_id) DO NOTHING", snapshotsCols)
+		_, err := tx.ExecContext(ctx, query, s.values()...)
+		if err != nil {
+			return err
+		}
+		query = fmt.Sprintf("SELECT %s FROM snapshots WHERE snapshot_id=$1", strings.Join(snapshotsCols, ","))
+		s, err = snapshotFromRow(tx.QueryRowContext(ctx, query, snapshotId))
+		return err
+	})
+	if err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	return s, nil
+}
+
+func FindSnapshot(ctx context.Context, snapshotId string) (*Snapshot, error) {
+	query := fmt.Sprintf("SELECT %s FROM snapshots WHERE snapshot_id=$1", strings.Join(snapshotsCols, ","))
+	s, err := snapshotFromRow(session.Database(ctx).QueryRowContext(ctx, query, snapshotId))
+	if err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	return s, nil
+}
+
+// resolveSnapshotInTx sets the purpose of an unknown snapshot, a snapshot
+// already resolved or not recorded is left as it is.
+func resolveSnapshotInTx(ctx context.Context, tx *sql.Tx, snapshotId, purpose string) error {
+	query := "UPDATE snapshots SET (purpose,updated_at)=($1,$2) WHERE snapshot_id=$3 AND purpose=$4"
+	_, err := tx.ExecContext(ctx, query, purpose, time.Now(), snapshotId, SnapshotPurposeUnknown)
+	return err
+}
+
+// Snapshots lists the snapshots before the offset, newest first, empty filters match all.
+func (current *User) Snapshots(ctx context.Context, userId, purpose string, since, offset time.Time, limit int64) ([]*Snapshot, error) {
+	if !current.Can(ctx, PermissionSettings) {
+		return nil, session.ForbiddenError(ctx)
+	}
+	if offset.IsZero() {
+		offset = time.Now()
+	}
+	query := fmt.Sprintf("SELECT %s FROM snapshots WHERE created_at<$1 AND created_at>$2", strings.Join(snapshotsCols, ","))
+	args := []interface{}{offset, since}
+	if userId != "" {
+		args = append(args, userId)
+		query += fmt.Sprintf(" AND user_id=$%d", len(args))
+	}
+	if purpose != "" {
+		args = append(args, purpose)
+		query += fmt.Sprintf(" AND purpose=$%d", len(args))
+	}
+	query += fmt.Sprintf(" ORDER BY created_at DESC LIMIT %d", limit)
+	rows, err := session.Database(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	defer rows.Close()
+
+	var snapshots []*Snapshot
+	for rows.Next() {
+		s, err := snapshotFromRow(rows)
+		if err != nil {
+			return nil, session.TransactionError(ctx, err)
+		}
+		snapshots = append(snapshots, s)
+	}
+	return snapshots, nil
+}
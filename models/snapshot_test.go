@@ -0,0 +1,54 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	bot "github.com/MixinNetwork/bot-api-go-client/v2"
+	"github.com/MixinNetwork/supergroup.mixin.one/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnapshotCRUD(t *testing.T) {
+	assert := assert.New(t)
+	ctx := setupTestContext()
+	defer teardownTestContext(ctx)
+
+	err := SeedRoles(ctx)
+	assert.Nil(err)
+	owner := &User{UserId: config.AppConfig().System.OperatorList[0]}
+
+	snapshotId, userId, assetId := bot.UuidNewV4().String(), bot.UuidNewV4().String(), bot.UuidNewV4().String()
+	createdAt := time.Now().Add(-time.Minute)
+	snapshot, err := RecordSnapshot(ctx, snapshotId, userId, assetId, "0.1", "memo", "hash", createdAt)
+	assert.Nil(err)
+	assert.NotNil(snapshot)
+	assert.Equal(SnapshotPurposeUnknown, snapshot.Purpose)
+	assert.Equal("memo", snapshot.Memo)
+	_, err = CreateRefund(ctx, snapshotId, userId, assetId, "0.1", RefundMemoUnrecognised)
+	assert.Nil(err)
+	paid, err := (&User{UserId: userId}).PayMembership(ctx, snapshotId, FindMembershipPlan("lifetime"), assetId, "0.1")
+	assert.Nil(err)
+	assert.False(paid)
+
+	snapshot, err = RecordSnapshot(ctx, snapshotId, userId, assetId, "0.2", "other", "hash", time.Now())
+	assert.Nil(err)
+	assert.Equal(SnapshotPurposeRefunded, snapshot.Purpose)
+	assert.Equal("0.1", snapshot.Amount)
+	assert.Equal("memo", snapshot.Memo)
+
+	_, err = RecordSnapshot(ctx, bot.UuidNewV4().String(), bot.UuidNewV4().String(), assetId, "1", "", "hash", time.Now())
+	assert.Nil(err)
+	snapshots, err := (&User{UserId: userId}).Snapshots(ctx, "", "", time.Time{}, time.Time{}, 10)
+	assert.NotNil(err)
+	snapshots, err = owner.Snapshots(ctx, "", "", time.Time{}, time.Time{}, 10)
+	assert.Nil(err)
+	assert.Len(snapshots, 2)
+	snapshots, err = owner.Snapshots(ctx, userId, "", time.Time{}, time.Time{}, 10)
+	assert.Nil(err)
+	assert.Len(snapshots, 1)
+	snapshots, err = owner.Snapshots(ctx, "", SnapshotPurposeUnknown, time.Time{}, time.Time{}, 10)
+	assert.Nil(err)
+	assert.Len(snapshots, 1)
+	assert.Equal("1", snapshots[0].Amount)
+}
@@ -12,12 +12,18 @@ func ReadStatistic(ctx context.Context, user *User) (map[string]interface{}, err
 	}
 	s["users_count"] = count
 	s["prohibited"] = false
-	if user != nil && user.isAdmin() {
+	s["slow_mode"] = int64(0)
+	if user != nil && user.Can(ctx, PermissionProhibit) {
 		b, err := ReadProhibitedProperty(ctx)
 		if err != nil {
 			return nil, err
 		}
 		s["prohibited"] = b
+		seconds, err := ReadSlowModeProperty(ctx)
+		if err != nil {
+			return nil, err
+		}
+		s["slow_mode"] = seconds
 	}
 	return s, nil
 }
@@ -27,9 +27,13 @@ const (
 	PaymentStateBlocked = "blocked"
 	PaymentStatePending = "pending"
 	PaymentStatePaid    = "paid"
+	PaymentStateTrial   = "trial"
 
-	PayMethodMixin = "mixin"
-	PayMethodOffer = "offer"
+	PayMethodMixin      = "mixin"
+	PayMethodOffer      = "offer"
+	PayMethodGrant      = "grant"
+	PayMethodInvitation = "invitation"
+	PayMethodTrial      = "trial"
 
 	UserActivePeriod = 5 * time.Minute
 
@@ -50,27 +54,33 @@ type User struct {
 	ActiveAt        time.Time
 	SubscribedAt    time.Time
 	PayMethod       string
+	ProbationUntil  time.Time
+	PaidUntil       time.Time
+	RemindedAt      time.Time
+	InvitationCode  string
 
 	isNew               bool
 	AuthenticationToken string
 }
 
-var usersCols = []string{"user_id", "identity_number", "full_name", "access_token", "authorization_id", "scope", "avatar_url", "trace_id", "state", "active_at", "subscribed_at", "pay_method"}
+var usersCols = []string{"user_id", "identity_number", "full_name", "access_token", "authorization_id", "scope", "avatar_url", "trace_id", "state", "active_at", "subscribed_at", "pay_method", "probation_until", "paid_until", "reminded_at", "invitation_code"}
 
 func (u *User) values() []interface{} {
-	return []interface{}{u.UserId, u.IdentityNumber, u.FullName, u.AccessToken, u.AuthorizationID, u.Scope, u.AvatarURL, u.TraceId, u.State, u.ActiveAt, u.SubscribedAt, u.PayMethod}
+	return []interface{}{u.UserId, u.IdentityNumber, u.FullName, u.AccessToken, u.AuthorizationID, u.Scope, u.AvatarURL, u.TraceId, u.State, u.ActiveAt, u.SubscribedAt, u.PayMethod, u.ProbationUntil, u.PaidUntil, u.RemindedAt, u.InvitationCode}
 }
 
 func userFromRow(row durable.Row) (*User, error) {
 	var u User
-	err := row.Scan(&u.UserId, &u.IdentityNumber, &u.FullName, &u.AccessToken, &u.AuthorizationID, &u.Scope, &u.AvatarURL, &u.TraceId, &u.State, &u.ActiveAt, &u.SubscribedAt, &u.PayMethod)
+	err := row.Scan(&u.UserId, &u.IdentityNumber, &u.FullName, &u.AccessToken, &u.AuthorizationID, &u.Scope, &u.AvatarURL, &u.TraceId, &u.State, &u.ActiveAt, &u.SubscribedAt, &u.PayMethod, &u.ProbationUntil, &u.PaidUntil, &u.RemindedAt, &u.InvitationCode)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
 	return &u, err
 }
 
-func AuthenticateUserByOAuth(ctx context.Context, authorizationCode string) (*User, error) {
+// AuthenticateUserByOAuth creates or updates the user, a new user is attributed
+// to the invitation code if any.
+func AuthenticateUserByOAuth(ctx context.Context, authorizationCode, invitationCode string) (*User, error) {
 	pub, priv, err := ed25519.GenerateKey(rand.Reader)
 	if err != nil {
 		return nil, err
@@ -81,7 +91,28 @@ func AuthenticateUserByOAuth(ctx context.Context, authorizationCode string) (*Us
 	if err != nil {
 		return nil, err
 	}
-	return createUser(ctx, public, private, authorizationID, scope, me.UserId, me.IdentityNumber, me.FullName, me.AvatarURL)
+	user, err := createUser(ctx, public, private, authorizationID, scope, me.UserId, me.IdentityNumber, me.FullName, me.AvatarURL)
+	if err != nil || !user.isNew {
+		return user, err
+	}
+	if invitationCode != "" {
+		err = user.acceptInvitation(ctx, invitationCode)
+		if err != nil {
+			return user, err
+		}
+	}
+	return user, user.claimGifts(ctx)
+}
+
+// grantTrialInTx records the trial of the user, a user gets one trial only,
+// even if they leave and authorize again.
+func grantTrialInTx(ctx context.Context, tx *sql.Tx, userId string, createdAt time.Time) (bool, error) {
+	r, err := tx.ExecContext(ctx, "INSERT INTO trials (user_id,created_at) VALUES ($1,$2) ON CONFLICT (user_id) DO NOTHING", userId, createdAt)
+	if err != nil {
+		return false, err
+	}
+	n, err := r.RowsAffected()
+	return n > 0, err
 }
 
 func createUser(ctx context.Context, public, private, authorizationID, scope, userId, identityNumber, fullName, avatarURL string) (*User, error) {
@@ -113,9 +144,10 @@ func createUser(ctx context.Context, public, private, authorizationID, scope, us
 			TraceId:        bot.UuidNewV4().String(),
 			State:          PaymentStatePending,
 			ActiveAt:       time.Now(),
+			ProbationUntil: time.Now(),
 			isNew:          true,
 		}
-		if !config.AppConfig.System.PayToJoin {
+		if !config.AppConfig().System.PayToJoin {
 			item, err := ReadBlacklist(ctx, user.UserId)
 			if err != nil {
 				return nil, session.TransactionError(ctx, err)
@@ -125,6 +157,17 @@ func createUser(ctx context.Context, public, private, authorizationID, scope, us
 			user.State = PaymentStatePaid
 			user.SubscribedAt = time.Now()
 			user.PayMethod = PayMethodOffer
+			user.ProbationUntil = probationUntil(user.SubscribedAt)
+		} else if trial := config.AppConfig().System.TrialDuration; trial > 0 {
+			item, err := ReadBlacklist(ctx, user.UserId)
+			if err != nil {
+				return nil, session.TransactionError(ctx, err)
+			} else if item == nil {
+				user.State = PaymentStateTrial
+				user.SubscribedAt = time.Now()
+				user.PayMethod = PayMethodTrial
+				user.PaidUntil = user.SubscribedAt.Add(time.Duration(trial) * time.Second)
+			}
 		}
 		err = externals.CreateConversation(ctx, "CONTACT", userId)
 		if err != nil {
@@ -147,6 +190,14 @@ func createUser(ctx context.Context, public, private, authorizationID, scope, us
 
 	if user.isNew {
 		err = session.Database(ctx).RunInTransaction(ctx, nil, func(ctx context.Context, tx *sql.Tx) error {
+			if user.State == PaymentStateTrial {
+				granted, err := grantTrialInTx(ctx, tx, user.UserId, user.SubscribedAt)
+				if err != nil {
+					return err
+				} else if !granted {
+					user.State, user.SubscribedAt, user.PayMethod, user.PaidUntil = PaymentStatePending, time.Time{}, "", time.Time{}
+				}
+			}
 			if user.State == PaymentStatePaid {
 				if err := createSystemJoinMessage(ctx, tx, user); err != nil {
 					return err
@@ -249,7 +300,7 @@ func (user *User) Unsubscribe(ctx context.Context) error {
 
 func (user *User) Payment(ctx context.Context) error {
 	err := session.Database(ctx).RunInTransaction(ctx, nil, func(ctx context.Context, tx *sql.Tx) error {
-		return user.paymentInTx(ctx, tx, PayMethodMixin)
+		return user.paymentInTx(ctx, tx, PayMethodMixin, time.Time{})
 	})
 	if err != nil {
 		if sessionErr, ok := err.(session.Error); ok {
@@ -260,8 +311,10 @@ func (user *User) Payment(ctx context.Context) error {
 	return nil
 }
 
-func (user *User) paymentInTx(ctx context.Context, tx *sql.Tx, method string) error {
-	if user.State != PaymentStatePending {
+// paymentInTx lets a pending or trial user join until paidUntil, a zero
+// paidUntil never expires. A trial user already received the latest messages.
+func (user *User) paymentInTx(ctx context.Context, tx *sql.Tx, method string, paidUntil time.Time) error {
+	if !user.Joinable() {
 		return nil
 	}
 	if b, err := readBlacklistInTx(ctx, tx, user.UserId); err != nil {
@@ -270,9 +323,13 @@ func (user *User) paymentInTx(ctx context.Context, tx *sql.Tx, method string) er
 		return nil
 	}
 
-	messages, err := readLatestMessagesInTx(ctx, tx, user.UserId, 10)
-	if err != nil {
-		return err
+	var messages []*Message
+	var err error
+	if user.State == PaymentStatePending {
+		messages, err = readLatestMessagesInTx(ctx, tx, user.UserId, 10)
+		if err != nil {
+			return err
+		}
 	}
 	sort.Slice(messages, func(i, j int) bool { return messages[i].CreatedAt.Before(messages[j].CreatedAt) })
 	var values bytes.Buffer
@@ -326,10 +383,76 @@ func (user *User) paymentInTx(ctx context.Context, tx *sql.Tx, method string) er
 	user.State = PaymentStatePaid
 	user.SubscribedAt = time.Now()
 	user.PayMethod = method
-	_, err = tx.ExecContext(ctx, "UPDATE users SET (state,subscribed_at,pay_method)=($1,$2,$3) WHERE user_id=$4", user.State, user.SubscribedAt, user.PayMethod, user.UserId)
+	user.ProbationUntil = probationUntil(user.SubscribedAt)
+	user.PaidUntil = paidUntil
+	_, err = tx.ExecContext(ctx, "UPDATE users SET (state,subscribed_at,pay_method,probation_until,paid_until)=($1,$2,$3,$4,$5) WHERE user_id=$6", user.State, user.SubscribedAt, user.PayMethod, user.ProbationUntil, user.PaidUntil, user.UserId)
 	return err
 }
 
+// GrantMembership lets a user who authorized the bot join without paying.
+func (current *User) GrantMembership(ctx context.Context, userId string) (*User, error) {
+	if !current.Can(ctx, PermissionManageRoles) {
+		return nil, session.ForbiddenError(ctx)
+	}
+	var user *User
+	err := session.Database(ctx).RunInTransaction(ctx, nil, func(ctx context.Context, tx *sql.Tx) error {
+		var err error
+		user, err = findUserById(ctx, tx, userId)
+		if err != nil || user == nil || !user.Joinable() {
+			return err
+		}
+		before := user.auditState()
+		err = user.paymentInTx(ctx, tx, PayMethodGrant, time.Time{})
+		if err != nil || user.State != PaymentStatePaid {
+			return err
+		}
+		return createAuditEventInTx(ctx, tx, current.UserId, AuditActionGrantMember, user.UserId, "", before, user.auditState())
+	})
+	if err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	return user, nil
+}
+
+// Joinable tells whether the user can pay to join, a trial user converts to
+// paid through the same payment.
+func (user *User) Joinable() bool {
+	return user.State == PaymentStatePending || user.State == PaymentStateTrial
+}
+
+func (user *User) InProbation() bool {
+	return time.Now().Before(user.ProbationUntil)
+}
+
+func (current *User) PromoteUser(ctx context.Context, id string) (*User, error) {
+	if !current.Can(ctx, PermissionMute) {
+		return nil, session.ForbiddenError(ctx)
+	}
+	var user *User
+	err := session.Database(ctx).RunInTransaction(ctx, nil, func(ctx context.Context, tx *sql.Tx) error {
+		var err error
+		user, err = findUserById(ctx, tx, id)
+		if err != nil || user == nil || !user.InProbation() {
+			return err
+		}
+		before := user.auditState()
+		user.ProbationUntil = time.Now()
+		_, err = tx.ExecContext(ctx, "UPDATE users SET probation_until=$1 WHERE user_id=$2", user.ProbationUntil, user.UserId)
+		if err != nil {
+			return err
+		}
+		return createAuditEventInTx(ctx, tx, current.UserId, AuditActionPromote, user.UserId, "", before, user.auditState())
+	})
+	if err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	return user, nil
+}
+
+func probationUntil(subscribedAt time.Time) time.Time {
+	return subscribedAt.Add(time.Duration(config.AppConfig().System.ProbationDuration) * time.Second)
+}
+
 func PaidUsers(ctx context.Context) ([]*User, error) {
 	var users []*User
 	query := fmt.Sprintf("SELECT %s FROM users WHERE state='paid' ORDER BY subscribed_at DESC LIMIT %d", strings.Join(usersCols, ","), 3000)
@@ -349,6 +472,38 @@ func PaidUsers(ctx context.Context) ([]*User, error) {
 	return users, nil
 }
 
+// ExportMembers reads all the paid members, oldest first, the export is audited
+// because it includes the Mixin IDs.
+func (current *User) ExportMembers(ctx context.Context) ([]*User, error) {
+	if !current.Can(ctx, PermissionBan) {
+		return nil, session.ForbiddenError(ctx)
+	}
+	var users []*User
+	err := session.Database(ctx).RunInTransaction(ctx, nil, func(ctx context.Context, tx *sql.Tx) error {
+		query := fmt.Sprintf("SELECT %s FROM users WHERE state=$1 ORDER BY subscribed_at", strings.Join(usersCols, ","))
+		rows, err := tx.QueryContext(ctx, query, PaymentStatePaid)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			u, err := userFromRow(rows)
+			if err != nil {
+				return err
+			}
+			users = append(users, u)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		return createAuditEventInTx(ctx, tx, current.UserId, AuditActionExportMembers, "", "", nil, len(users))
+	})
+	if err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	return users, nil
+}
+
 func Subscribers(ctx context.Context, offset time.Time, identity int64, keywords string) ([]*User, error) {
 	if identity > 20000 {
 		user, err := findUserByIdentityNumber(ctx, identity)
@@ -388,9 +543,10 @@ func PaidMemberCount(ctx context.Context) (int64, error) {
 	return count, nil
 }
 
+// DeleteUser kicks the user out of the group, a protected user can't be kicked.
 func (user *User) DeleteUser(ctx context.Context, id string) error {
-	if !config.AppConfig.System.Operators[user.UserId] {
-		return nil
+	if !user.Can(ctx, PermissionBan) || isProtected(ctx, id) {
+		return session.ForbiddenError(ctx)
 	}
 	err := session.Database(ctx).RunInTransaction(ctx, nil, func(ctx context.Context, tx *sql.Tx) error {
 		u, err := findUserById(ctx, tx, id)
@@ -402,6 +558,10 @@ func (user *User) DeleteUser(ctx context.Context, id string) error {
 		if err != nil {
 			return err
 		}
+		err = createAuditEventInTx(ctx, tx, user.UserId, AuditActionKick, u.UserId, "", u.auditState(), nil)
+		if err != nil {
+			return err
+		}
 		_, err = tx.ExecContext(ctx, "DELETE FROM users WHERE user_id=$1", u.UserId)
 		return err
 	})
@@ -411,27 +571,24 @@ func (user *User) DeleteUser(ctx context.Context, id string) error {
 	return nil
 }
 
-func (user *User) GetRole() string {
-	if config.AppConfig.System.Operators[user.UserId] {
-		return "admin"
-	}
-	return "user"
-}
-
-func (user *User) isAdmin() bool {
-	if config.AppConfig.System.Operators[user.UserId] {
-		return true
+func (user *User) auditState() map[string]interface{} {
+	return map[string]interface{}{
+		"identity_number": user.IdentityNumber,
+		"full_name":       user.FullName,
+		"state":           user.State,
+		"subscribed_at":   user.SubscribedAt,
+		"probation_until": user.ProbationUntil,
+		"paid_until":      user.PaidUntil,
 	}
-	return false
 }
 
 func subscribedUsers(ctx context.Context, subscribedAt time.Time, limit int, senderID string) ([]*User, error) {
 	var users []*User
 	//query := fmt.Sprintf("SELECT %s FROM users WHERE subscribed_at>$1 AND active_at>$2 ORDER BY subscribed_at LIMIT %d", strings.Join(usersCols, ","), limit)
 	//params := []interface{}{subscribedAt, time.Now().Add(-24 * 6 * time.Hour)}
-	//if config.AppConfig.System.Operators[senderID] || config.AppConfig.Mixin.ClientId == senderID {
-	query := fmt.Sprintf("SELECT %s FROM users WHERE subscribed_at>$1 ORDER BY subscribed_at LIMIT %d", strings.Join(usersCols, ","), limit)
-	params := []interface{}{subscribedAt}
+	//if config.AppConfig().System.Operators[senderID] || config.AppConfig().Mixin.ClientId == senderID {
+	query := fmt.Sprintf("SELECT %s FROM users WHERE subscribed_at>$1 AND state IN ($2,$3) ORDER BY subscribed_at LIMIT %d", strings.Join(usersCols, ","), limit)
+	params := []interface{}{subscribedAt, PaymentStatePaid, PaymentStateTrial}
 	// }
 	rows, err := session.Database(ctx).QueryContext(ctx, query, params...)
 	if err != nil {
@@ -502,7 +659,7 @@ func LoopingInactiveUsers(ctx context.Context) ([]*User, error) {
 func (user *User) Hibernate(ctx context.Context) error {
 	err := session.Database(ctx).RunInTransaction(ctx, nil, func(ctx context.Context, tx *sql.Tx) error {
 		if user.State == PaymentStatePaid {
-			text := base64.RawURLEncoding.EncodeToString([]byte(config.AppConfig.MessageTemplate.MessageTipsSuspended))
+			text := base64.RawURLEncoding.EncodeToString([]byte(config.AppConfig().MessageTemplate.MessageTipsSuspended))
 			err := createSystemDistributedMessageInTx(ctx, tx, user, MessageCategoryPlainText, text)
 			if err != nil {
 				return err
@@ -8,6 +8,8 @@ import (
 	"time"
 
 	bot "github.com/MixinNetwork/bot-api-go-client/v2"
+	number "github.com/MixinNetwork/go-number"
+	"github.com/MixinNetwork/supergroup.mixin.one/config"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -118,12 +120,16 @@ func TestUserCRUD(t *testing.T) {
 	assert.Nil(err)
 	assert.NotNil(user)
 
-	li.DeleteUser(ctx, li.UserId)
+	err = li.DeleteUser(ctx, li.UserId)
+	assert.NotNil(err)
 	user, err = FindUser(ctx, li.UserId)
 	assert.Nil(err)
 	assert.NotNil(user)
 	admin := &User{UserId: "e9e5b807-fa8b-455a-8dfa-b189d28310ff"}
-	admin.DeleteUser(ctx, li.UserId)
+	err = admin.DeleteUser(ctx, admin.UserId)
+	assert.NotNil(err)
+	err = admin.DeleteUser(ctx, li.UserId)
+	assert.Nil(err)
 	user, err = FindUser(ctx, li.UserId)
 	assert.Nil(err)
 	assert.Nil(user)
@@ -176,7 +182,7 @@ func TestBlacklistCRUD(t *testing.T) {
 
 	admin := &User{UserId: "e9e5b807-fa8b-455a-8dfa-b189d28310ff"}
 	id := bot.UuidNewV4().String()
-	list, err := admin.CreateBlacklist(ctx, id)
+	list, err := admin.CreateBlacklist(ctx, id, "", "", 0)
 	assert.Nil(err)
 	assert.NotNil(list)
 	list, err = ReadBlacklist(ctx, id)
@@ -186,14 +192,157 @@ func TestBlacklistCRUD(t *testing.T) {
 	li, err := createUser(ctx, public, private, authorizationID, "", bot.UuidNewV4().String(), "1001", "name", "http://localhost")
 	assert.Nil(err)
 	assert.NotNil(li)
-	list, err = admin.CreateBlacklist(ctx, li.UserId)
+	list, err = admin.CreateBlacklist(ctx, li.UserId, "spam", "", 0)
 	assert.Nil(err)
 	assert.NotNil(list)
 	list, err = ReadBlacklist(ctx, li.UserId)
 	assert.Nil(err)
 	assert.NotNil(list)
+	assert.Equal("spam", list.Reason)
+	assert.Equal(admin.UserId, list.OperatorId)
+	assert.False(list.ExpiredAt.Valid)
 
 	user, err := FindUser(ctx, li.UserId)
 	assert.Nil(err)
 	assert.Nil(user)
+
+	lists, err := li.Blacklists(ctx, time.Time{}, "", 100)
+	assert.NotNil(err)
+	lists, err = admin.Blacklists(ctx, time.Time{}, "", 100)
+	assert.Nil(err)
+	assert.Len(lists, 1)
+	lists, err = admin.Blacklists(ctx, time.Time{}, "1001", 100)
+	assert.Nil(err)
+	assert.Len(lists, 1)
+	lists, err = admin.Blacklists(ctx, time.Time{}, "nobody", 100)
+	assert.Nil(err)
+	assert.Len(lists, 0)
+	lists, err = admin.Blacklists(ctx, list.CreatedAt, "", 100)
+	assert.Nil(err)
+	assert.Len(lists, 0)
+
+	list, err = admin.DeleteBlacklist(ctx, li.UserId)
+	assert.Nil(err)
+	assert.NotNil(list)
+	list, err = ReadBlacklist(ctx, li.UserId)
+	assert.Nil(err)
+	assert.Nil(list)
+
+	li, err = createUser(ctx, public, private, authorizationID, "", li.UserId, "1001", "name", "http://localhost")
+	assert.Nil(err)
+	assert.NotNil(li)
+	list, err = admin.CreateBlacklist(ctx, li.UserId, "", "", time.Millisecond)
+	assert.Nil(err)
+	assert.True(list.ExpiredAt.Valid)
+	time.Sleep(10 * time.Millisecond)
+	list, err = ReadBlacklist(ctx, li.UserId)
+	assert.Nil(err)
+	assert.Nil(list)
+	count, err := LoopClearUpExpiredBlacklists(ctx)
+	assert.Nil(err)
+	assert.Equal(int64(1), count)
+}
+
+func TestUserProbation(t *testing.T) {
+	assert := assert.New(t)
+	ctx := setupTestContext()
+	defer teardownTestContext(ctx)
+
+	config.AppConfig().System.ProbationDuration = 3600
+	defer func() { config.AppConfig().System.ProbationDuration = 0 }()
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(err)
+	public := base64.RawURLEncoding.EncodeToString(pub)
+	private := base64.RawURLEncoding.EncodeToString(priv)
+	authorizationID := bot.UuidNewV4().String()
+
+	user, err := createUser(ctx, public, private, authorizationID, "", bot.UuidNewV4().String(), "1000", "name", "http://localhost")
+	assert.Nil(err)
+	assert.NotNil(user)
+	assert.False(user.InProbation())
+	err = user.Payment(ctx)
+	assert.Nil(err)
+	user, err = FindUser(ctx, user.UserId)
+	assert.Nil(err)
+	assert.True(user.InProbation())
+
+	text := base64.RawURLEncoding.EncodeToString([]byte("hello"))
+	link := base64.RawURLEncoding.EncodeToString([]byte("hello https://mixin.one"))
+	assert.True(probationMessageAllowed(MessageCategoryPlainText, text))
+	assert.False(probationMessageAllowed(MessageCategoryPlainText, link))
+	assert.False(probationMessageAllowed(MessageCategoryPlainImage, text))
+	message, err := CreateMessage(ctx, user, bot.UuidNewV4().String(), MessageCategoryPlainSticker, "", text, false, time.Now(), time.Now())
+	assert.Nil(err)
+	assert.Nil(message)
+	message, err = CreateMessage(ctx, user, bot.UuidNewV4().String(), MessageCategoryPlainText, "", text, false, time.Now(), time.Now())
+	assert.Nil(err)
+	assert.NotNil(message)
+	packet, err := user.CreatePacket(ctx, bot.UuidNewV4().String(), number.FromString("1"), 1, "hello")
+	assert.NotNil(err)
+	assert.Nil(packet)
+
+	p, err := user.PromoteUser(ctx, user.UserId)
+	assert.NotNil(err)
+	assert.Nil(p)
+	admin := &User{UserId: config.AppConfig().System.OperatorList[0]}
+	p, err = admin.PromoteUser(ctx, user.UserId)
+	assert.Nil(err)
+	assert.NotNil(p)
+	assert.False(p.InProbation())
+	user, err = FindUser(ctx, user.UserId)
+	assert.Nil(err)
+	assert.False(user.InProbation())
+}
+
+func TestUserGrantMembership(t *testing.T) {
+	assert := assert.New(t)
+	ctx := setupTestContext()
+	defer teardownTestContext(ctx)
+
+	payToJoin := config.AppConfig().System.PayToJoin
+	config.AppConfig().System.PayToJoin = true
+	defer func() { config.AppConfig().System.PayToJoin = payToJoin }()
+
+	err := SeedRoles(ctx)
+	assert.Nil(err)
+	owner := &User{UserId: config.AppConfig().System.OperatorList[0]}
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(err)
+	public := base64.RawURLEncoding.EncodeToString(pub)
+	private := base64.RawURLEncoding.EncodeToString(priv)
+	user, err := createUser(ctx, public, private, bot.UuidNewV4().String(), "", bot.UuidNewV4().String(), "1000", "name", "http://localhost")
+	assert.Nil(err)
+	assert.NotNil(user)
+	assert.Equal(PaymentStatePending, user.State)
+
+	users, err := owner.ExportMembers(ctx)
+	assert.Nil(err)
+	assert.Len(users, 0)
+	users, err = user.ExportMembers(ctx)
+	assert.NotNil(err)
+
+	granted, err := user.GrantMembership(ctx, user.UserId)
+	assert.NotNil(err)
+	assert.Nil(granted)
+	granted, err = owner.GrantMembership(ctx, bot.UuidNewV4().String())
+	assert.Nil(err)
+	assert.Nil(granted)
+	granted, err = owner.GrantMembership(ctx, user.UserId)
+	assert.Nil(err)
+	assert.NotNil(granted)
+	assert.Equal(PaymentStatePaid, granted.State)
+	assert.Equal(PayMethodGrant, granted.PayMethod)
+	user, err = FindUser(ctx, user.UserId)
+	assert.Nil(err)
+	assert.Equal(PaymentStatePaid, user.State)
+
+	users, err = owner.ExportMembers(ctx)
+	assert.Nil(err)
+	assert.Len(users, 1)
+	assert.Equal(user.UserId, users[0].UserId)
+	events, err := owner.AuditEvents(ctx, owner.UserId, "", time.Time{}, time.Time{}, 10)
+	assert.Nil(err)
+	assert.Len(events, 3)
 }
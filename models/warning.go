@@ -0,0 +1,171 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+
+	bot "github.com/MixinNetwork/bot-api-go-client/v2"
+	"github.com/MixinNetwork/supergroup.mixin.one/config"
+	"github.com/MixinNetwork/supergroup.mixin.one/durable"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+	"github.com/gofrs/uuid/v5"
+)
+
+const (
+	WarningActionMute = "mute"
+	WarningActionBan  = "ban"
+)
+
+type Warning struct {
+	WarningId  string
+	UserId     string
+	OperatorId string
+	Reason     string
+	MessageId  string
+	CreatedAt  time.Time
+}
+
+var warningsCols = []string{"warning_id", "user_id", "operator_id", "reason", "message_id", "created_at"}
+
+func (w *Warning) values() []interface{} {
+	return []interface{}{w.WarningId, w.UserId, w.OperatorId, w.Reason, w.MessageId, w.CreatedAt}
+}
+
+func warningFromRow(row durable.Row) (*Warning, error) {
+	var w Warning
+	err := row.Scan(&w.WarningId, &w.UserId, &w.OperatorId, &w.Reason, &w.MessageId, &w.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return &w, err
+}
+
+// CreateWarning records a warning against the user and tells them the reason,
+// then applies the escalation ladder to the warnings that haven't decayed. A
+// protected user can't be warned.
+func (current *User) CreateWarning(ctx context.Context, userId, reason, messageId string) (*Warning, error) {
+	if !current.Can(ctx, PermissionMute) {
+		return nil, session.ForbiddenError(ctx)
+	}
+	if id := uuid.FromStringOrNil(userId); id.String() != userId {
+		return nil, session.BadDataError(ctx)
+	}
+	if isProtected(ctx, userId) {
+		return nil, session.ForbiddenError(ctx)
+	}
+
+	w := &Warning{
+		WarningId:  bot.UuidNewV4().String(),
+		UserId:     userId,
+		OperatorId: current.UserId,
+		Reason:     FirstNStringInRune(reason, 256),
+		MessageId:  messageId,
+		CreatedAt:  time.Now(),
+	}
+	var count int
+	err := session.Database(ctx).RunInTransaction(ctx, nil, func(ctx context.Context, tx *sql.Tx) error {
+		u, err := findUserById(ctx, tx, userId)
+		if err != nil || u == nil {
+			w = nil
+			return err
+		}
+		query := durable.PrepareQuery("INSERT INTO warnings (%s) VALUES (%s)", warningsCols)
+		_, err = tx.ExecContext(ctx, query, w.values()...)
+		if err != nil {
+			return err
+		}
+		err = tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM warnings WHERE user_id=$1 AND created_at>$2", userId, warningsDecayedAt()).Scan(&count)
+		if err != nil {
+			return err
+		}
+		err = createAuditEventInTx(ctx, tx, current.UserId, AuditActionWarn, userId, w.Reason, nil, map[string]interface{}{"message_id": w.MessageId, "count": count})
+		if err != nil {
+			return err
+		}
+		tips := fmt.Sprintf(config.AppConfig().MessageTemplate.MessageTipsWarned, w.Reason, count)
+		return createSystemDistributedMessageInTx(ctx, tx, u, MessageCategoryPlainText, base64.RawURLEncoding.EncodeToString([]byte(tips)))
+	})
+	if err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	if w == nil {
+		return nil, nil
+	}
+	return w, current.escalateWarnings(ctx, w, count)
+}
+
+// escalateWarnings applies the highest step the count has reached, so every
+// further warning repeats that step until the next one is reached. The ban step
+// is recorded as done by the bot, the warning moderator may lack the ban
+// permission and is only told about it.
+func (current *User) escalateWarnings(ctx context.Context, w *Warning, count int) error {
+	var step *config.WarningStep
+	for i, s := range config.AppConfig().System.WarningLadder {
+		if s.Count > 0 && count >= s.Count && (step == nil || s.Count > step.Count) {
+			step = &config.AppConfig().System.WarningLadder[i]
+		}
+	}
+	if step == nil {
+		return nil
+	}
+
+	reason := fmt.Sprintf("%d warnings", count)
+	duration := time.Duration(step.Duration) * time.Second
+	switch step.Action {
+	case WarningActionMute:
+		if duration <= 0 {
+			return nil
+		}
+		_, err := current.CreateMute(ctx, w.UserId, duration)
+		return err
+	case WarningActionBan:
+		_, err := createBlacklist(ctx, config.AppConfig().Mixin.ClientId, current, w.UserId, reason, w.MessageId, duration)
+		return err
+	}
+	return nil
+}
+
+// ReadActiveWarnings lists the warnings that haven't decayed, newest first.
+func ReadActiveWarnings(ctx context.Context, userId string) ([]*Warning, error) {
+	query := fmt.Sprintf("SELECT %s FROM warnings WHERE user_id=$1 AND created_at>$2 ORDER BY created_at DESC", strings.Join(warningsCols, ","))
+	rows, err := session.Database(ctx).QueryContext(ctx, query, userId, warningsDecayedAt())
+	if err != nil {
+		return nil, session.TransactionError(ctx, err)
+	}
+	defer rows.Close()
+
+	var warnings []*Warning
+	for rows.Next() {
+		w, err := warningFromRow(rows)
+		if err != nil {
+			return nil, session.TransactionError(ctx, err)
+		}
+		warnings = append(warnings, w)
+	}
+	return warnings, nil
+}
+
+func LoopClearUpExpiredWarnings(ctx context.Context) (int64, error) {
+	if config.AppConfig().System.WarningDecay <= 0 {
+		return 0, nil
+	}
+	query := "DELETE FROM warnings WHERE warning_id IN (SELECT warning_id FROM warnings WHERE created_at<$1 LIMIT 100)"
+	r, err := session.Database(ctx).ExecContext(ctx, query, warningsDecayedAt())
+	if err != nil {
+		return 0, session.TransactionError(ctx, err)
+	}
+	return r.RowsAffected()
+}
+
+// warningsDecayedAt returns the time before which warnings no longer count.
+func warningsDecayedAt() time.Time {
+	decay := config.AppConfig().System.WarningDecay
+	if decay <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(-time.Duration(decay) * time.Second)
+}
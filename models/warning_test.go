@@ -0,0 +1,100 @@
+package models
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	bot "github.com/MixinNetwork/bot-api-go-client/v2"
+	"github.com/MixinNetwork/supergroup.mixin.one/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWarningCRUD(t *testing.T) {
+	assert := assert.New(t)
+	ctx := setupTestContext()
+	defer teardownTestContext(ctx)
+
+	decay, ladder := config.AppConfig().System.WarningDecay, config.AppConfig().System.WarningLadder
+	defer func() {
+		config.AppConfig().System.WarningDecay, config.AppConfig().System.WarningLadder = decay, ladder
+	}()
+	config.AppConfig().System.WarningDecay = 3600
+	config.AppConfig().System.WarningLadder = []config.WarningStep{
+		{Count: 2, Action: WarningActionMute, Duration: 3600},
+		{Count: 3, Action: WarningActionBan},
+	}
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(err)
+	public := base64.RawURLEncoding.EncodeToString(pub)
+	private := base64.RawURLEncoding.EncodeToString(priv)
+	user, err := createUser(ctx, public, private, bot.UuidNewV4().String(), "", bot.UuidNewV4().String(), "1000", "name", "http://localhost")
+	assert.Nil(err)
+	assert.NotNil(user)
+
+	warning, err := user.CreateWarning(ctx, user.UserId, "spam", "")
+	assert.NotNil(err)
+	assert.Nil(warning)
+	admin := &User{UserId: config.AppConfig().System.OperatorList[0]}
+	warning, err = admin.CreateWarning(ctx, "invalid", "spam", "")
+	assert.NotNil(err)
+	warning, err = admin.CreateWarning(ctx, bot.UuidNewV4().String(), "spam", "")
+	assert.Nil(err)
+	assert.Nil(warning)
+	warning, err = admin.CreateWarning(ctx, admin.UserId, "spam", "")
+	assert.NotNil(err)
+	assert.Nil(warning)
+
+	warning, err = admin.CreateWarning(ctx, user.UserId, "spam", "")
+	assert.Nil(err)
+	assert.NotNil(warning)
+	mute, err := ReadActiveMute(ctx, user.UserId)
+	assert.Nil(err)
+	assert.Nil(mute)
+	warning, err = admin.CreateWarning(ctx, user.UserId, "links", "")
+	assert.Nil(err)
+	assert.NotNil(warning)
+	mute, err = ReadActiveMute(ctx, user.UserId)
+	assert.Nil(err)
+	assert.NotNil(mute)
+	warnings, err := ReadActiveWarnings(ctx, user.UserId)
+	assert.Nil(err)
+	assert.Len(warnings, 2)
+	assert.Equal("links", warnings[0].Reason)
+
+	pub, priv, err = ed25519.GenerateKey(rand.Reader)
+	assert.Nil(err)
+	public = base64.RawURLEncoding.EncodeToString(pub)
+	private = base64.RawURLEncoding.EncodeToString(priv)
+	moderator, err := createUser(ctx, public, private, bot.UuidNewV4().String(), "", bot.UuidNewV4().String(), "1001", "name", "http://localhost")
+	assert.Nil(err)
+	_, err = admin.GrantRole(ctx, moderator.UserId, RoleModerator)
+	assert.Nil(err)
+	b, err := moderator.CreateBlacklist(ctx, user.UserId, "spam", "", 0)
+	assert.Nil(err)
+	assert.Nil(b)
+	warning, err = moderator.CreateWarning(ctx, user.UserId, "again", "")
+	assert.Nil(err)
+	assert.NotNil(warning)
+	b, err = ReadBlacklist(ctx, user.UserId)
+	assert.Nil(err)
+	assert.NotNil(b)
+	assert.Equal("3 warnings", b.Reason)
+	assert.Equal(config.AppConfig().Mixin.ClientId, b.OperatorId)
+	assert.False(b.ExpiredAt.Valid)
+	u, err := FindUser(ctx, user.UserId)
+	assert.Nil(err)
+	assert.Nil(u)
+
+	config.AppConfig().System.WarningDecay = 1
+	time.Sleep(1100 * time.Millisecond)
+	warnings, err = ReadActiveWarnings(ctx, user.UserId)
+	assert.Nil(err)
+	assert.Len(warnings, 0)
+	count, err := LoopClearUpExpiredWarnings(ctx)
+	assert.Nil(err)
+	assert.Equal(int64(3), count)
+}
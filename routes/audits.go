@@ -0,0 +1,29 @@
+package routes
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/MixinNetwork/supergroup.mixin.one/middlewares"
+	"github.com/MixinNetwork/supergroup.mixin.one/views"
+	"github.com/dimfeld/httptreemux"
+)
+
+type auditsImpl struct{}
+
+func registerAudits(router *httptreemux.TreeMux) {
+	impl := &auditsImpl{}
+
+	router.GET("/audits", impl.index)
+}
+
+func (impl *auditsImpl) index(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+	query := r.URL.Query()
+	since, _ := time.Parse(time.RFC3339Nano, query.Get("since"))
+	offset, _ := time.Parse(time.RFC3339Nano, query.Get("offset"))
+	if events, err := middlewares.CurrentUser(r).AuditEvents(r.Context(), query.Get("actor"), query.Get("action"), since, offset, 100); err != nil {
+		views.RenderErrorResponse(w, r, err)
+	} else {
+		views.RenderAuditEvents(w, r, events)
+	}
+}
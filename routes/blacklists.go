@@ -0,0 +1,39 @@
+package routes
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/MixinNetwork/supergroup.mixin.one/middlewares"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+	"github.com/MixinNetwork/supergroup.mixin.one/views"
+	"github.com/dimfeld/httptreemux"
+)
+
+type blacklistsImpl struct{}
+
+func registerBlacklists(router *httptreemux.TreeMux) {
+	impl := &blacklistsImpl{}
+
+	router.GET("/blacklists", impl.index)
+	router.DELETE("/blacklists/:id", impl.delete)
+}
+
+func (impl *blacklistsImpl) index(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+	offset, _ := time.Parse(time.RFC3339Nano, r.URL.Query().Get("offset"))
+	if blacklists, err := middlewares.CurrentUser(r).Blacklists(r.Context(), offset, r.URL.Query().Get("q"), 100); err != nil {
+		views.RenderErrorResponse(w, r, err)
+	} else {
+		views.RenderBlacklists(w, r, blacklists)
+	}
+}
+
+func (impl *blacklistsImpl) delete(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	if b, err := middlewares.CurrentUser(r).DeleteBlacklist(r.Context(), params["id"]); err != nil {
+		views.RenderErrorResponse(w, r, err)
+	} else if b == nil {
+		views.RenderErrorResponse(w, r, session.NotFoundError(r.Context()))
+	} else {
+		views.RenderBlankResponse(w, r)
+	}
+}
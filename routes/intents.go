@@ -0,0 +1,48 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/MixinNetwork/supergroup.mixin.one/middlewares"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+	"github.com/MixinNetwork/supergroup.mixin.one/views"
+	"github.com/dimfeld/httptreemux"
+)
+
+type intentsImpl struct{}
+
+func registerIntents(router *httptreemux.TreeMux) {
+	impl := &intentsImpl{}
+
+	router.POST("/intents", impl.create)
+	router.GET("/intents/:id", impl.show)
+}
+
+func (impl *intentsImpl) create(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+	var body struct {
+		Action  string `json:"action"`
+		Target  string `json:"target"`
+		Plan    string `json:"plan"`
+		AssetId string `json:"asset_id"`
+		Amount  string `json:"amount"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		views.RenderErrorResponse(w, r, session.BadRequestError(r.Context()))
+		return
+	}
+	if intent, err := middlewares.CurrentUser(r).CreatePaymentIntent(r.Context(), body.Action, body.Target, body.Plan, body.AssetId, body.Amount); err != nil {
+		views.RenderErrorResponse(w, r, err)
+	} else {
+		views.RenderPaymentIntent(w, r, intent)
+	}
+}
+
+func (impl *intentsImpl) show(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	if intent, err := middlewares.CurrentUser(r).ReadPaymentIntent(r.Context(), params["id"]); err != nil {
+		views.RenderErrorResponse(w, r, err)
+	} else {
+		views.RenderPaymentIntent(w, r, intent)
+	}
+}
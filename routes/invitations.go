@@ -0,0 +1,72 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/MixinNetwork/supergroup.mixin.one/middlewares"
+	"github.com/MixinNetwork/supergroup.mixin.one/models"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+	"github.com/MixinNetwork/supergroup.mixin.one/utils"
+	"github.com/MixinNetwork/supergroup.mixin.one/views"
+	"github.com/dimfeld/httptreemux"
+)
+
+type invitationsImpl struct{}
+
+func registerInvitations(router *httptreemux.TreeMux) {
+	impl := &invitationsImpl{}
+
+	router.POST("/invitations", impl.create)
+	router.GET("/invitations", impl.index)
+	router.GET("/invitations/:code/poster", impl.poster)
+}
+
+func (impl *invitationsImpl) create(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+	var body struct {
+		Plan      string    `json:"plan"`
+		Discount  string    `json:"discount"`
+		MaxUses   int64     `json:"max_uses"`
+		ExpiredAt time.Time `json:"expired_at"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		views.RenderErrorResponse(w, r, session.BadRequestError(r.Context()))
+		return
+	}
+	if invitation, err := middlewares.CurrentUser(r).CreateInvitation(r.Context(), body.Plan, body.Discount, body.MaxUses, body.ExpiredAt); err != nil {
+		views.RenderErrorResponse(w, r, err)
+	} else {
+		views.RenderInvitation(w, r, invitation)
+	}
+}
+
+func (impl *invitationsImpl) index(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+	if invitations, err := middlewares.CurrentUser(r).Invitations(r.Context()); err != nil {
+		views.RenderErrorResponse(w, r, err)
+	} else {
+		views.RenderInvitations(w, r, invitations)
+	}
+}
+
+func (impl *invitationsImpl) poster(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	invitation, err := models.ReadInvitation(r.Context(), params["code"])
+	if err != nil {
+		views.RenderErrorResponse(w, r, err)
+		return
+	}
+	if invitation == nil {
+		views.RenderErrorResponse(w, r, session.NotFoundError(r.Context()))
+		return
+	}
+	data, err := utils.EncodeQRCodePoster(invitation.URL())
+	if err != nil {
+		views.RenderErrorResponse(w, r, session.ServerError(r.Context(), err))
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
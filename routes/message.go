@@ -20,11 +20,12 @@ func registerMesseages(router *httptreemux.TreeMux) {
 
 	router.GET("/messages", impl.index)
 	router.POST("/messages/:id/recall", impl.recall)
+	router.POST("/messages/:id/block", impl.block)
 }
 
 func (impl *messageImpl) index(w http.ResponseWriter, r *http.Request, _ map[string]string) {
 	user := middlewares.CurrentUser(r)
-	if user.GetRole() != "admin" {
+	if !user.Can(r.Context(), models.PermissionRecall) {
 		views.RenderErrorResponse(w, r, session.ForbiddenError(r.Context()))
 	} else if messages, err := models.LatestMessageWithUser(r.Context(), 200); err != nil {
 		views.RenderErrorResponse(w, r, err)
@@ -67,3 +68,13 @@ func (impl *messageImpl) recall(w http.ResponseWriter, r *http.Request, params m
 		views.RenderBlankResponse(w, r)
 	}
 }
+
+func (impl *messageImpl) block(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	if b, err := middlewares.CurrentUser(r).CreateImageBlock(r.Context(), params["id"]); err != nil {
+		views.RenderErrorResponse(w, r, err)
+	} else if b == nil {
+		views.RenderErrorResponse(w, r, session.NotFoundError(r.Context()))
+	} else {
+		views.RenderBlankResponse(w, r)
+	}
+}
@@ -17,6 +17,7 @@ func registerProperties(router *httptreemux.TreeMux) {
 	impl := propertyImpl{}
 
 	router.POST("/properties", impl.create)
+	router.POST("/properties/slow-mode", impl.slowMode)
 }
 
 func (impl *propertyImpl) create(w http.ResponseWriter, r *http.Request, _ map[string]string) {
@@ -28,11 +29,24 @@ func (impl *propertyImpl) create(w http.ResponseWriter, r *http.Request, _ map[s
 		views.RenderErrorResponse(w, r, session.BadRequestError(r.Context()))
 		return
 	}
-	if middlewares.CurrentUser(r).GetRole() != "admin" {
-		views.RenderErrorResponse(w, r, session.ForbiddenError(r.Context()))
+	_, err := middlewares.CurrentUser(r).CreateProperty(r.Context(), models.ProhibitedMessage, body.Value)
+	if err != nil {
+		views.RenderErrorResponse(w, r, err)
+	} else {
+		views.RenderBlankResponse(w, r)
+	}
+}
+
+func (impl *propertyImpl) slowMode(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+	var body struct {
+		Seconds int64 `json:"seconds"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		views.RenderErrorResponse(w, r, session.BadRequestError(r.Context()))
 		return
 	}
-	_, err := models.CreateProperty(r.Context(), models.ProhibitedMessage, body.Value)
+	_, err := middlewares.CurrentUser(r).CreateSlowModeProperty(r.Context(), body.Seconds)
 	if err != nil {
 		views.RenderErrorResponse(w, r, err)
 	} else {
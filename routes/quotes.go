@@ -0,0 +1,37 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/MixinNetwork/supergroup.mixin.one/middlewares"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+	"github.com/MixinNetwork/supergroup.mixin.one/views"
+	"github.com/dimfeld/httptreemux"
+)
+
+type quotesImpl struct{}
+
+func registerQuotes(router *httptreemux.TreeMux) {
+	impl := quotesImpl{}
+
+	router.POST("/quotes", impl.create)
+}
+
+func (impl *quotesImpl) create(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+	var body struct {
+		Plan    string `json:"plan"`
+		AssetId string `json:"asset_id"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		views.RenderErrorResponse(w, r, session.BadRequestError(r.Context()))
+		return
+	}
+	quote, asset, err := middlewares.CurrentUser(r).CreatePaymentQuote(r.Context(), body.Plan, body.AssetId)
+	if err != nil {
+		views.RenderErrorResponse(w, r, err)
+	} else {
+		views.RenderPaymentQuote(w, r, quote, asset)
+	}
+}
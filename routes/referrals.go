@@ -0,0 +1,25 @@
+package routes
+
+import (
+	"net/http"
+
+	"github.com/MixinNetwork/supergroup.mixin.one/models"
+	"github.com/MixinNetwork/supergroup.mixin.one/views"
+	"github.com/dimfeld/httptreemux"
+)
+
+type referralsImpl struct{}
+
+func registerReferrals(router *httptreemux.TreeMux) {
+	impl := &referralsImpl{}
+
+	router.GET("/referrals/leaderboard", impl.leaderboard)
+}
+
+func (impl *referralsImpl) leaderboard(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+	if referrers, err := models.ReferralLeaderboard(r.Context(), 50); err != nil {
+		views.RenderErrorResponse(w, r, err)
+	} else {
+		views.RenderReferrers(w, r, referrers)
+	}
+}
@@ -0,0 +1,55 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/MixinNetwork/supergroup.mixin.one/middlewares"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+	"github.com/MixinNetwork/supergroup.mixin.one/views"
+	"github.com/dimfeld/httptreemux"
+)
+
+type rolesImpl struct{}
+
+type roleRequest struct {
+	UserId string `json:"user_id"`
+	Role   string `json:"role"`
+}
+
+func registerRoles(router *httptreemux.TreeMux) {
+	impl := &rolesImpl{}
+
+	router.GET("/roles", impl.index)
+	router.POST("/roles", impl.create)
+	router.DELETE("/roles/:id", impl.delete)
+}
+
+func (impl *rolesImpl) index(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+	if roles, err := middlewares.CurrentUser(r).Roles(r.Context()); err != nil {
+		views.RenderErrorResponse(w, r, err)
+	} else {
+		views.RenderRoles(w, r, roles)
+	}
+}
+
+func (impl *rolesImpl) create(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+	var body roleRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		views.RenderErrorResponse(w, r, session.BadRequestError(r.Context()))
+	} else if role, err := middlewares.CurrentUser(r).GrantRole(r.Context(), body.UserId, body.Role); err != nil {
+		views.RenderErrorResponse(w, r, err)
+	} else {
+		views.RenderRole(w, r, role)
+	}
+}
+
+func (impl *rolesImpl) delete(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	if role, err := middlewares.CurrentUser(r).RevokeRole(r.Context(), params["id"]); err != nil {
+		views.RenderErrorResponse(w, r, err)
+	} else if role == nil {
+		views.RenderErrorResponse(w, r, session.NotFoundError(r.Context()))
+	} else {
+		views.RenderBlankResponse(w, r)
+	}
+}
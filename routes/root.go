@@ -19,6 +19,15 @@ func RegisterRoutes(router *httptreemux.TreeMux) {
 	registerMesseages(router)
 	registerProperties(router)
 	registerBroadcasters(router)
+	registerBlacklists(router)
+	registerAudits(router)
+	registerRoles(router)
+	registerSettings(router)
+	registerQuotes(router)
+	registerSnapshots(router)
+	registerIntents(router)
+	registerInvitations(router)
+	registerReferrals(router)
 }
 
 func root(w http.ResponseWriter, r *http.Request, params map[string]string) {
@@ -0,0 +1,39 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/MixinNetwork/supergroup.mixin.one/middlewares"
+	"github.com/MixinNetwork/supergroup.mixin.one/session"
+	"github.com/MixinNetwork/supergroup.mixin.one/views"
+	"github.com/dimfeld/httptreemux"
+)
+
+type settingsImpl struct{}
+
+func registerSettings(router *httptreemux.TreeMux) {
+	impl := &settingsImpl{}
+
+	router.GET("/settings", impl.index)
+	router.PUT("/settings", impl.update)
+}
+
+func (impl *settingsImpl) index(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+	if settings, err := middlewares.CurrentUser(r).Settings(r.Context()); err != nil {
+		views.RenderErrorResponse(w, r, err)
+	} else {
+		views.RenderSettings(w, r, settings)
+	}
+}
+
+func (impl *settingsImpl) update(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+	var body map[string]json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		views.RenderErrorResponse(w, r, session.BadRequestError(r.Context()))
+	} else if settings, err := middlewares.CurrentUser(r).UpdateSettings(r.Context(), body); err != nil {
+		views.RenderErrorResponse(w, r, err)
+	} else {
+		views.RenderSettings(w, r, settings)
+	}
+}
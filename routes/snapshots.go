@@ -0,0 +1,29 @@
+package routes
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/MixinNetwork/supergroup.mixin.one/middlewares"
+	"github.com/MixinNetwork/supergroup.mixin.one/views"
+	"github.com/dimfeld/httptreemux"
+)
+
+type snapshotsImpl struct{}
+
+func registerSnapshots(router *httptreemux.TreeMux) {
+	impl := &snapshotsImpl{}
+
+	router.GET("/snapshots", impl.index)
+}
+
+func (impl *snapshotsImpl) index(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+	query := r.URL.Query()
+	since, _ := time.Parse(time.RFC3339Nano, query.Get("since"))
+	offset, _ := time.Parse(time.RFC3339Nano, query.Get("offset"))
+	if snapshots, err := middlewares.CurrentUser(r).Snapshots(r.Context(), query.Get("user"), query.Get("purpose"), since, offset, 500); err != nil {
+		views.RenderErrorResponse(w, r, err)
+	} else {
+		views.RenderSnapshots(w, r, snapshots)
+	}
+}
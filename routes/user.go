@@ -2,6 +2,7 @@ package routes
 
 import (
 	"encoding/json"
+	"io"
 	"net/http"
 	"strconv"
 	"time"
@@ -28,6 +29,9 @@ func registerUsers(router *httptreemux.TreeMux) {
 	router.POST("/unsubscribe", impl.unsubscribe)
 	router.POST("/users/:id/remove", impl.remove)
 	router.POST("/users/:id/block", impl.block)
+	router.POST("/users/:id/promote", impl.promote)
+	router.POST("/users/:id/mute", impl.mute)
+	router.POST("/users/:id/warn", impl.warn)
 	router.GET("/me", impl.me)
 	router.GET("/subscribers", impl.subscribers)
 	router.GET("/users/:id", impl.show)
@@ -37,11 +41,12 @@ func registerUsers(router *httptreemux.TreeMux) {
 
 func (impl *usersImpl) authenticate(w http.ResponseWriter, r *http.Request, params map[string]string) {
 	var body struct {
-		Code string `json:"code"`
+		Code       string `json:"code"`
+		Invitation string `json:"invitation"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
 		views.RenderErrorResponse(w, r, session.BadRequestError(r.Context()))
-	} else if user, err := models.AuthenticateUserByOAuth(r.Context(), body.Code); err != nil {
+	} else if user, err := models.AuthenticateUserByOAuth(r.Context(), body.Code, body.Invitation); err != nil {
 		views.RenderErrorResponse(w, r, err)
 	} else {
 		views.RenderAccount(w, r, user)
@@ -122,8 +127,69 @@ func (impl *usersImpl) remove(w http.ResponseWriter, r *http.Request, params map
 }
 
 func (impl *usersImpl) block(w http.ResponseWriter, r *http.Request, params map[string]string) {
-	if _, err := middlewares.CurrentUser(r).CreateBlacklist(r.Context(), params["id"]); err != nil {
+	var body struct {
+		Reason    string `json:"reason"`
+		MessageId string `json:"message_id"`
+		Duration  string `json:"duration"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil && err != io.EOF {
+		views.RenderErrorResponse(w, r, session.BadRequestError(r.Context()))
+		return
+	}
+	var duration time.Duration
+	if body.Duration != "" {
+		d, err := models.ParseDuration(body.Duration)
+		if err != nil {
+			views.RenderErrorResponse(w, r, session.BadDataError(r.Context()))
+			return
+		}
+		duration = d
+	}
+	if _, err := middlewares.CurrentUser(r).CreateBlacklist(r.Context(), params["id"], body.Reason, body.MessageId, duration); err != nil {
+		views.RenderErrorResponse(w, r, err)
+	} else {
+		views.RenderBlankResponse(w, r)
+	}
+}
+
+func (impl *usersImpl) promote(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	if user, err := middlewares.CurrentUser(r).PromoteUser(r.Context(), params["id"]); err != nil {
+		views.RenderErrorResponse(w, r, err)
+	} else if user == nil {
+		views.RenderErrorResponse(w, r, session.NotFoundError(r.Context()))
+	} else {
+		views.RenderUserView(w, r, user)
+	}
+}
+
+func (impl *usersImpl) mute(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	var body struct {
+		Duration string `json:"duration"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		views.RenderErrorResponse(w, r, session.BadRequestError(r.Context()))
+	} else if duration, err := models.ParseDuration(body.Duration); err != nil {
+		views.RenderErrorResponse(w, r, session.BadDataError(r.Context()))
+	} else if mute, err := middlewares.CurrentUser(r).CreateMute(r.Context(), params["id"], duration); err != nil {
 		views.RenderErrorResponse(w, r, err)
+	} else if mute == nil {
+		views.RenderErrorResponse(w, r, session.NotFoundError(r.Context()))
+	} else {
+		views.RenderBlankResponse(w, r)
+	}
+}
+
+func (impl *usersImpl) warn(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	var body struct {
+		Reason    string `json:"reason"`
+		MessageId string `json:"message_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		views.RenderErrorResponse(w, r, session.BadRequestError(r.Context()))
+	} else if warning, err := middlewares.CurrentUser(r).CreateWarning(r.Context(), params["id"], body.Reason, body.MessageId); err != nil {
+		views.RenderErrorResponse(w, r, err)
+	} else if warning == nil {
+		views.RenderErrorResponse(w, r, session.NotFoundError(r.Context()))
 	} else {
 		views.RenderBlankResponse(w, r)
 	}
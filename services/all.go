@@ -18,11 +18,28 @@ func (service *ServiceAll) Run(db *durable.Database) {
 	log.Println("running all service")
 	ctx := session.WithDatabase(context.Background(), db)
 	ctx = session.WithLogger(ctx, durable.BuildLogger())
+	go loopSettings(ctx)
 	go distribute(ctx)
 	go loopInactiveUsers(ctx)
 	go loopPendingMessages(ctx)
 	go handlePendingParticipants(ctx)
 	go handleExpiredPackets(ctx)
 	go handlePendingRewards(ctx)
+	go handlePendingRefunds(ctx)
+	go handlePendingReferrals(ctx)
 	go loopPendingSuccessMessages(ctx)
+	go loopExpiredFingerprints(ctx)
+	go loopInspectingMessages(ctx)
+	go loopAttachmentInspections(ctx)
+	go loopExpiredAttachmentInspections(ctx)
+	go loopExpiredMutes(ctx)
+	go loopExpiredWarnings(ctx)
+	go loopExpiredRateLimits(ctx)
+	go loopExpiredBlacklists(ctx)
+	go loopExpiredMemberships(ctx)
+	go loopAssetPrices(ctx)
+	go loopExpiredPaymentQuotes(ctx)
+	go loopExpiredPaymentIntents(ctx)
+	go loopExpiredGifts(ctx)
+	go loopReconciliation(ctx)
 }
@@ -17,7 +17,7 @@ func ConnectMixinBlaze(clientId, sessionId, sessionKey string) (*websocket.Conn,
 	}
 	header := make(http.Header)
 	header.Add("Authorization", "Bearer "+token)
-	cfg := config.AppConfig
+	cfg := config.AppConfig()
 	host := cfg.Service.BlazeRoot[0]
 	u := url.URL{Scheme: "wss", Host: host, Path: "/"}
 	dialer := &websocket.Dialer{
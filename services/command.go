@@ -0,0 +1,204 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	bot "github.com/MixinNetwork/bot-api-go-client/v2"
+	"github.com/MixinNetwork/supergroup.mixin.one/models"
+)
+
+// Command runs once from the CLI as the operator, for incident response when
+// the web client is down, e.g. ./supergroup.mixin.one -service ban <user-id>
+type Command func(ctx context.Context, operator *models.User, args []string) error
+
+func (hub *Hub) registerCommands() {
+	hub.commands["ban"] = commandBan
+	hub.commands["unban"] = commandUnban
+	hub.commands["kick"] = commandKick
+	hub.commands["grant-membership"] = commandGrantMembership
+	hub.commands["broadcast"] = commandBroadcast
+	hub.commands["recall"] = commandRecall
+	hub.commands["export-members"] = commandExportMembers
+	hub.commands["replay-dead-letters"] = commandReplayDeadLetters
+}
+
+// ban <user-id> [duration] [reason...], a missing or zero duration bans forever
+func commandBan(ctx context.Context, operator *models.User, args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("usage: ban <user-id> [duration] [reason]")
+	}
+	var duration time.Duration
+	if len(args) > 1 {
+		d, err := models.ParseDuration(args[1])
+		if err != nil {
+			return err
+		}
+		duration = d
+	}
+	var reason string
+	if len(args) > 2 {
+		reason = strings.Join(args[2:], " ")
+	}
+	b, err := operator.CreateBlacklist(ctx, args[0], reason, "", duration)
+	if err != nil {
+		return err
+	}
+	if b == nil {
+		return fmt.Errorf("user %s not found or protected", args[0])
+	}
+	fmt.Printf("banned %s %s\n", b.UserId, b.FullName)
+	return nil
+}
+
+// unban <user-id>
+func commandUnban(ctx context.Context, operator *models.User, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: unban <user-id>")
+	}
+	b, err := operator.DeleteBlacklist(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	if b == nil {
+		return fmt.Errorf("user %s not banned", args[0])
+	}
+	fmt.Printf("unbanned %s %s\n", b.UserId, b.FullName)
+	return nil
+}
+
+// kick <user-id>
+func commandKick(ctx context.Context, operator *models.User, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: kick <user-id>")
+	}
+	user, err := models.FindUser(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return fmt.Errorf("user %s not found", args[0])
+	}
+	err = operator.DeleteUser(ctx, user.UserId)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("kicked %s %s\n", user.UserId, user.FullName)
+	return nil
+}
+
+// grant-membership <user-id>, the user has to authorize the bot first
+func commandGrantMembership(ctx context.Context, operator *models.User, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: grant-membership <user-id>")
+	}
+	user, err := operator.GrantMembership(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return fmt.Errorf("user %s not found", args[0])
+	}
+	if user.State != models.PaymentStatePaid {
+		return fmt.Errorf("user %s is %s, maybe banned", user.UserId, user.State)
+	}
+	fmt.Printf("granted %s %s\n", user.UserId, user.FullName)
+	return nil
+}
+
+// broadcast <file>, the file content is sent as a text message from the bot
+func commandBroadcast(ctx context.Context, operator *models.User, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: broadcast <file>")
+	}
+	data, err := os.ReadFile(args[0])
+	if err != nil {
+		return err
+	}
+	err = operator.CreateBroadcastMessage(ctx, string(data))
+	if err != nil {
+		return err
+	}
+	fmt.Printf("broadcasted %d bytes\n", len(data))
+	return nil
+}
+
+// recall <message-id>, the id of the original message in the group
+func commandRecall(ctx context.Context, operator *models.User, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: recall <message-id>")
+	}
+	if !operator.Can(ctx, models.PermissionRecall) {
+		return fmt.Errorf("operator %s can't recall messages", operator.UserId)
+	}
+	data, err := json.Marshal(models.RecallMessage{MessageId: args[0]})
+	if err != nil {
+		return err
+	}
+	t := time.Now()
+	message, err := models.CreateMessage(ctx, operator, bot.UuidNewV4().String(), models.MessageCategoryMessageRecall, "", base64.RawURLEncoding.EncodeToString(data), false, t, t)
+	if err != nil {
+		return err
+	}
+	if message == nil {
+		return fmt.Errorf("message %s not found", args[0])
+	}
+	fmt.Printf("recalled %s\n", args[0])
+	return nil
+}
+
+// export-members [file], CSV to the file or stdout
+func commandExportMembers(ctx context.Context, operator *models.User, args []string) error {
+	users, err := operator.ExportMembers(ctx)
+	if err != nil {
+		return err
+	}
+	var out io.Writer = os.Stdout
+	if len(args) > 0 {
+		f, err := os.Create(args[0])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+	w := csv.NewWriter(out)
+	err = w.Write([]string{"user_id", "identity_number", "full_name", "pay_method", "subscribed_at", "active_at"})
+	if err != nil {
+		return err
+	}
+	for _, u := range users {
+		err = w.Write([]string{u.UserId, strconv.FormatInt(u.IdentityNumber, 10), u.FullName, u.PayMethod, u.SubscribedAt.Format(time.RFC3339), u.ActiveAt.Format(time.RFC3339)})
+		if err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// replay-dead-letters [duration], requeue messages stuck longer than 1h by default
+func commandReplayDeadLetters(ctx context.Context, operator *models.User, args []string) error {
+	duration := time.Hour
+	if len(args) > 0 {
+		d, err := models.ParseDuration(args[0])
+		if err != nil {
+			return err
+		}
+		duration = d
+	}
+	count, err := operator.ReplayStuckMessages(ctx, duration)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("replayed %d messages\n", count)
+	return nil
+}
@@ -18,7 +18,7 @@ import (
 
 func distribute(ctx context.Context) {
 	limit := int64(80)
-	system := config.AppConfig.System
+	system := config.AppConfig().System
 	shards := make([]string, system.MessageShardSize)
 	for i := int64(0); i < system.MessageShardSize; i++ {
 		shard := shardId(system.MessageShardModifier, i)
@@ -133,7 +133,7 @@ func sendDistributedMessges(ctx context.Context, key string, messages []*models.
 	}
 	var body []map[string]interface{}
 	for _, message := range messages {
-		if message.UserId == config.AppConfig.Mixin.ClientId {
+		if message.UserId == config.AppConfig().Mixin.ClientId {
 			message.UserId = ""
 		}
 		if message.Category == models.MessageCategoryMessageRecall {
@@ -177,7 +177,7 @@ func sendDistributedMessges(ctx context.Context, key string, messages []*models.
 	if err != nil {
 		return nil, err
 	}
-	mixin := config.AppConfig.Mixin
+	mixin := config.AppConfig().Mixin
 	accessToken, err := bot.SignAuthenticationToken(mixin.ClientId, mixin.SessionId, mixin.SessionKey, "POST", "/encrypted_messages", string(msgs))
 	if err != nil {
 		return nil, err
@@ -206,7 +206,7 @@ func request(ctx context.Context, key, method, path string, body []byte, accessT
 	if httpPool[key] == nil {
 		httpPool[key] = &http.Client{Timeout: 6 * time.Second}
 	}
-	cfg := config.AppConfig
+	cfg := config.AppConfig()
 	url := cfg.Service.APIRoot[cfg.Service.Retry%len(cfg.Service.APIRoot)]
 	req, err := http.NewRequest(method, url+path, bytes.NewReader(body))
 	if err != nil {
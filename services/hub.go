@@ -5,21 +5,42 @@ import (
 	"fmt"
 
 	"github.com/MixinNetwork/supergroup.mixin.one/durable"
+	"github.com/MixinNetwork/supergroup.mixin.one/models"
 	"github.com/MixinNetwork/supergroup.mixin.one/session"
+	"github.com/gofrs/uuid/v5"
 )
 
 type Hub struct {
 	context  context.Context
 	services map[string]Service
+	commands map[string]Command
 }
 
 func NewHub(db *durable.Database) *Hub {
-	hub := &Hub{services: make(map[string]Service)}
+	hub := &Hub{services: make(map[string]Service), commands: make(map[string]Command)}
 	hub.context = session.WithDatabase(context.Background(), db)
 	hub.registerServices()
+	hub.registerCommands()
 	return hub
 }
 
+func (hub *Hub) HasCommand(name string) bool {
+	return hub.commands[name] != nil
+}
+
+func (hub *Hub) RunCommand(name, operatorId string, args []string) error {
+	command := hub.commands[name]
+	if command == nil {
+		return fmt.Errorf("no command found: %s", name)
+	}
+	if id := uuid.FromStringOrNil(operatorId); id.String() != operatorId {
+		return fmt.Errorf("invalid operator: %s", operatorId)
+	}
+
+	ctx := session.WithLogger(hub.context, durable.BuildLogger())
+	return command(ctx, &models.User{UserId: operatorId}, args)
+}
+
 func (hub *Hub) StartService(name string) error {
 	service := hub.services[name]
 	if service == nil {
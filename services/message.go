@@ -75,6 +75,7 @@ type MessageContext struct {
 }
 
 func (service *MessageService) Run(ctx context.Context) error {
+	go loopSettings(ctx)
 	for {
 		err := service.loop(ctx)
 		if err != nil {
@@ -87,7 +88,7 @@ func (service *MessageService) Run(ctx context.Context) error {
 }
 
 func (service *MessageService) loop(ctx context.Context) error {
-	mixin := config.AppConfig.Mixin
+	mixin := config.AppConfig().Mixin
 	conn, err := ConnectMixinBlaze(mixin.ClientId, mixin.SessionId, mixin.SessionKey)
 	if err != nil {
 		return err
@@ -130,7 +131,7 @@ func (service *MessageService) loop(ctx context.Context) error {
 			return nil
 		case msg := <-mc.ReadBuffer:
 			log.Println("<-mc.ReadBuffer", time.Now())
-			if msg.ConversationId == models.UniqueConversationId(config.AppConfig.Mixin.ClientId, msg.UserId) {
+			if msg.ConversationId == models.UniqueConversationId(config.AppConfig().Mixin.ClientId, msg.UserId) {
 				switch msg.Category {
 				case "SYSTEM_SAFE_SNAPSHOT":
 					data, err := base64.RawURLEncoding.DecodeString(msg.DataBase64)
@@ -395,58 +396,184 @@ func parseMessage(ctx context.Context, mc *MessageContext, wsReader io.Reader, t
 	return nil
 }
 
+// handleTransfer records every inbound transfer in the snapshots ledger, then
+// resolves it once to a reward, a membership, a packet or a refund.
 func handleTransfer(ctx context.Context, mc *MessageContext, transfer SnapshotView, userId string) error {
 	if number.FromString(transfer.Amount).Exhausted() {
 		return nil
 	}
 	memoBuf, _ := hex.DecodeString(transfer.Memo)
 	memo := string(memoBuf)
+	ledgerMemo := memo
+	if !utf8.ValidString(memo) || strings.ContainsRune(memo, 0) {
+		ledgerMemo = transfer.Memo
+	}
+	snapshot, err := models.RecordSnapshot(ctx, transfer.SnapshotId, userId, transfer.AssetId, transfer.Amount, ledgerMemo, transfer.TransactionHash, transfer.CreatedAt)
+	if err != nil {
+		return err
+	}
+	if snapshot.Purpose != models.SnapshotPurposeUnknown {
+		return nil
+	}
+	return resolveTransfer(ctx, mc, transfer, userId, memo)
+}
+
+// resolveTransfer refunds every inbound transfer that doesn't pay a payment
+// intent, a reward, a membership, a gift or a packet, the models resolve the
+// snapshot purpose in the same transaction, so a paid packet is not refunded
+// when the app card fails and the message is handled again.
+func resolveTransfer(ctx context.Context, mc *MessageContext, transfer SnapshotView, userId, memo string) error {
+	if m := models.ParsePaymentMemo(memo); m != nil {
+		return handleIntentTransfer(ctx, mc, transfer, userId, m)
+	}
 	if len(memo) > 0 {
 		array := strings.Split(memo, ":")
 		if len(array) == 2 && array[0] == "REWARD" {
-			_, err := models.CreateReward(ctx, transfer.SnapshotId, userId, array[1], transfer.AssetId, transfer.Amount)
-			return err
+			reward, err := models.CreateReward(ctx, transfer.SnapshotId, userId, array[1], transfer.AssetId, transfer.Amount)
+			if err != nil || reward != nil {
+				return err
+			}
+			return refundTransfer(ctx, transfer, userId, models.RefundMemoRewardInvalid)
 		}
 	}
 	user, err := models.FindUser(ctx, userId)
-	if user == nil || err != nil {
+	if err != nil {
 		return err
 	}
-	if user.TraceId == memo {
-		for _, asset := range config.AppConfig.System.AccpetPaymentAssetList {
-			if number.FromString(transfer.Amount).Equal(number.FromString(asset.Amount).RoundFloor(8)) && transfer.AssetId == asset.AssetId {
-				return user.Payment(ctx)
-			}
-		}
-	} else if packet, err := models.PayPacket(ctx, memo, transfer.AssetId, transfer.Amount); err != nil || packet == nil {
+	if array := strings.Split(memo, ":"); len(array) == 2 && array[0] == "GIFT" {
+		return handleGiftTransfer(ctx, transfer, user, userId, array[1])
+	}
+	if user != nil && user.TraceId == memo {
+		return handleMembershipTransfer(ctx, transfer, user)
+	}
+	packet, err := models.PayPacket(ctx, transfer.SnapshotId, memo, transfer.AssetId, transfer.Amount)
+	if err != nil {
 		return err
-	} else if packet.State == models.PacketStatePaid {
+	}
+	if packet != nil {
 		return sendAppCard(ctx, mc, packet)
 	}
+	if p, err := models.ReadPacket(ctx, memo); err != nil {
+		return err
+	} else if p != nil {
+		return refundTransfer(ctx, transfer, userId, models.RefundMemoPacketNotReady)
+	}
+	return refundTransfer(ctx, transfer, userId, models.RefundMemoUnrecognised)
+}
+
+func handleIntentTransfer(ctx context.Context, mc *MessageContext, transfer SnapshotView, userId string, m *models.PaymentMemo) error {
+	user, err := models.FindUser(ctx, userId)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return refundTransfer(ctx, transfer, userId, models.RefundMemoIntentInvalid)
+	}
+	intent, refund, err := user.PayPaymentIntent(ctx, m, transfer.SnapshotId, transfer.AssetId, transfer.Amount, transfer.CreatedAt)
+	if err != nil {
+		return err
+	}
+	if intent == nil {
+		return refundTransfer(ctx, transfer, userId, refund)
+	}
+	if intent.Action == models.PaymentIntentActionPacket {
+		return sendAppCard(ctx, mc, intent.Packet)
+	}
 	return nil
 }
 
+// handleGiftTransfer pays the plan priced at the transfer for the target of a
+// GIFT:<user id or identity number> memo, the sender has to be a user.
+func handleGiftTransfer(ctx context.Context, transfer SnapshotView, user *models.User, userId, target string) error {
+	if user == nil {
+		return refundTransfer(ctx, transfer, userId, models.RefundMemoNotAccepted)
+	}
+	gift, refund, err := user.PayGift(ctx, transfer.SnapshotId, target, transfer.AssetId, transfer.Amount)
+	if err != nil || gift != nil {
+		return err
+	}
+	return refundTransfer(ctx, transfer, userId, refund)
+}
+
+func handleMembershipTransfer(ctx context.Context, transfer SnapshotView, user *models.User) error {
+	if user.State == models.PaymentStatePaid && user.PaidUntil.IsZero() {
+		return refundTransfer(ctx, transfer, user.UserId, models.RefundMemoAlreadyPaid)
+	}
+	if plan := models.MatchMembershipPlan(transfer.AssetId, transfer.Amount); plan != nil {
+		paid, err := user.PayMembership(ctx, transfer.SnapshotId, plan, transfer.AssetId, transfer.Amount)
+		if err != nil || paid {
+			return err
+		}
+		return refundTransfer(ctx, transfer, user.UserId, models.RefundMemoNotAccepted)
+	}
+	quote, err := user.PayPaymentQuote(ctx, transfer.SnapshotId, transfer.AssetId, transfer.Amount, transfer.CreatedAt)
+	if err != nil || quote != nil {
+		return err
+	}
+	return refundTransfer(ctx, transfer, user.UserId, models.RefundMemoMismatched)
+}
+
+func refundTransfer(ctx context.Context, transfer SnapshotView, userId, memo string) error {
+	_, err := models.CreateRefund(ctx, transfer.SnapshotId, userId, transfer.AssetId, transfer.Amount, memo)
+	return err
+}
+
+// reconcileSnapshot handles an inbound snapshot missed by the Blaze stream the
+// same way, and checks an outbound one against the expected payouts.
+func reconcileSnapshot(ctx context.Context, s *bot.SafeSnapshot) error {
+	if number.FromString(s.Amount).Cmp(number.Zero()) < 0 {
+		return models.ReconcilePayout(ctx, s)
+	}
+	if s.OpponentID == "" {
+		return nil
+	}
+	recorded, err := models.FindSnapshot(ctx, s.SnapshotID)
+	if err != nil || recorded != nil {
+		return err
+	}
+	transfer := SnapshotView{
+		Type:            s.Type,
+		SnapshotId:      s.SnapshotID,
+		UserId:          s.UserID,
+		OpponentId:      s.OpponentID,
+		TransactionHash: s.TransactionHash,
+		AssetId:         s.AssetID,
+		Amount:          s.Amount,
+		Memo:            s.Memo,
+		CreatedAt:       s.CreatedAt,
+	}
+	err = handleTransfer(ctx, nil, transfer, s.OpponentID)
+	if err != nil {
+		return err
+	}
+	recorded, err = models.FindSnapshot(ctx, s.SnapshotID)
+	if err != nil || recorded == nil {
+		return err
+	}
+	return models.ReportDiscrepancy(ctx, models.DiscrepancyMissedReceipt, s.SnapshotID, s.OpponentID, s.AssetID, s.Amount, "backfilled as "+recorded.Purpose)
+}
+
 func sendAppCard(ctx context.Context, mc *MessageContext, packet *models.Packet) error {
-	description := fmt.Sprintf(config.AppConfig.MessageTemplate.GroupRedPacketDesc, packet.User.FullName)
+	description := fmt.Sprintf(config.AppConfig().MessageTemplate.GroupRedPacketDesc, packet.User.FullName)
 	if strings.TrimSpace(packet.User.FullName) == "" {
-		description = config.AppConfig.MessageTemplate.GroupRedPacketShortDesc
+		description = config.AppConfig().MessageTemplate.GroupRedPacketShortDesc
 	}
 	if count := utf8.RuneCountInString(description); count > 100 {
 		name := string([]rune(packet.User.FullName)[:16])
-		description = fmt.Sprintf(config.AppConfig.MessageTemplate.GroupRedPacketDesc, name)
+		description = fmt.Sprintf(config.AppConfig().MessageTemplate.GroupRedPacketDesc, name)
 	}
 	card, err := json.Marshal(map[string]string{
-		"app_id":      config.AppConfig.Mixin.ClientId,
+		"app_id":      config.AppConfig().Mixin.ClientId,
 		"icon_url":    "https://images.mixin.one/X44V48LK9oEBT3izRGKqdVSPfiH5DtYTzzF0ch5nP-f7tO4v0BTTqVhFEHqd52qUeuVas-BSkLH1ckxEI51-jXmF=s256",
-		"title":       config.AppConfig.MessageTemplate.GroupRedPacket,
+		"title":       config.AppConfig().MessageTemplate.GroupRedPacket,
 		"description": description,
-		"action":      config.AppConfig.Service.HTTPResourceHost + "/packets/" + packet.PacketId,
+		"action":      config.AppConfig().Service.HTTPResourceHost + "/packets/" + packet.PacketId,
 	})
 	if err != nil {
 		return session.BlazeServerError(ctx, err)
 	}
 	t := time.Now()
-	u := &models.User{UserId: config.AppConfig.Mixin.ClientId, ActiveAt: time.Now()}
+	u := &models.User{UserId: config.AppConfig().Mixin.ClientId, ActiveAt: time.Now()}
 	_, err = models.CreateMessage(ctx, u, packet.PacketId, models.MessageCategoryAppCard, "", base64.RawURLEncoding.EncodeToString(card), false, t, t)
 	if err != nil {
 		return session.BlazeServerError(ctx, err)
@@ -507,6 +634,58 @@ func handlePendingRewards(ctx context.Context) {
 	}
 }
 
+func handlePendingRefunds(ctx context.Context) {
+	var limit = 20
+	for {
+		refunds, err := models.PendingRefunds(ctx, limit)
+		if err != nil {
+			session.Logger(ctx).Error(err)
+			time.Sleep(300 * time.Millisecond)
+			continue
+		}
+
+		for _, r := range refunds {
+			err = models.SendRefundTransfer(ctx, r)
+			if err != nil {
+				session.Logger(ctx).Error(r.SnapshotId, err)
+				continue
+			}
+			session.Logger(ctx).Infof("REFUND %s %s %s %s", r.SnapshotId, r.UserId, r.Amount, r.Memo)
+		}
+
+		if len(refunds) < limit {
+			time.Sleep(10 * time.Second)
+			continue
+		}
+	}
+}
+
+func handlePendingReferrals(ctx context.Context) {
+	var limit = 20
+	for {
+		referrals, err := models.PendingReferrals(ctx, limit)
+		if err != nil {
+			session.Logger(ctx).Error(err)
+			time.Sleep(300 * time.Millisecond)
+			continue
+		}
+
+		for _, r := range referrals {
+			err = models.SendReferralTransfer(ctx, r)
+			if err != nil {
+				session.Logger(ctx).Error(r.UserId, err)
+				continue
+			}
+			session.Logger(ctx).Infof("REFERRAL %s %s %s %s", r.UserId, r.ReferrerId, r.AssetId, r.Amount)
+		}
+
+		if len(referrals) < limit {
+			time.Sleep(10 * time.Second)
+			continue
+		}
+	}
+}
+
 func handlePendingParticipants(ctx context.Context) {
 	var limit = 100
 	for {
@@ -547,18 +726,24 @@ func handleMessage(ctx context.Context, mc *MessageContext, message *MessageView
 		}
 	}
 	if user.SubscribedAt.IsZero() {
-		return sendTextMessage(ctx, mc, message.ConversationId, config.AppConfig.MessageTemplate.MessageTipsUnsubscribe, timer, drained)
+		return sendTextMessage(ctx, mc, message.ConversationId, config.AppConfig().MessageTemplate.MessageTipsUnsubscribe, timer, drained)
 	}
 
 	_, err = models.CreateMessage(ctx, user, message.MessageId, message.Category, message.QuoteMessageId, message.DataBase64, message.Silent, message.CreatedAt, message.UpdatedAt)
 	return err
 }
 
+// sendHelpMessge tells a guest how to join, a trial user only receives
+// messages and is told when the trial ends instead.
 func sendHelpMessge(ctx context.Context, user *models.User, mc *MessageContext, message *MessageView, timer *time.Timer, drained *bool) error {
-	if err := sendTextMessage(ctx, mc, message.ConversationId, config.AppConfig.MessageTemplate.MessageTipsHelp, timer, drained); err != nil {
+	tips := config.AppConfig().MessageTemplate.MessageTipsHelp
+	if user != nil && user.State == models.PaymentStateTrial {
+		tips = fmt.Sprintf(config.AppConfig().MessageTemplate.MessageTipsTrial, user.PaidUntil.Format("2006-01-02 15:04"))
+	}
+	if err := sendTextMessage(ctx, mc, message.ConversationId, tips, timer, drained); err != nil {
 		return err
 	}
-	return sendAppButton(ctx, mc, config.AppConfig.MessageTemplate.MessageTipsHelpBtn, message.ConversationId, config.AppConfig.Service.HTTPResourceHost, timer, drained)
+	return sendAppButton(ctx, mc, config.AppConfig().MessageTemplate.MessageTipsHelpBtn, message.ConversationId, config.AppConfig().Service.HTTPResourceHost, timer, drained)
 }
 
 type tmap struct {
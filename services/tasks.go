@@ -9,6 +9,7 @@ import (
 	"time"
 
 	bot "github.com/MixinNetwork/bot-api-go-client/v2"
+	"github.com/MixinNetwork/supergroup.mixin.one/config"
 	"github.com/MixinNetwork/supergroup.mixin.one/models"
 	"github.com/MixinNetwork/supergroup.mixin.one/session"
 	"github.com/gofrs/uuid"
@@ -36,6 +37,80 @@ func loopPendingMessages(ctx context.Context) {
 	}
 }
 
+func loopInspectingMessages(ctx context.Context) {
+	limit := 5
+	for {
+		messages, err := models.InspectingMessages(ctx, int64(limit))
+		if err != nil {
+			time.Sleep(500 * time.Millisecond)
+			session.Logger(ctx).Errorf("InspectingMessages ERROR: %+v", err)
+			continue
+		}
+		for _, message := range messages {
+			if err := message.Distribute(ctx); err != nil {
+				time.Sleep(500 * time.Millisecond)
+				session.Logger(ctx).Errorf("InspectingMessages ERROR: %+v", err)
+				continue
+			}
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+}
+
+// loopAttachmentInspections feeds pending inspections to a pool of workers,
+// so one slow download doesn't hold up the others.
+func loopAttachmentInspections(ctx context.Context) {
+	workers := config.AppConfig().System.AttachmentWorkers
+	if workers < 1 {
+		workers = 1
+	}
+	jobs := make(chan *models.AttachmentInspection)
+	done := make(chan string)
+	for i := 0; i < workers; i++ {
+		go func() {
+			for inspection := range jobs {
+				if err := inspection.Inspect(ctx); err != nil {
+					session.Logger(ctx).Errorf("AttachmentInspection ERROR: %+v", err)
+				}
+				done <- inspection.AttachmentId
+			}
+		}()
+	}
+
+	running := make(map[string]bool)
+	for {
+		inspections, err := models.PendingAttachmentInspections(ctx, int64(workers*4))
+		if err != nil {
+			time.Sleep(500 * time.Millisecond)
+			session.Logger(ctx).Errorf("PendingAttachmentInspections ERROR: %+v", err)
+			continue
+		}
+		for _, inspection := range inspections {
+			if running[inspection.AttachmentId] {
+				continue
+			}
+			for dispatched := false; !dispatched; {
+				select {
+				case jobs <- inspection:
+					running[inspection.AttachmentId] = true
+					dispatched = true
+				case id := <-done:
+					delete(running, id)
+				}
+			}
+		}
+		timer := time.NewTimer(500 * time.Millisecond)
+		for waiting := true; waiting; {
+			select {
+			case id := <-done:
+				delete(running, id)
+			case <-timer.C:
+				waiting = false
+			}
+		}
+	}
+}
+
 func loopPendingSuccessMessages(ctx context.Context) {
 	for {
 		count, err := models.LoopClearUpSuccessMessages(ctx)
@@ -50,6 +125,204 @@ func loopPendingSuccessMessages(ctx context.Context) {
 	}
 }
 
+func loopExpiredFingerprints(ctx context.Context) {
+	for {
+		count, err := models.LoopClearUpExpiredFingerprints(ctx)
+		if err != nil {
+			time.Sleep(500 * time.Millisecond)
+			session.Logger(ctx).Errorf("LoopClearUpExpiredFingerprints ERROR: %+v", err)
+			continue
+		}
+		if count < 100 {
+			time.Sleep(10 * time.Minute)
+		}
+	}
+}
+
+func loopExpiredAttachmentInspections(ctx context.Context) {
+	for {
+		count, err := models.LoopClearUpExpiredAttachmentInspections(ctx)
+		if err != nil {
+			time.Sleep(500 * time.Millisecond)
+			session.Logger(ctx).Errorf("LoopClearUpExpiredAttachmentInspections ERROR: %+v", err)
+			continue
+		}
+		if count < 100 {
+			time.Sleep(10 * time.Minute)
+		}
+	}
+}
+
+func loopExpiredMutes(ctx context.Context) {
+	for {
+		count, err := models.LoopClearUpExpiredMutes(ctx)
+		if err != nil {
+			time.Sleep(500 * time.Millisecond)
+			session.Logger(ctx).Errorf("LoopClearUpExpiredMutes ERROR: %+v", err)
+			continue
+		}
+		if count < 100 {
+			time.Sleep(10 * time.Minute)
+		}
+	}
+}
+
+func loopExpiredWarnings(ctx context.Context) {
+	for {
+		count, err := models.LoopClearUpExpiredWarnings(ctx)
+		if err != nil {
+			time.Sleep(500 * time.Millisecond)
+			session.Logger(ctx).Errorf("LoopClearUpExpiredWarnings ERROR: %+v", err)
+			continue
+		}
+		if count < 100 {
+			time.Sleep(10 * time.Minute)
+		}
+	}
+}
+
+func loopExpiredRateLimits(ctx context.Context) {
+	for {
+		count, err := models.LoopClearUpExpiredRateLimits(ctx)
+		if err != nil {
+			time.Sleep(500 * time.Millisecond)
+			session.Logger(ctx).Errorf("LoopClearUpExpiredRateLimits ERROR: %+v", err)
+			continue
+		}
+		if count < 100 {
+			time.Sleep(10 * time.Minute)
+		}
+	}
+}
+
+func loopSettings(ctx context.Context) {
+	for {
+		err := models.LoadSettings(ctx)
+		if err != nil {
+			session.Logger(ctx).Errorf("LoadSettings ERROR: %+v", err)
+		}
+		time.Sleep(10 * time.Second)
+	}
+}
+
+func loopExpiredBlacklists(ctx context.Context) {
+	for {
+		count, err := models.LoopClearUpExpiredBlacklists(ctx)
+		if err != nil {
+			time.Sleep(500 * time.Millisecond)
+			session.Logger(ctx).Errorf("LoopClearUpExpiredBlacklists ERROR: %+v", err)
+			continue
+		}
+		if count < 100 {
+			time.Sleep(10 * time.Minute)
+		}
+	}
+}
+
+func loopExpiredMemberships(ctx context.Context) {
+	for {
+		reminded, err := models.LoopMembershipReminders(ctx)
+		if err != nil {
+			time.Sleep(500 * time.Millisecond)
+			session.Logger(ctx).Errorf("LoopMembershipReminders ERROR: %+v", err)
+			continue
+		}
+		expired, err := models.LoopExpiredMemberships(ctx)
+		if err != nil {
+			time.Sleep(500 * time.Millisecond)
+			session.Logger(ctx).Errorf("LoopExpiredMemberships ERROR: %+v", err)
+			continue
+		}
+		if reminded < 100 && expired < 100 {
+			time.Sleep(time.Minute)
+		}
+	}
+}
+
+func loopAssetPrices(ctx context.Context) {
+	for {
+		_, err := models.RefreshAssetPrices(ctx)
+		if err != nil {
+			session.Logger(ctx).Errorf("RefreshAssetPrices ERROR: %+v", err)
+		}
+		time.Sleep(time.Minute)
+	}
+}
+
+func loopExpiredPaymentQuotes(ctx context.Context) {
+	for {
+		count, err := models.LoopClearUpExpiredPaymentQuotes(ctx)
+		if err != nil {
+			time.Sleep(500 * time.Millisecond)
+			session.Logger(ctx).Errorf("LoopClearUpExpiredPaymentQuotes ERROR: %+v", err)
+			continue
+		}
+		if count < 100 {
+			time.Sleep(10 * time.Minute)
+		}
+	}
+}
+
+func loopExpiredPaymentIntents(ctx context.Context) {
+	for {
+		count, err := models.LoopClearUpExpiredPaymentIntents(ctx)
+		if err != nil {
+			time.Sleep(500 * time.Millisecond)
+			session.Logger(ctx).Errorf("LoopClearUpExpiredPaymentIntents ERROR: %+v", err)
+			continue
+		}
+		if count < 100 {
+			time.Sleep(10 * time.Minute)
+		}
+	}
+}
+
+func loopExpiredGifts(ctx context.Context) {
+	for {
+		count, err := models.LoopExpiredGifts(ctx)
+		if err != nil {
+			time.Sleep(500 * time.Millisecond)
+			session.Logger(ctx).Errorf("LoopExpiredGifts ERROR: %+v", err)
+			continue
+		}
+		if count < 100 {
+			time.Sleep(10 * time.Minute)
+		}
+	}
+}
+
+func loopReconciliation(ctx context.Context) {
+	limit := 100
+	for {
+		snapshots, until, err := models.ReadWalletSnapshots(ctx, limit)
+		if err != nil {
+			time.Sleep(time.Second)
+			session.Logger(ctx).Errorf("ReadWalletSnapshots ERROR: %+v", err)
+			continue
+		}
+		for _, s := range snapshots {
+			err = reconcileSnapshot(ctx, s)
+			if err != nil {
+				break
+			}
+		}
+		if err != nil {
+			time.Sleep(time.Second)
+			session.Logger(ctx).Errorf("reconcileSnapshot ERROR: %+v", err)
+			continue
+		}
+		_, err = models.AdvanceReconciliation(ctx, until)
+		if err != nil {
+			time.Sleep(time.Second)
+			session.Logger(ctx).Errorf("AdvanceReconciliation ERROR: %+v", err)
+			continue
+		}
+		if len(snapshots) < limit {
+			time.Sleep(time.Minute)
+		}
+	}
+}
+
 func sendTextMessage(ctx context.Context, mc *MessageContext, conversationId, label string, timer *time.Timer, drained *bool) error {
 	params := map[string]interface{}{
 		"conversation_id": conversationId,
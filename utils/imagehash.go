@@ -0,0 +1,64 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"math/bits"
+)
+
+const (
+	hashWidth  = 9
+	hashHeight = 8
+)
+
+// DifferenceHash computes the 64 bits dHash of an image, which stays stable when
+// the image is resized, recompressed or slightly edited.
+func DifferenceHash(data []byte) (uint64, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return 0, err
+	}
+	b := img.Bounds()
+	if b.Dx() < hashWidth || b.Dy() < hashHeight {
+		return 0, fmt.Errorf("image too small %dx%d", b.Dx(), b.Dy())
+	}
+
+	var pixels [hashHeight][hashWidth]float64
+	for y := 0; y < hashHeight; y++ {
+		y0, y1 := b.Min.Y+y*b.Dy()/hashHeight, b.Min.Y+(y+1)*b.Dy()/hashHeight
+		sy := (y1-y0)/16 + 1
+		for x := 0; x < hashWidth; x++ {
+			x0, x1 := b.Min.X+x*b.Dx()/hashWidth, b.Min.X+(x+1)*b.Dx()/hashWidth
+			sx := (x1-x0)/16 + 1
+			var sum float64
+			var count int
+			for py := y0; py < y1; py += sy {
+				for px := x0; px < x1; px += sx {
+					r, g, b, _ := img.At(px, py).RGBA()
+					sum += 0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)
+					count++
+				}
+			}
+			pixels[y][x] = sum / float64(count)
+		}
+	}
+
+	var hash uint64
+	for y := 0; y < hashHeight; y++ {
+		for x := 0; x < hashWidth-1; x++ {
+			hash <<= 1
+			if pixels[y][x] < pixels[y][x+1] {
+				hash |= 1
+			}
+		}
+	}
+	return hash, nil
+}
+
+func HammingDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
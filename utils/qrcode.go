@@ -3,11 +3,24 @@ package utils
 import (
 	"bytes"
 	"context"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
 
 	"github.com/MixinNetwork/supergroup.mixin.one/session"
 	"github.com/tuotoo/qrcode"
+	"rsc.io/qr"
 )
 
+const (
+	posterScale   = 8
+	posterPadding = 48
+	posterHeader  = 96
+)
+
+var posterColor = color.RGBA{0x46, 0xb8, 0xda, 0xff}
+
 func CheckQRCode(ctx context.Context, data []byte) (bool, error) {
 	qrmatrix, err := qrcode.Decode(bytes.NewReader(data))
 	if err != nil {
@@ -20,3 +33,26 @@ func CheckQRCode(ctx context.Context, data []byte) (bool, error) {
 	}
 	return false, nil
 }
+
+// EncodeQRCodePoster draws the QR code of the content below a colored header
+// and returns the PNG.
+func EncodeQRCodePoster(content string) ([]byte, error) {
+	code, err := qr.Encode(content, qr.M)
+	if err != nil {
+		return nil, err
+	}
+	code.Scale = posterScale
+	img := code.Image()
+	b := img.Bounds()
+	poster := image.NewRGBA(image.Rect(0, 0, b.Dx()+2*posterPadding, b.Dy()+posterHeader+2*posterPadding))
+	draw.Draw(poster, poster.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(poster, image.Rect(0, 0, poster.Bounds().Dx(), posterHeader), &image.Uniform{posterColor}, image.Point{}, draw.Src)
+	draw.Draw(poster, b.Sub(b.Min).Add(image.Pt(posterPadding, posterHeader+posterPadding)), img, b.Min, draw.Src)
+
+	var buf bytes.Buffer
+	err = png.Encode(&buf, poster)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,39 @@
+package views
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/MixinNetwork/supergroup.mixin.one/models"
+)
+
+type AuditEventView struct {
+	Type         string          `json:"type"`
+	AuditEventId string          `json:"audit_event_id"`
+	ActorId      string          `json:"actor_id"`
+	Action       string          `json:"action"`
+	TargetId     string          `json:"target_id"`
+	Reason       string          `json:"reason"`
+	Before       json.RawMessage `json:"before"`
+	After        json.RawMessage `json:"after"`
+	CreatedAt    time.Time       `json:"created_at"`
+}
+
+func RenderAuditEvents(w http.ResponseWriter, r *http.Request, events []*models.AuditEvent) {
+	views := make([]AuditEventView, len(events))
+	for i, e := range events {
+		views[i] = AuditEventView{
+			Type:         "audit_event",
+			AuditEventId: e.AuditEventId,
+			ActorId:      e.ActorId,
+			Action:       e.Action,
+			TargetId:     e.TargetId,
+			Reason:       e.Reason,
+			Before:       json.RawMessage(e.Before),
+			After:        json.RawMessage(e.After),
+			CreatedAt:    e.CreatedAt,
+		}
+	}
+	RenderDataResponse(w, r, views)
+}
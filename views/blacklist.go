@@ -0,0 +1,45 @@
+package views
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/MixinNetwork/supergroup.mixin.one/models"
+)
+
+type BlacklistView struct {
+	Type           string     `json:"type"`
+	UserId         string     `json:"user_id"`
+	IdentityNumber int64      `json:"identity_number,string"`
+	FullName       string     `json:"full_name"`
+	OperatorId     string     `json:"operator_id"`
+	Reason         string     `json:"reason"`
+	MessageId      string     `json:"message_id"`
+	ExpiredAt      *time.Time `json:"expired_at"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+func buildBlacklistView(b *models.Blacklist) BlacklistView {
+	view := BlacklistView{
+		Type:           "blacklist",
+		UserId:         b.UserId,
+		IdentityNumber: b.IdentityNumber,
+		FullName:       b.FullName,
+		OperatorId:     b.OperatorId,
+		Reason:         b.Reason,
+		MessageId:      b.MessageId,
+		CreatedAt:      b.CreatedAt,
+	}
+	if b.ExpiredAt.Valid {
+		view.ExpiredAt = &b.ExpiredAt.Time
+	}
+	return view
+}
+
+func RenderBlacklists(w http.ResponseWriter, r *http.Request, blacklists []*models.Blacklist) {
+	views := make([]BlacklistView, len(blacklists))
+	for i, b := range blacklists {
+		views[i] = buildBlacklistView(b)
+	}
+	RenderDataResponse(w, r, views)
+}
@@ -0,0 +1,52 @@
+package views
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/MixinNetwork/supergroup.mixin.one/models"
+)
+
+type InvitationView struct {
+	Type      string    `json:"type"`
+	Code      string    `json:"code"`
+	UserId    string    `json:"user_id"`
+	URL       string    `json:"url"`
+	Plan      string    `json:"plan"`
+	Discount  string    `json:"discount"`
+	MaxUses   int64     `json:"max_uses"`
+	Uses      int64     `json:"uses"`
+	Joined    int64     `json:"joined"`
+	Paid      int64     `json:"paid"`
+	ExpiredAt time.Time `json:"expired_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func buildInvitationView(i *models.Invitation) InvitationView {
+	return InvitationView{
+		Type:      "invitation",
+		Code:      i.Code,
+		UserId:    i.UserId,
+		URL:       i.URL(),
+		Plan:      i.Plan,
+		Discount:  i.Discount,
+		MaxUses:   i.MaxUses,
+		Uses:      i.Uses,
+		Joined:    i.Joined,
+		Paid:      i.Paid,
+		ExpiredAt: i.ExpiredAt,
+		CreatedAt: i.CreatedAt,
+	}
+}
+
+func RenderInvitation(w http.ResponseWriter, r *http.Request, invitation *models.Invitation) {
+	RenderDataResponse(w, r, buildInvitationView(invitation))
+}
+
+func RenderInvitations(w http.ResponseWriter, r *http.Request, invitations []*models.Invitation) {
+	views := make([]InvitationView, len(invitations))
+	for i, invitation := range invitations {
+		views[i] = buildInvitationView(invitation)
+	}
+	RenderDataResponse(w, r, views)
+}
@@ -0,0 +1,38 @@
+package views
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/MixinNetwork/supergroup.mixin.one/models"
+)
+
+type PaymentIntentView struct {
+	Type      string    `json:"type"`
+	IntentId  string    `json:"intent_id"`
+	Action    string    `json:"action"`
+	Target    string    `json:"target"`
+	Plan      string    `json:"plan"`
+	AssetId   string    `json:"asset_id"`
+	Amount    string    `json:"amount"`
+	Memo      string    `json:"memo"`
+	State     string    `json:"state"`
+	ExpiredAt time.Time `json:"expired_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func RenderPaymentIntent(w http.ResponseWriter, r *http.Request, intent *models.PaymentIntent) {
+	RenderDataResponse(w, r, PaymentIntentView{
+		Type:      "payment_intent",
+		IntentId:  intent.IntentId,
+		Action:    intent.Action,
+		Target:    intent.Target,
+		Plan:      intent.Plan,
+		AssetId:   intent.AssetId,
+		Amount:    intent.Amount,
+		Memo:      intent.Memo(),
+		State:     intent.State,
+		ExpiredAt: intent.ExpiredAt,
+		CreatedAt: intent.CreatedAt,
+	})
+}
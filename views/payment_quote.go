@@ -0,0 +1,34 @@
+package views
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/MixinNetwork/supergroup.mixin.one/models"
+)
+
+type PaymentQuoteView struct {
+	Type      string    `json:"type"`
+	QuoteId   string    `json:"quote_id"`
+	Plan      string    `json:"plan"`
+	Asset     AssetView `json:"asset"`
+	Amount    string    `json:"amount"`
+	AmountUSD string    `json:"amount_usd"`
+	PriceUSD  string    `json:"price_usd"`
+	State     string    `json:"state"`
+	ExpiredAt time.Time `json:"expired_at"`
+}
+
+func RenderPaymentQuote(w http.ResponseWriter, r *http.Request, quote *models.PaymentQuote, asset *models.Asset) {
+	RenderDataResponse(w, r, PaymentQuoteView{
+		Type:      "payment_quote",
+		QuoteId:   quote.QuoteId,
+		Plan:      quote.Plan,
+		Asset:     buildAssetView(asset),
+		Amount:    quote.Amount,
+		AmountUSD: quote.AmountUSD,
+		PriceUSD:  quote.PriceUSD,
+		State:     quote.State,
+		ExpiredAt: quote.ExpiredAt,
+	})
+}
@@ -0,0 +1,45 @@
+package views
+
+import (
+	"net/http"
+
+	"github.com/MixinNetwork/supergroup.mixin.one/models"
+)
+
+type ReferralEarningView struct {
+	AssetId   string `json:"asset_id"`
+	Symbol    string `json:"symbol"`
+	Referrals int64  `json:"referrals"`
+	Amount    string `json:"amount"`
+}
+
+type ReferrerView struct {
+	UserView
+	Referrals int64                 `json:"referrals"`
+	Earnings  []ReferralEarningView `json:"earnings"`
+}
+
+func buildReferralEarningViews(earnings []*models.ReferralEarning) []ReferralEarningView {
+	views := make([]ReferralEarningView, len(earnings))
+	for i, e := range earnings {
+		views[i] = ReferralEarningView{
+			AssetId:   e.AssetId,
+			Symbol:    e.Symbol,
+			Referrals: e.Referrals,
+			Amount:    e.Amount,
+		}
+	}
+	return views
+}
+
+func RenderReferrers(w http.ResponseWriter, r *http.Request, referrers []*models.Referrer) {
+	views := make([]ReferrerView, len(referrers))
+	for i, referrer := range referrers {
+		views[i] = ReferrerView{
+			UserView:  buildUserView(referrer.User),
+			Referrals: referrer.Referrals,
+			Earnings:  buildReferralEarningViews(referrer.Earnings),
+		}
+	}
+	RenderDataResponse(w, r, views)
+}
@@ -0,0 +1,38 @@
+package views
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/MixinNetwork/supergroup.mixin.one/models"
+)
+
+type RoleView struct {
+	Type      string    `json:"type"`
+	UserId    string    `json:"user_id"`
+	Role      string    `json:"role"`
+	GrantedBy string    `json:"granted_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func buildRoleView(r *models.Role) RoleView {
+	return RoleView{
+		Type:      "role",
+		UserId:    r.UserId,
+		Role:      r.Role,
+		GrantedBy: r.GrantedBy,
+		CreatedAt: r.CreatedAt,
+	}
+}
+
+func RenderRole(w http.ResponseWriter, r *http.Request, role *models.Role) {
+	RenderDataResponse(w, r, buildRoleView(role))
+}
+
+func RenderRoles(w http.ResponseWriter, r *http.Request, roles []*models.Role) {
+	views := make([]RoleView, len(roles))
+	for i, role := range roles {
+		views[i] = buildRoleView(role)
+	}
+	RenderDataResponse(w, r, views)
+}
@@ -0,0 +1,34 @@
+package views
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/MixinNetwork/supergroup.mixin.one/models"
+)
+
+type SettingView struct {
+	Type       string      `json:"type"`
+	Name       string      `json:"name"`
+	Kind       string      `json:"kind"`
+	Value      interface{} `json:"value"`
+	Default    interface{} `json:"default"`
+	Overridden bool        `json:"overridden"`
+	UpdatedAt  time.Time   `json:"updated_at"`
+}
+
+func RenderSettings(w http.ResponseWriter, r *http.Request, settings []*models.Setting) {
+	views := make([]SettingView, len(settings))
+	for i, s := range settings {
+		views[i] = SettingView{
+			Type:       "setting",
+			Name:       s.Name,
+			Kind:       s.Kind,
+			Value:      s.Value,
+			Default:    s.Default,
+			Overridden: s.Overridden,
+			UpdatedAt:  s.UpdatedAt,
+		}
+	}
+	RenderDataResponse(w, r, views)
+}
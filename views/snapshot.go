@@ -0,0 +1,42 @@
+package views
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/MixinNetwork/supergroup.mixin.one/models"
+)
+
+type SnapshotView struct {
+	Type            string    `json:"type"`
+	SnapshotId      string    `json:"snapshot_id"`
+	UserId          string    `json:"user_id"`
+	AssetId         string    `json:"asset_id"`
+	Amount          string    `json:"amount"`
+	Memo            string    `json:"memo"`
+	TransactionHash string    `json:"transaction_hash"`
+	RequestId       string    `json:"request_id"`
+	Purpose         string    `json:"purpose"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+func RenderSnapshots(w http.ResponseWriter, r *http.Request, snapshots []*models.Snapshot) {
+	views := make([]SnapshotView, len(snapshots))
+	for i, s := range snapshots {
+		views[i] = SnapshotView{
+			Type:            "snapshot",
+			SnapshotId:      s.SnapshotId,
+			UserId:          s.UserId,
+			AssetId:         s.AssetId,
+			Amount:          s.Amount,
+			Memo:            s.Memo,
+			TransactionHash: s.TransactionHash,
+			RequestId:       s.RequestId,
+			Purpose:         s.Purpose,
+			CreatedAt:       s.CreatedAt,
+			UpdatedAt:       s.UpdatedAt,
+		}
+	}
+	RenderDataResponse(w, r, views)
+}
@@ -21,9 +21,14 @@ type UserView struct {
 
 type AccountView struct {
 	UserView
-	AuthenticationToken string `json:"authentication_token"`
-	TraceId             string `json:"trace_id"`
-	State               string `json:"state"`
+	AuthenticationToken string                `json:"authentication_token"`
+	TraceId             string                `json:"trace_id"`
+	State               string                `json:"state"`
+	ProbationUntil      string                `json:"probation_until"`
+	PaidUntil           string                `json:"paid_until"`
+	InProbation         bool                  `json:"in_probation"`
+	Permissions         []string              `json:"permissions"`
+	ReferralEarnings    []ReferralEarningView `json:"referral_earnings"`
 }
 
 func buildUserView(user *models.User) UserView {
@@ -51,11 +56,17 @@ func RenderUserView(w http.ResponseWriter, r *http.Request, user *models.User) {
 }
 
 func RenderAccount(w http.ResponseWriter, r *http.Request, user *models.User) {
+	earnings, _ := user.ReferralEarnings(r.Context())
 	userView := AccountView{
 		UserView:            buildUserView(user),
 		AuthenticationToken: user.AuthenticationToken,
 		TraceId:             user.TraceId,
 		State:               user.State,
+		ProbationUntil:      user.ProbationUntil.Format(time.RFC3339Nano),
+		PaidUntil:           user.PaidUntil.Format(time.RFC3339Nano),
+		InProbation:         user.InProbation(),
+		Permissions:         user.Permissions(r.Context()),
+		ReferralEarnings:    buildReferralEarningViews(earnings),
 	}
 	RenderDataResponse(w, r, userView)
 }